@@ -0,0 +1,279 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Goauth obtains, caches, refreshes and revokes OAuth 2.0 tokens, for
+// testing provider configurations and for shell scripts that need a
+// bearer token.
+//
+// Usage:
+//
+//	goauth [flags] command
+//
+// The commands are:
+//
+//	authcode  run the authorization code flow with a loopback redirect
+//	device    run the device authorization flow
+//	client    obtain a token with the client credentials grant
+//	token     print the cached token, refreshing it if it has expired
+//	refresh   refresh the cached token
+//	revoke    revoke the cached token and remove the cache file
+//
+// The provider and client are given by flags or by a JSON file named
+// with -config, such as
+//
+//	{"provider": "google", "client_id": "...", "client_secret": "...", "scopes": ["openid", "email"]}
+//
+// Flags given on the command line override the file. Each command
+// prints the access token, or with -json the whole token, to standard
+// output, and the commands that obtain a token store it in the -cache
+// file. For example:
+//
+//	curl -H "Authorization: Bearer $(goauth -cache google.token token)" https://www.googleapis.com/oauth2/v1/userinfo
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+
+	"code.google.com/p/goauth2/oauth"
+)
+
+// fileConfig is the format of the -config file. Its fields match the
+// flags of the same purpose.
+type fileConfig struct {
+	Provider     string   `json:"provider"`
+	Issuer       string   `json:"issuer"`
+	ClientId     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	Scopes       []string `json:"scopes"`
+	AuthURL      string   `json:"auth_url"`
+	TokenURL     string   `json:"token_url"`
+	DeviceURL    string   `json:"device_url"`
+	RevokeURL    string   `json:"revoke_url"`
+	Port         int      `json:"port"`
+	Cache        string   `json:"cache"`
+}
+
+var (
+	configFile   = flag.String("config", "", "JSON configuration file")
+	provider     = flag.String("provider", "", "Provider name, such as google or github, for its endpoints")
+	issuer       = flag.String("issuer", "", "OpenID Connect issuer to discover endpoints from")
+	clientId     = flag.String("id", "", "Client ID")
+	clientSecret = flag.String("secret", "", "Client Secret")
+	scope        = flag.String("scope", "", "Space-separated scopes")
+	authURL      = flag.String("auth", "", "Authorization URL")
+	tokenURL     = flag.String("token", "", "Token URL")
+	deviceURL    = flag.String("device", "", "Device authorization URL")
+	revokeURL    = flag.String("revoke", "", "Revocation URL")
+	port         = flag.Int("port", 0, "Loopback port for authcode; any free port if 0")
+	cacheFile    = flag.String("cache", "goauth.token", "Token cache file")
+	printJSON    = flag.Bool("json", false, "Print the whole token as JSON instead of the access token")
+)
+
+const usageMsg = `
+Commands:
+  authcode  run the authorization code flow with a loopback redirect
+  device    run the device authorization flow
+  client    obtain a token with the client credentials grant
+  token     print the cached token, refreshing it if it has expired
+  refresh   refresh the cached token
+  revoke    revoke the cached token and remove the cache file
+`
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("goauth: ")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: goauth [flags] command\n\nFlags:\n")
+		flag.PrintDefaults()
+		fmt.Fprint(os.Stderr, usageMsg)
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	config, err := loadConfig(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cache := oauth.CacheFile(*cacheFile)
+	config.TokenCache = cache
+
+	var tok *oauth.Token
+	switch cmd := flag.Arg(0); cmd {
+	case "authcode":
+		config.LoopbackPort = *port
+		tok, err = config.AuthorizeInteractive(ctx, func(url string) error {
+			fmt.Fprintf(os.Stderr, "Visit this URL to authorize access:\n\n%s\n\n", url)
+			return nil
+		})
+	case "device":
+		t := &oauth.Transport{Config: config}
+		var da *oauth.DeviceAuth
+		if da, err = t.DeviceAuth(ctx); err != nil {
+			break
+		}
+		if da.VerificationURIComplete != "" {
+			fmt.Fprintf(os.Stderr, "Visit %s\nor visit %s and enter the code %s\n", da.VerificationURIComplete, da.VerificationURI, da.UserCode)
+		} else {
+			fmt.Fprintf(os.Stderr, "Visit %s and enter the code %s\n", da.VerificationURI, da.UserCode)
+		}
+		tok, err = t.WaitForDeviceToken(ctx, da)
+	case "client":
+		if tok, err = config.ClientCredentialsToken(ctx); err == nil {
+			err = cache.PutToken(tok)
+		}
+	case "token", "refresh", "revoke":
+		if tok, err = cache.Token(); err != nil {
+			log.Fatalf("reading %s: %v", cache, err)
+		}
+		t := &oauth.Transport{Config: config, Token: tok}
+		switch cmd {
+		case "token":
+			err = t.EnsureValid()
+		case "refresh":
+			err = t.RefreshContext(ctx)
+		case "revoke":
+			// Close revokes the tokens, if there is a RevokeURL, and
+			// removes the cache file.
+			if config.RevokeURL == "" {
+				log.Fatal("no revocation URL; set -revoke or revoke_url")
+			}
+			if err := t.Close(); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+		tok = t.CurrentToken()
+	default:
+		log.Printf("unknown command %q", cmd)
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := printToken(tok); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// loadConfig returns the Config described by the -config file, if any,
+// and the flags set on the command line, which take precedence.
+func loadConfig(ctx context.Context) (*oauth.Config, error) {
+	var fc fileConfig
+	if *configFile != "" {
+		b, err := ioutil.ReadFile(*configFile)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(b, &fc); err != nil {
+			return nil, fmt.Errorf("%s: %v", *configFile, err)
+		}
+	}
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "provider":
+			fc.Provider = *provider
+		case "issuer":
+			fc.Issuer = *issuer
+		case "id":
+			fc.ClientId = *clientId
+		case "secret":
+			fc.ClientSecret = *clientSecret
+		case "scope":
+			fc.Scopes = strings.Fields(*scope)
+		case "auth":
+			fc.AuthURL = *authURL
+		case "token":
+			fc.TokenURL = *tokenURL
+		case "device":
+			fc.DeviceURL = *deviceURL
+		case "revoke":
+			fc.RevokeURL = *revokeURL
+		case "port":
+			fc.Port = *port
+		case "cache":
+			fc.Cache = *cacheFile
+		}
+	})
+	*port = fc.Port
+	if fc.Cache != "" {
+		*cacheFile = fc.Cache
+	}
+
+	var config *oauth.Config
+	switch {
+	case fc.Provider != "":
+		e, ok := oauth.Endpoints[fc.Provider]
+		if !ok {
+			return nil, fmt.Errorf("unknown provider %q; known providers are %s", fc.Provider, providers())
+		}
+		config = oauth.NewConfig(e, "", "")
+	case fc.Issuer != "":
+		var err error
+		if config, err = oauth.Discover(ctx, fc.Issuer); err != nil {
+			return nil, err
+		}
+	default:
+		config = new(oauth.Config)
+	}
+	config.ClientId = fc.ClientId
+	config.ClientSecret = fc.ClientSecret
+	config.Scope = strings.Join(fc.Scopes, " ")
+	if fc.AuthURL != "" {
+		config.AuthURL = fc.AuthURL
+	}
+	if fc.TokenURL != "" {
+		config.TokenURL = fc.TokenURL
+	}
+	if fc.DeviceURL != "" {
+		config.DeviceURL = fc.DeviceURL
+	}
+	if fc.RevokeURL != "" {
+		config.RevokeURL = fc.RevokeURL
+	}
+	if config.TokenURL == "" {
+		return nil, fmt.Errorf("no token URL; set -provider, -issuer or -token")
+	}
+	return config, nil
+}
+
+// providers returns the names of the known providers.
+func providers() string {
+	var names []string
+	for name := range oauth.Endpoints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// printToken writes tok to standard output: its access token, or the
+// whole token as JSON with -json.
+func printToken(tok *oauth.Token) error {
+	if !*printJSON {
+		_, err := fmt.Println(tok.AccessToken)
+		return err
+	}
+	b, err := json.MarshalIndent(tok, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Printf("%s\n", b)
+	return err
+}
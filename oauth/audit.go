@@ -0,0 +1,93 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// An AuditSink receives AuditEvents from a Config's flows, for audit
+// logging. Audit is called synchronously and must not block for long.
+type AuditSink interface {
+	Audit(AuditEvent)
+}
+
+// An AuditEvent records one step of an OAuth flow. It never holds
+// tokens, codes or secrets.
+type AuditEvent struct {
+	// Flow is "authorize", "par", "exchange", "refresh", "device",
+	// "revoke", "introspect", or the grant_type of another token
+	// request.
+	Flow string
+
+	Time     time.Time
+	ClientId string
+
+	// CorrelationID ties together the events of one Transport, or of
+	// the requests made with a context from WithCorrelationID. Events
+	// for authorization URLs, which are built without a Transport,
+	// have none.
+	CorrelationID string
+
+	Outcome   string // "success" or "failure"
+	ErrorCode string // The OAuth error code of a failure, if the server sent one.
+}
+
+type correlationIDKey struct{}
+
+// WithCorrelationID returns a copy of ctx that makes the AuditEvents of
+// requests made with it carry id.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationIDKey{}, id)
+}
+
+// audit reports the outcome err of flow to the Config's AuditSink.
+func (t *Transport) audit(ctx context.Context, flow, clientId string, err error) {
+	if t.AuditSink == nil {
+		return
+	}
+	e := AuditEvent{
+		Flow:          flow,
+		Time:          timeNow(),
+		ClientId:      clientId,
+		CorrelationID: t.correlation(ctx),
+		Outcome:       "success",
+	}
+	if err != nil {
+		e.Outcome = "failure"
+		var re *RetrieveError
+		if errors.As(err, &re) {
+			e.ErrorCode = re.ErrorCode
+		}
+	}
+	t.AuditSink.Audit(e)
+}
+
+// correlation returns the correlation ID of ctx, if it has one, or else
+// the Transport's own, which is chosen at random when first needed.
+func (t *Transport) correlation(ctx context.Context) string {
+	if id, ok := ctx.Value(correlationIDKey{}).(string); ok && id != "" {
+		return id
+	}
+	t.idOnce.Do(func() {
+		t.correlationID, _ = NewState()
+	})
+	return t.correlationID
+}
+
+// grantFlow returns the AuditEvent Flow of a token request.
+func grantFlow(grantType string) string {
+	switch grantType {
+	case "authorization_code":
+		return "exchange"
+	case "refresh_token":
+		return "refresh"
+	case deviceGrantType:
+		return "device"
+	}
+	return grantType
+}
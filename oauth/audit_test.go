@@ -0,0 +1,86 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type auditLog []AuditEvent
+
+func (l *auditLog) Audit(e AuditEvent) { *l = append(*l, e) }
+
+func TestAuditSink(t *testing.T) {
+	refreshOK := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/revoke" {
+			return
+		}
+		if r.FormValue("grant_type") == "refresh_token" && !refreshOK {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"error":"invalid_grant"}`)
+			return
+		}
+		io.WriteString(w, `{"access_token":"s3cr3tt0k3n","refresh_token":"s3cr3tr3fr3sh","expires_in":3600}`)
+	}))
+	defer server.Close()
+
+	var log auditLog
+	transport := &Transport{Config: &Config{
+		ClientId:     "cl13nt1d",
+		ClientSecret: "s3cr3t",
+		TokenURL:     server.URL + "/token",
+		RevokeURL:    server.URL + "/revoke",
+		AuditSink:    &log,
+	}}
+	if _, err := transport.Exchange("c0d3"); err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if err := transport.Refresh(); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	refreshOK = false
+	if err := transport.Refresh(); err == nil {
+		t.Fatalf("Refresh succeeded, want invalid_grant")
+	}
+
+	if len(log) != 3 {
+		t.Fatalf("got %d audit events, want 3: %+v", len(log), log)
+	}
+	for i, want := range []struct{ flow, outcome, code string }{
+		{"exchange", "success", ""},
+		{"refresh", "success", ""},
+		{"refresh", "failure", "invalid_grant"},
+	} {
+		e := log[i]
+		if e.Flow != want.flow || e.Outcome != want.outcome || e.ErrorCode != want.code || e.ClientId != "cl13nt1d" {
+			t.Errorf("event %d = %+v, want %s %s %q", i, e, want.flow, want.outcome, want.code)
+		}
+		if e.CorrelationID == "" || e.CorrelationID != log[0].CorrelationID {
+			t.Errorf("event %d correlation ID = %q, want %q", i, e.CorrelationID, log[0].CorrelationID)
+		}
+		if i > 0 && e.Time.Before(log[i-1].Time) {
+			t.Errorf("event %d is timed before event %d", i, i-1)
+		}
+		if s := strings.ToLower(e.Flow + e.ClientId + e.CorrelationID + e.Outcome + e.ErrorCode); strings.Contains(s, "s3cr3t") || strings.Contains(s, "c0d3") {
+			t.Errorf("event %d leaks a secret: %+v", i, e)
+		}
+	}
+
+	log = nil
+	ctx := WithCorrelationID(context.Background(), "req-42")
+	if err := transport.revokeToken(ctx, "s3cr3tt0k3n", "access_token"); err != nil {
+		t.Fatalf("revokeToken: %v", err)
+	}
+	if len(log) != 1 || log[0].Flow != "revoke" || log[0].CorrelationID != "req-42" {
+		t.Errorf("revoke events = %+v, want one with correlation ID req-42", log)
+	}
+}
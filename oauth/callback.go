@@ -0,0 +1,179 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Errors returned, wrapped in an *AuthorizationError, by ParseCallback
+// when silent authentication with prompt=none fails and the user must
+// be sent through an interactive flow instead (OpenID Connect Core 1.0
+// section 3.1.2.6). Test for them with errors.Is.
+var (
+	ErrLoginRequired            error = OAuthError{"ParseCallback", "login_required"}
+	ErrInteractionRequired      error = OAuthError{"ParseCallback", "interaction_required"}
+	ErrConsentRequired          error = OAuthError{"ParseCallback", "consent_required"}
+	ErrAccountSelectionRequired error = OAuthError{"ParseCallback", "account_selection_required"}
+)
+
+var interactiveErrors = map[string]error{
+	"login_required":             ErrLoginRequired,
+	"interaction_required":       ErrInteractionRequired,
+	"consent_required":           ErrConsentRequired,
+	"account_selection_required": ErrAccountSelectionRequired,
+}
+
+// A Callback is a successful authorization response, as received at the
+// redirect URI.
+type Callback struct {
+	Code  string
+	State string
+
+	// Params holds every parameter of the response, including those
+	// a provider adds, such as session_state, for diagnosis.
+	Params url.Values
+}
+
+// AuthorizationError is returned by ParseCallback when the provider
+// redirects back with an error response (RFC 6749 section 4.1.2.1).
+type AuthorizationError struct {
+	ErrorCode        string // e.g. "access_denied"
+	ErrorDescription string
+	ErrorURI         string
+	State            string
+	Params           url.Values // Every parameter of the response.
+}
+
+func (e *AuthorizationError) Error() string {
+	s := "OAuthError: ParseCallback: " + e.ErrorCode
+	if e.ErrorDescription != "" {
+		s += ": " + e.ErrorDescription
+	}
+	return s
+}
+
+// Is reports whether target is the sentinel error for e's error code,
+// such as ErrLoginRequired for "login_required".
+func (e *AuthorizationError) Is(target error) bool {
+	err, ok := interactiveErrors[e.ErrorCode]
+	return ok && err == target
+}
+
+// ParseCallback parses the authorization response in the query or, for
+// response_mode=form_post, the POST body of r. It returns an
+// *AuthorizationError if the provider reported an error.
+func ParseCallback(r *http.Request) (*Callback, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, OAuthError{"ParseCallback", err.Error()}
+	}
+	if err := authorizationError(r.Form); err != nil {
+		return nil, err
+	}
+	code := r.Form.Get("code")
+	if code == "" {
+		return nil, OAuthError{"ParseCallback", "no code in authorization response"}
+	}
+	return &Callback{Code: code, State: r.Form.Get("state"), Params: r.Form}, nil
+}
+
+// authorizationError returns the *AuthorizationError of an error
+// response with parameters v, or nil if v is not an error response.
+func authorizationError(v url.Values) error {
+	code := v.Get("error")
+	if code == "" {
+		return nil
+	}
+	return &AuthorizationError{
+		ErrorCode:        code,
+		ErrorDescription: v.Get("error_description"),
+		ErrorURI:         v.Get("error_uri"),
+		State:            v.Get("state"),
+		Params:           v,
+	}
+}
+
+// An AuthorizationResponse is a successful authorization response of
+// any flow: the code of the authorization code flow, the tokens of the
+// implicit flow, or both, as the OpenID Connect hybrid flows return.
+type AuthorizationResponse struct {
+	Code  string
+	State string
+
+	// Token holds the access token and the ID token, the latter as
+	// ExtraString("id_token"), returned in the response itself, or is
+	// nil if it returned neither.
+	Token *Token
+
+	// Params holds every parameter of the response.
+	Params url.Values
+}
+
+// ParseAuthorizationResponse parses an authorization response of any
+// response type and mode: fragment, as a browser script forwards it
+// from the redirect URI's fragment, with or without the leading "#",
+// or, if fragment is empty, the query or POST body of r, as the query
+// and form_post response modes deliver it. r may be nil if fragment is
+// not empty.
+//
+// The response's state must match wantState, or it is refused with
+// ErrStateMismatch. If nonce is not empty, an ID token in the response
+// must carry it, or it is refused with ErrNonceMismatch; its signature
+// is not verified, which VerifyIDToken does. It returns an
+// *AuthorizationError if the provider reported an error.
+func ParseAuthorizationResponse(r *http.Request, fragment, wantState, nonce string) (*AuthorizationResponse, error) {
+	var v url.Values
+	if fragment != "" {
+		var err error
+		if v, err = url.ParseQuery(strings.TrimPrefix(fragment, "#")); err != nil {
+			return nil, OAuthError{"ParseAuthorizationResponse", err.Error()}
+		}
+	} else {
+		if r == nil {
+			return nil, OAuthError{"ParseAuthorizationResponse", "no request or fragment"}
+		}
+		if err := r.ParseForm(); err != nil {
+			return nil, OAuthError{"ParseAuthorizationResponse", err.Error()}
+		}
+		v = r.Form
+	}
+	if err := authorizationError(v); err != nil {
+		return nil, err
+	}
+	state := v.Get("state")
+	if wantState == "" || subtle.ConstantTimeCompare([]byte(state), []byte(wantState)) != 1 {
+		return nil, ErrStateMismatch
+	}
+	resp := &AuthorizationResponse{Code: v.Get("code"), State: state, Params: v}
+	access, idToken := v.Get("access_token"), v.Get("id_token")
+	if access != "" || idToken != "" {
+		tok := &Token{AccessToken: access, TokenType: v.Get("token_type"), GrantedScope: v.Get("scope")}
+		if secs, err := strconv.ParseInt(v.Get("expires_in"), 10, 64); err == nil && secs > 0 {
+			tok.Expiry = timeNow().Add(time.Duration(secs) * time.Second)
+		}
+		if idToken != "" {
+			tok = tok.WithExtra(map[string]interface{}{"id_token": idToken})
+		}
+		resp.Token = tok
+	}
+	if resp.Code == "" && resp.Token == nil {
+		return nil, OAuthError{"ParseAuthorizationResponse", "no code or token in authorization response"}
+	}
+	if nonce != "" && idToken != "" {
+		_, claims, _, _, err := splitJWT(idToken)
+		if err != nil {
+			return nil, err
+		}
+		if err := CheckNonce(claims, nonce); err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
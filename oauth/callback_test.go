@@ -0,0 +1,97 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCallback(t *testing.T) {
+	r := httptest.NewRequest("GET", "/cb?code=c0d3&state=st4t3&session_state=s3ss10n", nil)
+	cb, err := ParseCallback(r)
+	if err != nil {
+		t.Fatalf("ParseCallback: %v", err)
+	}
+	if cb.Code != "c0d3" || cb.State != "st4t3" {
+		t.Errorf("ParseCallback = %+v, want code c0d3 and state st4t3", cb)
+	}
+	if g := cb.Params.Get("session_state"); g != "s3ss10n" {
+		t.Errorf("Params session_state = %q, want s3ss10n", g)
+	}
+
+	r = httptest.NewRequest("POST", "/cb", strings.NewReader("code=c0d3&state=st4t3"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if cb, err := ParseCallback(r); err != nil || cb.Code != "c0d3" {
+		t.Errorf("form_post: ParseCallback = %+v, %v", cb, err)
+	}
+
+	if _, err := ParseCallback(httptest.NewRequest("GET", "/cb", nil)); err == nil {
+		t.Errorf("ParseCallback without code succeeded")
+	}
+}
+
+func TestParseCallbackLoginRequired(t *testing.T) {
+	r := httptest.NewRequest("GET", "/cb?error=login_required&error_description=no+session&state=st4t3", nil)
+	_, err := ParseCallback(r)
+	if !errors.Is(err, ErrLoginRequired) {
+		t.Fatalf("ParseCallback error = %v, want ErrLoginRequired", err)
+	}
+	if errors.Is(err, ErrConsentRequired) {
+		t.Errorf("login_required matches ErrConsentRequired")
+	}
+	var ae *AuthorizationError
+	if !errors.As(err, &ae) || ae.State != "st4t3" || ae.ErrorDescription != "no session" {
+		t.Errorf("ParseCallback error = %#v", err)
+	}
+
+	_, err = ParseCallback(httptest.NewRequest("GET", "/cb?error=access_denied", nil))
+	if err == nil || errors.Is(err, ErrLoginRequired) || errors.Is(err, ErrInteractionRequired) {
+		t.Errorf("access_denied: error = %v, want a non-interactive AuthorizationError", err)
+	}
+}
+
+func TestParseAuthorizationResponse(t *testing.T) {
+	now := time.Unix(1e9, 0)
+	defer func(f func() time.Time) { timeNow = f }(timeNow)
+	timeNow = func() time.Time { return now }
+
+	idToken := signTestJWT(t, testRSAKey, "rsa1", map[string]interface{}{"sub": "alice", "nonce": "n0nc3"})
+	fragment := "#access_token=t0k3n&token_type=Bearer&expires_in=3600&state=st4t3&code=c0d3&id_token=" + idToken
+	resp, err := ParseAuthorizationResponse(nil, fragment, "st4t3", "n0nc3")
+	if err != nil {
+		t.Fatalf("ParseAuthorizationResponse: %v", err)
+	}
+	if resp.Code != "c0d3" || resp.Token == nil || resp.Token.AccessToken != "t0k3n" || !resp.Token.Expiry.Equal(now.Add(time.Hour)) {
+		t.Errorf("ParseAuthorizationResponse = %+v", resp)
+	}
+	if g, _ := resp.Token.ExtraString("id_token"); g != idToken {
+		t.Errorf("id_token = %q, want %q", g, idToken)
+	}
+	if _, err := ParseAuthorizationResponse(nil, fragment, "st4t3", "other"); err != ErrNonceMismatch {
+		t.Errorf("wrong nonce: err = %v, want ErrNonceMismatch", err)
+	}
+	if _, err := ParseAuthorizationResponse(nil, fragment, "other", "n0nc3"); err != ErrStateMismatch {
+		t.Errorf("wrong state: err = %v, want ErrStateMismatch", err)
+	}
+
+	r := httptest.NewRequest("POST", "/cb", strings.NewReader("code=c0d3&state=st4t3"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if resp, err := ParseAuthorizationResponse(r, "", "st4t3", "n0nc3"); err != nil || resp.Code != "c0d3" || resp.Token != nil {
+		t.Errorf("form_post: ParseAuthorizationResponse = %+v, %v", resp, err)
+	}
+
+	r = httptest.NewRequest("GET", "/cb?error=access_denied&state=st4t3", nil)
+	var ae *AuthorizationError
+	if _, err := ParseAuthorizationResponse(r, "", "st4t3", ""); !errors.As(err, &ae) || ae.ErrorCode != "access_denied" {
+		t.Errorf("error response: err = %v, want access_denied", err)
+	}
+	if _, err := ParseAuthorizationResponse(nil, "state=st4t3", "st4t3", ""); err == nil {
+		t.Errorf("response without code or token accepted")
+	}
+}
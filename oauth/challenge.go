@@ -0,0 +1,213 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// A Challenge is an authentication challenge from a WWW-Authenticate
+// response header (RFC 7235 section 4.1). OAuth 2.0 resource servers use
+// "Bearer" challenges (RFC 6750 section 3) to explain why a request was
+// rejected: ErrorCode "invalid_token" usually means the token expired or
+// was revoked, "insufficient_scope" that it lacks a required scope.
+type Challenge struct {
+	Scheme           string
+	Realm            string
+	ErrorCode        string // The "error" parameter.
+	ErrorDescription string
+	ErrorURI         string
+	Scope            string // Space-separated scopes the resource requires.
+
+	// Params holds every auth-param of the challenge, keyed by
+	// lower-case name.
+	Params map[string]string
+}
+
+// ParseWWWAuthenticate parses the value of a WWW-Authenticate header,
+// which may hold several challenges, such as
+//
+//	Bearer realm="example", error="invalid_token", error_description="The access token expired"
+func ParseWWWAuthenticate(header string) ([]Challenge, error) {
+	p := &challengeParser{s: header}
+	var cs []Challenge
+	for {
+		p.skip(" \t,")
+		if p.done() {
+			break
+		}
+		scheme := p.token()
+		if scheme == "" {
+			return nil, p.errorf("expected auth-scheme")
+		}
+		c := Challenge{Scheme: scheme, Params: make(map[string]string)}
+		for {
+			p.skip(" \t,")
+			mark := p.i
+			name := p.token()
+			p.skip(" \t")
+			if name == "" || !p.consume('=') {
+				// Not an auth-param: the start of the next challenge.
+				p.i = mark
+				break
+			}
+			p.skip(" \t")
+			var value string
+			if p.peek() == '"' {
+				var ok bool
+				if value, ok = p.quoted(); !ok {
+					return nil, p.errorf("unterminated quoted-string")
+				}
+			} else {
+				value = p.token()
+			}
+			c.Params[strings.ToLower(name)] = value
+		}
+		c.Realm = c.Params["realm"]
+		c.ErrorCode = c.Params["error"]
+		c.ErrorDescription = c.Params["error_description"]
+		c.ErrorURI = c.Params["error_uri"]
+		c.Scope = c.Params["scope"]
+		cs = append(cs, c)
+	}
+	return cs, nil
+}
+
+// stepUpScope returns the scope demanded by a Bearer insufficient_scope
+// challenge in the WWW-Authenticate headers of h, or "" if there is none.
+func stepUpScope(h http.Header) string {
+	for _, v := range h.Values("WWW-Authenticate") {
+		cs, err := ParseWWWAuthenticate(v)
+		if err != nil {
+			continue
+		}
+		for _, c := range cs {
+			if strings.EqualFold(c.Scheme, "Bearer") && c.ErrorCode == "insufficient_scope" && c.Scope != "" {
+				return c.Scope
+			}
+		}
+	}
+	return ""
+}
+
+// An AuthChallengeError is returned by a Transport with ChallengeErrors
+// set when a resource server rejects a request with 401 Unauthorized or
+// 403 Forbidden and a Bearer or DPoP error challenge, such as
+//
+//	Bearer error="insufficient_scope", scope="calendar"
+type AuthChallengeError struct {
+	StatusCode int
+	Challenge  Challenge // The first error challenge of the response.
+}
+
+func (e *AuthChallengeError) Error() string {
+	s := "OAuthError: RoundTrip: " + strconv.Itoa(e.StatusCode) + " " + e.Challenge.ErrorCode
+	if e.Challenge.ErrorDescription != "" {
+		s += ": " + e.Challenge.ErrorDescription
+	}
+	return s
+}
+
+// Scopes returns the scopes the resource requires, as given by an
+// insufficient_scope challenge, to request with
+// Transport.IncrementalAuthCodeURL. It returns nil if the challenge
+// names none.
+func (e *AuthChallengeError) Scopes() []string {
+	return strings.Fields(e.Challenge.Scope)
+}
+
+// challengeError returns the *AuthChallengeError for resp, or nil if it
+// is not a 401 or 403 response with a Bearer or DPoP error challenge.
+func challengeError(resp *http.Response) *AuthChallengeError {
+	if resp.StatusCode != http.StatusUnauthorized && resp.StatusCode != http.StatusForbidden {
+		return nil
+	}
+	for _, v := range resp.Header.Values("WWW-Authenticate") {
+		cs, err := ParseWWWAuthenticate(v)
+		if err != nil {
+			continue
+		}
+		for _, c := range cs {
+			if (strings.EqualFold(c.Scheme, "Bearer") || strings.EqualFold(c.Scheme, "DPoP")) && c.ErrorCode != "" {
+				return &AuthChallengeError{StatusCode: resp.StatusCode, Challenge: c}
+			}
+		}
+	}
+	return nil
+}
+
+// challengeParser is a scanner over a WWW-Authenticate header value.
+type challengeParser struct {
+	s string
+	i int
+}
+
+func (p *challengeParser) done() bool { return p.i >= len(p.s) }
+
+func (p *challengeParser) peek() byte {
+	if p.done() {
+		return 0
+	}
+	return p.s[p.i]
+}
+
+func (p *challengeParser) consume(c byte) bool {
+	if p.peek() == c && !p.done() {
+		p.i++
+		return true
+	}
+	return false
+}
+
+func (p *challengeParser) skip(chars string) {
+	for !p.done() && strings.IndexByte(chars, p.s[p.i]) >= 0 {
+		p.i++
+	}
+}
+
+// token scans an RFC 7230 token.
+func (p *challengeParser) token() string {
+	start := p.i
+	for !p.done() && isTokenChar(p.s[p.i]) {
+		p.i++
+	}
+	return p.s[start:p.i]
+}
+
+// quoted scans a quoted-string, resolving backslash escapes.
+func (p *challengeParser) quoted() (string, bool) {
+	p.i++ // opening quote
+	var b strings.Builder
+	for !p.done() {
+		c := p.s[p.i]
+		p.i++
+		switch c {
+		case '"':
+			return b.String(), true
+		case '\\':
+			if p.done() {
+				return "", false
+			}
+			c = p.s[p.i]
+			p.i++
+		}
+		b.WriteByte(c)
+	}
+	return "", false
+}
+
+func (p *challengeParser) errorf(msg string) error {
+	return OAuthError{"ParseWWWAuthenticate", msg + " in " + strings.TrimSpace(p.s)}
+}
+
+func isTokenChar(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	}
+	return strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0
+}
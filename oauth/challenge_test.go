@@ -0,0 +1,108 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestParseWWWAuthenticate(t *testing.T) {
+	const h = `Bearer realm="example", error="invalid_token", ` +
+		`error_description="The access token expired, \"please\" refresh", ` +
+		`error_uri="https://example.net/errors", Basic realm=legacy`
+	cs, err := ParseWWWAuthenticate(h)
+	if err != nil {
+		t.Fatalf("ParseWWWAuthenticate: %v", err)
+	}
+	want := []Challenge{
+		{
+			Scheme:           "Bearer",
+			Realm:            "example",
+			ErrorCode:        "invalid_token",
+			ErrorDescription: `The access token expired, "please" refresh`,
+			ErrorURI:         "https://example.net/errors",
+			Params: map[string]string{
+				"realm":             "example",
+				"error":             "invalid_token",
+				"error_description": `The access token expired, "please" refresh`,
+				"error_uri":         "https://example.net/errors",
+			},
+		},
+		{Scheme: "Basic", Realm: "legacy", Params: map[string]string{"realm": "legacy"}},
+	}
+	if !reflect.DeepEqual(cs, want) {
+		t.Errorf("ParseWWWAuthenticate =\n%+v\nwant\n%+v", cs, want)
+	}
+
+	cs, err = ParseWWWAuthenticate("Bearer")
+	if err != nil || len(cs) != 1 || cs[0].Scheme != "Bearer" || len(cs[0].Params) != 0 {
+		t.Errorf(`ParseWWWAuthenticate("Bearer") = %+v, %v`, cs, err)
+	}
+
+	for _, bad := range []string{`Bearer error="unterminated`, `=oops`} {
+		if _, err := ParseWWWAuthenticate(bad); err == nil {
+			t.Errorf("ParseWWWAuthenticate(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestParseWWWAuthenticateScope(t *testing.T) {
+	cs, err := ParseWWWAuthenticate(`Bearer error="insufficient_scope", scope="admin read"`)
+	if err != nil {
+		t.Fatalf("ParseWWWAuthenticate: %v", err)
+	}
+	if len(cs) != 1 || cs[0].Scope != "admin read" {
+		t.Fatalf("ParseWWWAuthenticate = %+v, want one challenge with scope \"admin read\"", cs)
+	}
+}
+
+func TestChallengeErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/admin":
+			w.Header().Set("WWW-Authenticate", `Basic realm="legacy", Bearer error="insufficient_scope", error_description="admin required", scope="admin audit"`)
+			w.WriteHeader(http.StatusForbidden)
+		case "/private":
+			w.Header().Set("WWW-Authenticate", `Bearer realm="example"`)
+			w.WriteHeader(http.StatusUnauthorized)
+		default:
+			io.WriteString(w, "ok")
+		}
+	}))
+	defer server.Close()
+
+	transport := &Transport{
+		Config:          &Config{},
+		Token:           &Token{AccessToken: "t0k3n"},
+		ChallengeErrors: true,
+	}
+	_, err := transport.Client().Get(server.URL + "/admin")
+	var ce *AuthChallengeError
+	if !errors.As(err, &ce) {
+		t.Fatalf("Get /admin: err = %v, want an *AuthChallengeError", err)
+	}
+	if ce.StatusCode != http.StatusForbidden || ce.Challenge.ErrorCode != "insufficient_scope" || !reflect.DeepEqual(ce.Scopes(), []string{"admin", "audit"}) {
+		t.Errorf("AuthChallengeError = %+v, scopes %q", ce, ce.Scopes())
+	}
+
+	// A challenge without an error code, as for a request sent with no
+	// token at all, is left to the caller.
+	resp, err := transport.Client().Get(server.URL + "/private")
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Get /private = %v, %v, want the 401 response", resp, err)
+	} else {
+		resp.Body.Close()
+	}
+	resp, err = transport.Client().Get(server.URL + "/")
+	if err != nil {
+		t.Fatalf("Get /: %v", err)
+	}
+	checkBody(t, resp, "ok")
+}
@@ -0,0 +1,61 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"context"
+	"net/url"
+)
+
+// ClientCredentialsToken obtains a Token with the client credentials
+// grant (RFC 6749 section 4.4), for a service acting on its own behalf
+// rather than a user's. It requests the Config's Scope and Scopes.
+func (c *Config) ClientCredentialsToken(ctx context.Context) (*Token, error) {
+	tok := new(Token)
+	if err := (&Transport{Config: c}).clientCredentials(ctx, tok, c.requestedScope()); err != nil {
+		return nil, err
+	}
+	return tok, nil
+}
+
+// ClientCredentialsTokenSource returns a TokenSource that obtains Tokens
+// with the client credentials grant. Its first call to Token obtains a
+// Token, and later calls return that Token until it expires, or will
+// expire within the Config's ExpiryDelta, and then obtain a new one.
+// Use it with WrapRoundTripper to make authenticated requests:
+//
+//	client := &http.Client{Transport: oauth.WrapRoundTripper(nil, config.ClientCredentialsTokenSource())}
+func (c *Config) ClientCredentialsTokenSource() TokenSource {
+	return &clientCredentialsSource{t: &Transport{Config: c}}
+}
+
+type clientCredentialsSource struct {
+	t *Transport
+}
+
+func (s *clientCredentialsSource) Token() (*Token, error) {
+	t := s.t
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.Token == nil || t.dueForRefresh(t.ExpiryDelta) {
+		tok := new(Token)
+		if err := t.clientCredentials(context.Background(), tok, t.requestedScope()); err != nil {
+			return nil, err
+		}
+		t.Token = tok
+	}
+	tok := *t.Token
+	return &tok, nil
+}
+
+// clientCredentials fills in tok with a client credentials grant for
+// scope, if it is not empty.
+func (t *Transport) clientCredentials(ctx context.Context, tok *Token, scope string) error {
+	v := url.Values{"grant_type": {"client_credentials"}}
+	if scope != "" {
+		v.Set("scope", scope)
+	}
+	return t.updateToken(ctx, tok, v)
+}
@@ -0,0 +1,78 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClientCredentials(t *testing.T) {
+	now := time.Now()
+	defer func(f func() time.Time) { timeNow = f }(timeNow)
+	timeNow = func() time.Time { return now }
+
+	n := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api" {
+			fmt.Fprint(w, r.Header.Get("Authorization"))
+			return
+		}
+		n++
+		if g := r.FormValue("grant_type"); g != "client_credentials" {
+			t.Errorf("grant_type = %q, want client_credentials", g)
+		}
+		if g := r.FormValue("scope"); g != "read write" {
+			t.Errorf("scope = %q, want %q", g, "read write")
+		}
+		if id, secret, _ := r.BasicAuth(); id != "cl13nt1d" || secret != "s3cr3t" {
+			t.Errorf("request not authenticated as the client")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"token%d","token_type":"Bearer","expires_in":60}`, n)
+	}))
+	defer server.Close()
+
+	config := &Config{
+		ClientId:     "cl13nt1d",
+		ClientSecret: "s3cr3t",
+		Scope:        "read write",
+		TokenURL:     server.URL + "/token",
+		AuthStyle:    AuthStyleInHeader,
+	}
+	tok, err := config.ClientCredentialsToken(context.Background())
+	if err != nil {
+		t.Fatalf("ClientCredentialsToken: %v", err)
+	}
+	if tok.AccessToken != "token1" || tok.Expiry.IsZero() {
+		t.Errorf("ClientCredentialsToken = %v, want token1 with an expiry", tok)
+	}
+
+	client := &http.Client{Transport: WrapRoundTripper(nil, config.ClientCredentialsTokenSource())}
+	get := func() string {
+		resp, err := client.Get(server.URL + "/api")
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		defer resp.Body.Close()
+		var auth string
+		fmt.Fscan(resp.Body, new(string), &auth)
+		return auth
+	}
+	if g := get(); g != "token2" {
+		t.Errorf("first request sent %q, want token2", g)
+	}
+	if g := get(); g != "token2" || n != 2 {
+		t.Errorf("second request sent %q after %d token requests, want token2 after 2", g, n)
+	}
+	now = now.Add(2 * time.Minute)
+	if g := get(); g != "token3" {
+		t.Errorf("request after expiry sent %q, want token3", g)
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strconv"
+	"time"
+)
+
+// A TokenCodec serializes Tokens for storage by a Cache. Caches that
+// take one use JSONCodec if it is nil.
+type TokenCodec interface {
+	Marshal(*Token) ([]byte, error)
+	Unmarshal([]byte) (*Token, error)
+}
+
+// JSONCodec encodes Tokens as JSON, as CacheFile stores them.
+var JSONCodec TokenCodec = jsonCodec{}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(tok *Token) ([]byte, error) {
+	b, err := json.Marshal(tok)
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+func (jsonCodec) Unmarshal(b []byte) (*Token, error) {
+	tok := &Token{}
+	if err := json.Unmarshal(b, tok); err != nil {
+		return nil, err
+	}
+	return tok, nil
+}
+
+// TokenFormatVersion is the version of the wire format written by
+// EncodeToken.
+const TokenFormatVersion = 1
+
+// VersionedCodec encodes Tokens with EncodeToken, in a format that
+// stays readable across versions of this package.
+var VersionedCodec TokenCodec = versionedCodec{}
+
+type versionedCodec struct{}
+
+func (versionedCodec) Marshal(tok *Token) ([]byte, error) { return EncodeToken(tok) }
+func (versionedCodec) Unmarshal(b []byte) (*Token, error) { return DecodeToken(b) }
+
+// wireToken is version 1 of the format of EncodeToken.
+type wireToken struct {
+	Version         int                    `json:"version"`
+	AccessToken     string                 `json:"access_token"`
+	RefreshToken    string                 `json:"refresh_token,omitempty"`
+	TokenType       string                 `json:"token_type,omitempty"`
+	Expiry          *time.Time             `json:"expiry,omitempty"`
+	Scope           string                 `json:"scope,omitempty"`
+	IssuedTokenType string                 `json:"issued_token_type,omitempty"`
+	RefreshAfter    *time.Time             `json:"refresh_after,omitempty"`
+	Extra           map[string]interface{} `json:"extra,omitempty"`
+}
+
+// EncodeToken encodes tok as a JSON object with a "version" field, so
+// that stores shared by programs built with different versions of this
+// package can read each other's Tokens. The fields of version 1 are
+// access_token, refresh_token, token_type, expiry and refresh_after (in
+// RFC 3339 form), scope, issued_token_type, and extra, which holds the
+// fields returned by the token endpoint as Extra reports them.
+func EncodeToken(tok *Token) ([]byte, error) {
+	w := wireToken{
+		Version:         TokenFormatVersion,
+		AccessToken:     tok.AccessToken,
+		RefreshToken:    tok.RefreshToken,
+		TokenType:       tok.TokenType,
+		Scope:           tok.GrantedScope,
+		IssuedTokenType: tok.IssuedTokenType,
+		Extra:           tok.raw,
+	}
+	if !tok.Expiry.IsZero() {
+		w.Expiry = &tok.Expiry
+	}
+	if !tok.RefreshAfter.IsZero() {
+		w.RefreshAfter = &tok.RefreshAfter
+	}
+	b, err := json.Marshal(w)
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+// DecodeToken decodes a Token encoded by EncodeToken, or by JSONCodec
+// before the format was versioned. It fails for a version newer than
+// TokenFormatVersion, rather than lose fields it does not know.
+func DecodeToken(b []byte) (*Token, error) {
+	var v struct {
+		Version *int `json:"version"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, OAuthError{"DecodeToken", err.Error()}
+	}
+	if v.Version == nil {
+		tok, err := JSONCodec.Unmarshal(b)
+		if err != nil {
+			return nil, OAuthError{"DecodeToken", err.Error()}
+		}
+		return tok, nil
+	}
+	if *v.Version < 1 || *v.Version > TokenFormatVersion {
+		return nil, OAuthError{"DecodeToken", "unsupported token format version " + strconv.Itoa(*v.Version)}
+	}
+	var w wireToken
+	if err := json.Unmarshal(b, &w); err != nil {
+		return nil, OAuthError{"DecodeToken", err.Error()}
+	}
+	tok := &Token{
+		AccessToken:     w.AccessToken,
+		RefreshToken:    w.RefreshToken,
+		TokenType:       w.TokenType,
+		GrantedScope:    w.Scope,
+		IssuedTokenType: w.IssuedTokenType,
+		raw:             w.Extra,
+	}
+	if w.Expiry != nil {
+		tok.Expiry = *w.Expiry
+	}
+	if w.RefreshAfter != nil {
+		tok.RefreshAfter = *w.RefreshAfter
+	}
+	return tok, nil
+}
+
+// EncodedCacheFile implements Cache like CacheFile, but stores the
+// Token in the encoding of Codec, writing the file as CacheFile does.
+type EncodedCacheFile struct {
+	File  CacheFile
+	Codec TokenCodec
+}
+
+func (f *EncodedCacheFile) Token() (*Token, error) {
+	b, err := ioutil.ReadFile(string(f.File))
+	if err != nil {
+		return nil, OAuthError{"EncodedCacheFile.Token", err.Error()}
+	}
+	tok, err := codec(f.Codec).Unmarshal(b)
+	if err != nil {
+		return nil, OAuthError{"EncodedCacheFile.Token", err.Error()}
+	}
+	return tok, nil
+}
+
+func (f *EncodedCacheFile) PutToken(tok *Token) error {
+	b, err := codec(f.Codec).Marshal(tok)
+	if err != nil {
+		return OAuthError{"EncodedCacheFile.PutToken", err.Error()}
+	}
+	if err := writeFile(string(f.File), b); err != nil {
+		return OAuthError{"EncodedCacheFile.PutToken", err.Error()}
+	}
+	return nil
+}
+
+// Clear removes the cache file.
+func (f *EncodedCacheFile) Clear() error {
+	return f.File.Clear()
+}
+
+// codec returns c, or JSONCodec if c is nil.
+func codec(c TokenCodec) TokenCodec {
+	if c == nil {
+		return JSONCodec
+	}
+	return c
+}
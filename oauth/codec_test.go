@@ -0,0 +1,141 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// binaryCodec stores the access and refresh tokens, NUL-separated, after
+// the expiry in Unix seconds.
+type binaryCodec struct{}
+
+func (binaryCodec) Marshal(tok *Token) ([]byte, error) {
+	b := binary.BigEndian.AppendUint64(nil, uint64(tok.Expiry.Unix()))
+	return append(b, tok.AccessToken+"\x00"+tok.RefreshToken...), nil
+}
+
+func (binaryCodec) Unmarshal(b []byte) (*Token, error) {
+	if len(b) < 8 {
+		return nil, errors.New("short token")
+	}
+	parts := bytes.SplitN(b[8:], []byte{0}, 2)
+	if len(parts) != 2 {
+		return nil, errors.New("no refresh token")
+	}
+	return &Token{
+		AccessToken:  string(parts[0]),
+		RefreshToken: string(parts[1]),
+		Expiry:       time.Unix(int64(binary.BigEndian.Uint64(b)), 0),
+	}, nil
+}
+
+func TestEncodedCacheFile(t *testing.T) {
+	want := &Token{AccessToken: "token1", RefreshToken: "refreshtoken1", Expiry: time.Unix(1e9, 0)}
+	f := &EncodedCacheFile{File: CacheFile(filepath.Join(t.TempDir(), "token")), Codec: binaryCodec{}}
+	if err := f.PutToken(want); err != nil {
+		t.Fatalf("PutToken: %v", err)
+	}
+	b, err := ioutil.ReadFile(string(f.File))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wb, _ := (binaryCodec{}).Marshal(want); !bytes.Equal(b, wb) {
+		t.Errorf("file holds %q, want %q", b, wb)
+	}
+	got, err := f.Token()
+	if err != nil {
+		t.Fatalf("Token: %v", err)
+	}
+	if !got.Equal(want) {
+		t.Errorf("Token = %v, want %v", got, want)
+	}
+
+	// Without a Codec, the file is readable as a CacheFile.
+	f.Codec = nil
+	if err := f.PutToken(want); err != nil {
+		t.Fatalf("PutToken: %v", err)
+	}
+	if got, err = f.File.Token(); err != nil || !got.Equal(want) {
+		t.Errorf("CacheFile.Token = %v, %v; want %v", got, err, want)
+	}
+
+	if err := f.Clear(); err != nil {
+		t.Fatalf("Clear: %v", err)
+	}
+	if _, err := f.Token(); err == nil {
+		t.Errorf("Token after Clear succeeded")
+	}
+}
+
+func TestEncryptedCacheFileCodec(t *testing.T) {
+	f := newEncryptedCacheFile(t)
+	f.Codec = binaryCodec{}
+	want := &Token{AccessToken: "token1", RefreshToken: "refreshtoken1", Expiry: time.Unix(1e9, 0)}
+	if err := f.PutToken(want); err != nil {
+		t.Fatalf("PutToken: %v", err)
+	}
+	if got, err := f.Token(); err != nil || !got.Equal(want) {
+		t.Errorf("Token = %v, %v; want %v", got, err, want)
+	}
+	f.Codec = nil
+	if _, err := f.Token(); err == nil {
+		t.Errorf("Token decoded binary contents as JSON")
+	}
+}
+
+func TestEncodeToken(t *testing.T) {
+	expiry := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	tok := (&Token{
+		AccessToken:  "t0k3n",
+		RefreshToken: "r3fr3sh",
+		TokenType:    "Bearer",
+		Expiry:       expiry,
+		GrantedScope: "read write",
+	}).WithExtra(map[string]interface{}{"id_token": "1d"})
+
+	b, err := EncodeToken(tok)
+	if err != nil {
+		t.Fatalf("EncodeToken: %v", err)
+	}
+	var wire map[string]interface{}
+	if err := json.Unmarshal(b, &wire); err != nil {
+		t.Fatal(err)
+	}
+	if wire["version"] != float64(TokenFormatVersion) || wire["access_token"] != "t0k3n" || wire["expiry"] != "2030-01-02T03:04:05Z" || wire["scope"] != "read write" {
+		t.Errorf("EncodeToken = %s", b)
+	}
+	if _, ok := wire["refresh_after"]; ok {
+		t.Errorf("EncodeToken wrote a zero refresh_after: %s", b)
+	}
+
+	legacy, err := JSONCodec.Marshal(tok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, b := range map[string][]byte{"versioned": b, "legacy": legacy} {
+		got, err := DecodeToken(b)
+		if err != nil {
+			t.Fatalf("%s: DecodeToken: %v", name, err)
+		}
+		if !got.Equal(tok) || !got.Expiry.Equal(expiry) {
+			t.Errorf("%s: DecodeToken = %v, want %v", name, got, tok)
+		}
+		if g, _ := got.ExtraString("id_token"); g != "1d" {
+			t.Errorf("%s: id_token = %q, want 1d", name, g)
+		}
+	}
+
+	if _, err := DecodeToken([]byte(`{"version":2,"access_token":"t0k3n"}`)); err == nil {
+		t.Errorf("DecodeToken accepted a newer format version")
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// defaultMetadataHost is the Google Compute Engine metadata server.
+const defaultMetadataHost = "metadata.google.internal"
+
+// ComputeTokenSource returns a TokenSource for programs running on Google
+// Compute Engine, Cloud Run and similar environments, which obtains the
+// access tokens of the instance's service account account from the
+// metadata server rather than from credentials shipped with the
+// program. An empty account means the default service account. scopes,
+// if any, narrow the tokens to those scopes where the environment
+// supports it.
+//
+// Tokens are reused until they expire. The metadata server is found at
+// the host in the GCE_METADATA_HOST environment variable, if it is set.
+// Each request to it is bounded by DefaultRequestTimeout, so that Token
+// fails rather than hangs where there is no metadata server.
+func ComputeTokenSource(account string, scopes ...string) TokenSource {
+	return new(Config).ComputeTokenSource(account, scopes...)
+}
+
+// ComputeTokenSource is like the package's ComputeTokenSource, but makes
+// its requests to the metadata server as the Config makes requests to
+// the provider's endpoints: bounded by RequestTimeout, and through its
+// TokenTransport and transport settings.
+func (c *Config) ComputeTokenSource(account string, scopes ...string) TokenSource {
+	if account == "" {
+		account = "default"
+	}
+	return ReuseTokenSource(nil, &computeSource{config: c, account: account, scopes: scopes})
+}
+
+type computeSource struct {
+	config  *Config
+	account string
+	scopes  []string
+}
+
+func (s *computeSource) Token() (*Token, error) {
+	host := os.Getenv("GCE_METADATA_HOST")
+	if host == "" {
+		host = defaultMetadataHost
+	}
+	u := "http://" + host + "/computeMetadata/v1/instance/service-accounts/" + url.PathEscape(s.account) + "/token"
+	if len(s.scopes) > 0 {
+		u += "?" + url.Values{"scopes": {strings.Join(s.scopes, ",")}}.Encode()
+	}
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	r, err := s.config.endpointClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != 200 {
+		return nil, OAuthError{"ComputeTokenSource", "metadata server: " + r.Status}
+	}
+	body, err := readBody(r.Body, s.config.maxResponseBytes())
+	if err != nil {
+		return nil, err
+	}
+	var b struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+		TokenType   string `json:"token_type"`
+	}
+	if err := json.Unmarshal(body, &b); err != nil {
+		return nil, OAuthError{"ComputeTokenSource", err.Error()}
+	}
+	if b.AccessToken == "" {
+		return nil, OAuthError{"ComputeTokenSource", "metadata server returned no access token"}
+	}
+	tok := &Token{AccessToken: b.AccessToken, TokenType: b.TokenType}
+	if b.ExpiresIn > 0 {
+		tok.Expiry = timeNow().Add(time.Duration(b.ExpiresIn) * time.Second)
+	}
+	return tok, nil
+}
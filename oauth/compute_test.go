@@ -0,0 +1,82 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestComputeTokenSource(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.URL.Path != "/computeMetadata/v1/instance/service-accounts/worker@example.iam.gserviceaccount.com/token" {
+			http.NotFound(w, r)
+			return
+		}
+		if g := r.URL.Query().Get("scopes"); g != "email,profile" {
+			t.Errorf("scopes = %q, want email,profile", g)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"m3t4d4t4-%d","expires_in":3599,"token_type":"Bearer"}`, requests)
+	}))
+	defer server.Close()
+	t.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(server.URL, "http://"))
+
+	ts := ComputeTokenSource("worker@example.iam.gserviceaccount.com", "email", "profile")
+	for i := 0; i < 2; i++ {
+		tok, err := ts.Token()
+		if err != nil {
+			t.Fatalf("Token: %v", err)
+		}
+		if tok.AccessToken != "m3t4d4t4-1" || tok.TokenType != "Bearer" || !tok.Valid() {
+			t.Errorf("Token = %+v", tok)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("made %d metadata requests, want 1", requests)
+	}
+
+	if _, err := ComputeTokenSource("").Token(); err == nil {
+		t.Errorf("Token for an unknown account succeeded")
+	}
+}
+
+func TestComputeTokenSourceTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+	t.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(server.URL, "http://"))
+
+	config := &Config{RequestTimeout: 50 * time.Millisecond}
+	done := make(chan error, 1)
+	go func() {
+		_, err := config.ComputeTokenSource("").Token()
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Errorf("Token from a hung metadata server succeeded")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Token from a hung metadata server did not time out")
+	}
+}
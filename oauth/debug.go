@@ -0,0 +1,142 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// sensitiveParams are the parameters and response fields whose values
+// Logf never sees.
+var sensitiveParams = map[string]bool{
+	"access_token":     true,
+	"actor_token":      true,
+	"assertion":        true,
+	"client_assertion": true,
+	"client_secret":    true,
+	"code":             true,
+	"code_verifier":    true,
+	"device_code":      true,
+	"id_token":         true,
+	"nonce":            true,
+	"password":         true,
+	"refresh_token":    true,
+	"request":          true, // a request object carries state and nonce
+	"state":            true,
+	"subject_token":    true,
+	"token":            true,
+}
+
+// sensitive reports whether the value of the parameter or response
+// field name must be redacted, allowing for the Config's FieldMap.
+func (c *Config) sensitive(name string) bool {
+	if sensitiveParams[name] {
+		return true
+	}
+	for std, f := range c.FieldMap {
+		if f == name && sensitiveParams[std] {
+			return true
+		}
+	}
+	return false
+}
+
+// redactValues returns v encoded with the values of sensitive
+// parameters replaced by "[redacted]".
+func (c *Config) redactValues(v url.Values) string {
+	keys := make([]string, 0, len(v))
+	for k := range v {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		for _, s := range v[k] {
+			if c.sensitive(k) && s != "" {
+				s = "[redacted]"
+			} else {
+				s = url.QueryEscape(s)
+			}
+			parts = append(parts, url.QueryEscape(k)+"="+s)
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// redactBody returns a body of content type ct with the values of
+// sensitive fields replaced by "[redacted]". Bodies that are neither
+// JSON objects nor form-encoded are summarised by their length.
+func (c *Config) redactBody(ct string, b []byte) string {
+	if len(b) == 0 {
+		return "(empty)"
+	}
+	var obj map[string]interface{}
+	if json.Unmarshal(b, &obj) == nil {
+		for k := range obj {
+			if c.sensitive(k) {
+				obj[k] = "[redacted]"
+			}
+		}
+		out, _ := json.Marshal(obj)
+		return string(out)
+	}
+	if strings.HasPrefix(ct, "application/x-www-form-urlencoded") || strings.HasPrefix(ct, "text/plain") {
+		if v, err := url.ParseQuery(string(b)); err == nil {
+			return c.redactValues(v)
+		}
+	}
+	return "(" + ct + ", " + strconv.Itoa(len(b)) + " bytes)"
+}
+
+// logRequest reports a request to one of the provider's endpoints, with
+// form parameters v, to the Config's Logf.
+func (c *Config) logRequest(req *http.Request, v url.Values) {
+	if c.Logf == nil {
+		return
+	}
+	auth := ""
+	if req.Header.Get("Authorization") != "" {
+		auth = " Authorization: [redacted]"
+	}
+	c.Logf("oauth: %s %s%s %s", req.Method, c.redactURL(req.URL), auth, c.redactValues(v))
+}
+
+// logResponse reports resp to the Config's Logf. It reads up to
+// MaxResponseBytes of the body and leaves resp.Body reading the same
+// bytes as before.
+func (c *Config) logResponse(resp *http.Response) {
+	if c.Logf == nil {
+		return
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, c.maxResponseBytes()))
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(b), resp.Body), resp.Body}
+	if err != nil {
+		c.Logf("oauth: %s from %s: reading body: %v", resp.Status, c.redactURL(resp.Request.URL), err)
+		return
+	}
+	c.Logf("oauth: %s from %s: %s", resp.Status, c.redactURL(resp.Request.URL), c.redactBody(resp.Header.Get("Content-Type"), b))
+}
+
+// redactURL returns u with the values of sensitive query parameters
+// replaced by "[redacted]".
+func (c *Config) redactURL(u *url.URL) string {
+	if u.RawQuery == "" {
+		return u.String()
+	}
+	u2 := *u
+	u2.RawQuery = ""
+	return u2.String() + "?" + c.redactValues(u.Query())
+}
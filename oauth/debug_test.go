@@ -0,0 +1,69 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLogf(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"access_token":"s3cr3tt0k3n","refresh_token":"s3cr3tr3fr3sh","id_token":"s3cr3t1d","expires_in":3600}`)
+	}))
+	defer server.Close()
+
+	var log []string
+	transport := &Transport{Config: &Config{
+		ClientId:     "cl13nt1d",
+		ClientSecret: "s3cr3t",
+		AuthURL:      server.URL + "/auth",
+		TokenURL:     server.URL + "/token",
+		AuthStyle:    AuthStyleBoth,
+		Logf: func(format string, args ...interface{}) {
+			log = append(log, fmt.Sprintf(format, args...))
+		},
+	}}
+	transport.AuthCodeURL("s3cr3tst4t3")
+	tok, err := transport.Exchange("s3cr3tc0d3")
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if tok.AccessToken != "s3cr3tt0k3n" {
+		t.Errorf("AccessToken = %q; logging consumed the response", tok.AccessToken)
+	}
+	if err := transport.Refresh(); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+
+	if len(log) != 5 {
+		t.Fatalf("got %d log lines, want 5:\n%s", len(log), strings.Join(log, "\n"))
+	}
+	for i, want := range []string{
+		"oauth: authorize " + server.URL + "/auth?",
+		"oauth: POST " + server.URL + "/token Authorization: [redacted] ",
+		"oauth: 200 OK from " + server.URL + "/token: ",
+		"oauth: POST " + server.URL + "/token Authorization: [redacted] ",
+		"oauth: 200 OK from " + server.URL + "/token: ",
+	} {
+		if !strings.HasPrefix(log[i], want) {
+			t.Errorf("log line %d = %q, want prefix %q", i, log[i], want)
+		}
+		if strings.Contains(log[i], "s3cr3t") {
+			t.Errorf("log line %d leaks a secret: %q", i, log[i])
+		}
+	}
+	if !strings.Contains(log[1], "grant_type=authorization_code") || !strings.Contains(log[1], "client_id=cl13nt1d") {
+		t.Errorf("request summary %q lacks its parameters", log[1])
+	}
+	if !strings.Contains(log[2], `"expires_in":3600`) {
+		t.Errorf("response summary %q lacks its fields", log[2])
+	}
+}
@@ -0,0 +1,201 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"time"
+)
+
+// deviceGrantType is the grant_type of device access token requests.
+const deviceGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+// ErrDeviceCodeExpired is returned by WaitForDeviceToken when the device
+// code's lifetime elapses before the user grants access.
+var ErrDeviceCodeExpired error = OAuthError{"WaitForDeviceToken", "device code expired"}
+
+// DeviceAuth is the response of a device authorization request
+// (RFC 8628 section 3.2). The user visits VerificationURI and enters
+// UserCode, while the application waits with WaitForDeviceToken.
+type DeviceAuth struct {
+	DeviceCode              string
+	UserCode                string
+	VerificationURI         string
+	VerificationURIComplete string    // Optional; includes the user code.
+	Expiry                  time.Time // If zero the device code has no (known) expiry time.
+	Interval                time.Duration
+
+	// OnPending, if non-nil, is called by WaitForDeviceToken each time
+	// the server answers that the user has not yet granted access, for
+	// example to show progress.
+	OnPending func()
+}
+
+// DeviceAuth starts the device authorization grant by requesting a device
+// and user code from the Config's DeviceURL. A Config with a
+// ClientSecret or AuthStylePrivateKeyJWT authenticates the request in
+// its AuthStyle. It returns an error if the response lacks the device
+// code, the user code or the verification URI, which may also be sent
+// as "verification_url".
+func (t *Transport) DeviceAuth(ctx context.Context) (*DeviceAuth, error) {
+	if t.Config == nil {
+		return nil, OAuthError{"DeviceAuth", "no Config supplied"}
+	}
+	c := t.config()
+	v := url.Values{"scope": {c.requestedScope()}}
+	if c.Audience != "" {
+		v.Set("audience", c.Audience)
+	}
+	if len(c.Resources) > 0 {
+		v["resource"] = append([]string(nil), c.Resources...)
+	}
+	// Confidential clients authenticate as they do to the token
+	// endpoint; public clients only identify themselves.
+	var auth *clientAuth
+	if c.ClientSecret != "" || c.AuthStyle == AuthStylePrivateKeyJWT {
+		auth = &clientAuth{c.endpointAuthStyle(), c.ClientId, c.ClientSecret}
+	} else {
+		v.Set("client_id", c.ClientId)
+	}
+	r, err := t.postForm(ctx, c, c.DeviceURL, v, auth)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != 200 {
+		return nil, retrieveError(r)
+	}
+	body, err := readBody(r.Body, c.maxResponseBytes())
+	if err != nil {
+		return nil, err
+	}
+	var b struct {
+		DeviceCode              string `json:"device_code"`
+		UserCode                string `json:"user_code"`
+		VerificationURI         string `json:"verification_uri"`
+		VerificationURL         string `json:"verification_url"` // Google's name for verification_uri.
+		VerificationURIComplete string `json:"verification_uri_complete"`
+		ExpiresIn               int64  `json:"expires_in"`
+		Interval                int64  `json:"interval"`
+	}
+	if err = json.Unmarshal(body, &b); err != nil {
+		return nil, OAuthError{"DeviceAuth", err.Error()}
+	}
+	if b.VerificationURI == "" {
+		b.VerificationURI = b.VerificationURL
+	}
+	if b.DeviceCode == "" || b.UserCode == "" || b.VerificationURI == "" {
+		return nil, OAuthError{"DeviceAuth", "response lacks device_code, user_code or verification_uri"}
+	}
+	da := &DeviceAuth{
+		DeviceCode:              b.DeviceCode,
+		UserCode:                b.UserCode,
+		VerificationURI:         b.VerificationURI,
+		VerificationURIComplete: b.VerificationURIComplete,
+		Interval:                time.Duration(b.Interval) * time.Second,
+	}
+	if b.ExpiresIn != 0 {
+		da.Expiry = timeNow().Add(time.Duration(b.ExpiresIn) * time.Second)
+	}
+	return da, nil
+}
+
+// WaitForDeviceToken polls the token endpoint until the user grants
+// access for da, then stores the issued Token in the Transport (and its
+// cache, if any) and returns it.
+//
+// Polling stops with ErrDeviceCodeExpired once da.Expiry passes, and
+// with ctx's error if ctx is cancelled first. A zero da.Interval means
+// the default interval of five seconds. Each slow_down response from the
+// server lengthens the interval by five seconds, up to one minute.
+// Any other error response, such as access_denied, ends polling with a
+// *RetrieveError.
+func (t *Transport) WaitForDeviceToken(ctx context.Context, da *DeviceAuth) (*Token, error) {
+	if t.Config == nil {
+		return nil, OAuthError{"WaitForDeviceToken", "no Config supplied"}
+	}
+	pollCtx := ctx
+	if !da.Expiry.IsZero() {
+		var cancel context.CancelFunc
+		pollCtx, cancel = context.WithDeadline(ctx, da.Expiry)
+		defer cancel()
+	}
+	interval := da.Interval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	for {
+		if pollWait(pollCtx, interval) != nil {
+			return nil, deviceWaitError(ctx, pollCtx)
+		}
+
+		tok := new(Token)
+		err := t.updateToken(pollCtx, tok, url.Values{
+			"grant_type":  {deviceGrantType},
+			"device_code": {da.DeviceCode},
+		})
+		if err == nil {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			prev := t.Token
+			t.Token = tok
+			return tok, t.cacheToken(prev, tok)
+		}
+		if pollCtx.Err() != nil {
+			return nil, deviceWaitError(ctx, pollCtx)
+		}
+		re, ok := err.(*RetrieveError)
+		if !ok {
+			return nil, err
+		}
+		switch re.ErrorCode {
+		case "authorization_pending":
+			if da.OnPending != nil {
+				da.OnPending()
+			}
+		case "slow_down":
+			interval += slowDownIncrement
+			if interval > maxPollInterval {
+				interval = maxPollInterval
+			}
+		case "expired_token":
+			return nil, ErrDeviceCodeExpired
+		default:
+			return nil, err
+		}
+	}
+}
+
+// slowDownIncrement is added to the poll interval each time the server
+// answers slow_down (RFC 8628 section 3.5), up to maxPollInterval.
+var (
+	slowDownIncrement = 5 * time.Second
+	maxPollInterval   = time.Minute
+)
+
+// pollWait waits for d to pass, or for ctx to be done, in which case it
+// returns ctx's error. It spaces device polls and token request retries;
+// tests replace it to observe the intervals.
+var pollWait = func(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// deviceWaitError returns the error that ends a poll whose context is done:
+// the caller's error if ctx itself is done, else ErrDeviceCodeExpired.
+func deviceWaitError(ctx, pollCtx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return ErrDeviceCodeExpired
+}
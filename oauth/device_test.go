@@ -0,0 +1,240 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newDeviceServer returns a server whose token endpoint answers
+// authorization_pending until pending polls have been made.
+func newDeviceServer(t *testing.T, pending int) *httptest.Server {
+	polls := 0
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/device":
+			if g, w := r.FormValue("client_id"), "cl13nt1d"; g != w {
+				t.Errorf("client_id = %q, want %q", g, w)
+			}
+			io.WriteString(w, `{
+				"device_code":"d3v1c3",
+				"user_code":"WDJB-MJHT",
+				"verification_uri":"https://example.net/device",
+				"expires_in":1800,
+				"interval":5
+			}`)
+		case "/token":
+			if g, w := r.FormValue("grant_type"), deviceGrantType; g != w {
+				t.Errorf("grant_type = %q, want %q", g, w)
+			}
+			if g, w := r.FormValue("device_code"), "d3v1c3"; g != w {
+				t.Errorf("device_code = %q, want %q", g, w)
+			}
+			if polls < pending {
+				polls++
+				w.WriteHeader(http.StatusBadRequest)
+				io.WriteString(w, `{"error":"authorization_pending"}`)
+				return
+			}
+			io.WriteString(w, `{"access_token":"token1","refresh_token":"refreshtoken1","expires_in":3600}`)
+		}
+	}))
+}
+
+func newDeviceTransport(server *httptest.Server) *Transport {
+	return &Transport{Config: &Config{
+		ClientId:  "cl13nt1d",
+		DeviceURL: server.URL + "/device",
+		TokenURL:  server.URL + "/token",
+	}}
+}
+
+func TestDeviceFlow(t *testing.T) {
+	server := newDeviceServer(t, 2)
+	defer server.Close()
+	transport := newDeviceTransport(server)
+
+	da, err := transport.DeviceAuth(context.Background())
+	if err != nil {
+		t.Fatalf("DeviceAuth: %v", err)
+	}
+	if g, w := da.UserCode, "WDJB-MJHT"; g != w {
+		t.Errorf("UserCode = %q, want %q", g, w)
+	}
+	if g, w := da.Interval, 5*time.Second; g != w {
+		t.Errorf("Interval = %v, want %v", g, w)
+	}
+	da.Interval = time.Millisecond
+	tok, err := transport.WaitForDeviceToken(context.Background(), da)
+	if err != nil {
+		t.Fatalf("WaitForDeviceToken: %v", err)
+	}
+	checkToken(t, tok, "token1", "refreshtoken1")
+	if transport.Token != tok {
+		t.Errorf("Transport.Token not set to the issued token")
+	}
+}
+
+func TestDeviceAuthResponse(t *testing.T) {
+	for _, tt := range []struct {
+		name, body, uri string
+	}{
+		{"verification_url", `{"device_code":"d3v1c3","user_code":"WDJB-MJHT","verification_url":"https://www.google.com/device"}`, "https://www.google.com/device"},
+		{"both", `{"device_code":"d3v1c3","user_code":"WDJB-MJHT","verification_uri":"https://example.net/device","verification_url":"https://example.net/old"}`, "https://example.net/device"},
+		{"no user_code", `{"device_code":"d3v1c3","verification_uri":"https://example.net/device"}`, ""},
+		{"no verification_uri", `{"device_code":"d3v1c3","user_code":"WDJB-MJHT"}`, ""},
+		{"malformed", `<html>`, ""},
+	} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, tt.body)
+		}))
+		da, err := newDeviceTransport(server).DeviceAuth(context.Background())
+		server.Close()
+		switch {
+		case tt.uri == "" && err == nil:
+			t.Errorf("%s: DeviceAuth succeeded, want an error", tt.name)
+		case tt.uri != "" && err != nil:
+			t.Errorf("%s: DeviceAuth: %v", tt.name, err)
+		case tt.uri != "" && da.VerificationURI != tt.uri:
+			t.Errorf("%s: VerificationURI = %q, want %q", tt.name, da.VerificationURI, tt.uri)
+		}
+	}
+}
+
+func TestDeviceAuthClientAuthentication(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		secret string
+		style  AuthStyle
+		want   string // "body", "header" or "public"
+	}{
+		{"public", "", AuthStyleInHeader, "public"},
+		{"params", "s3cr3t", AuthStyleInParams, "body"},
+		{"header", "s3cr3t", AuthStyleInHeader, "header"},
+	} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id, secret, basic := r.BasicAuth()
+			got := "public"
+			switch {
+			case basic && id == "cl13nt1d" && secret == "s3cr3t" && r.PostFormValue("client_id") == "":
+				got = "header"
+			case !basic && r.PostFormValue("client_id") == "cl13nt1d" && r.PostFormValue("client_secret") == "s3cr3t":
+				got = "body"
+			case basic || r.PostFormValue("client_id") != "cl13nt1d" || r.PostFormValue("client_secret") != "":
+				got = "malformed"
+			}
+			if got != tt.want {
+				t.Errorf("%s: client authenticated as %s, want %s", tt.name, got, tt.want)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"device_code":"d3v1c3","user_code":"WDJB-MJHT","verification_uri":"https://example.net/device"}`)
+		}))
+		transport := newDeviceTransport(server)
+		transport.ClientSecret = tt.secret
+		transport.AuthStyle = tt.style
+		if _, err := transport.DeviceAuth(context.Background()); err != nil {
+			t.Errorf("%s: DeviceAuth: %v", tt.name, err)
+		}
+		server.Close()
+	}
+}
+
+func TestDeviceFlowOnPending(t *testing.T) {
+	server := newDeviceServer(t, 3)
+	defer server.Close()
+	transport := newDeviceTransport(server)
+
+	da, err := transport.DeviceAuth(context.Background())
+	if err != nil {
+		t.Fatalf("DeviceAuth: %v", err)
+	}
+	da.Interval = time.Millisecond
+	pending := 0
+	da.OnPending = func() { pending++ }
+	tok, err := transport.WaitForDeviceToken(context.Background(), da)
+	if err != nil {
+		t.Fatalf("WaitForDeviceToken: %v", err)
+	}
+	checkToken(t, tok, "token1", "refreshtoken1")
+	if pending != 3 {
+		t.Errorf("OnPending called %d times, want 3", pending)
+	}
+}
+
+func TestDeviceFlowCancel(t *testing.T) {
+	server := newDeviceServer(t, 1<<30)
+	defer server.Close()
+	transport := newDeviceTransport(server)
+
+	da := &DeviceAuth{DeviceCode: "d3v1c3", Interval: time.Millisecond}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	start := time.Now()
+	if _, err := transport.WaitForDeviceToken(ctx, da); err != context.Canceled {
+		t.Errorf("WaitForDeviceToken error = %v, want %v", err, context.Canceled)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("WaitForDeviceToken returned after %v, want prompt return", d)
+	}
+}
+
+func TestDeviceFlowExpired(t *testing.T) {
+	server := newDeviceServer(t, 1<<30)
+	defer server.Close()
+	transport := newDeviceTransport(server)
+
+	da := &DeviceAuth{
+		DeviceCode: "d3v1c3",
+		Interval:   time.Millisecond,
+		Expiry:     time.Now().Add(20 * time.Millisecond),
+	}
+	if _, err := transport.WaitForDeviceToken(context.Background(), da); err != ErrDeviceCodeExpired {
+		t.Errorf("WaitForDeviceToken error = %v, want %v", err, ErrDeviceCodeExpired)
+	}
+}
+
+func TestDeviceFlowSlowDown(t *testing.T) {
+	responses := []string{`{"error":"slow_down"}`, `{"error":"slow_down"}`, `{"error":"authorization_pending"}`}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if len(responses) > 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, responses[0])
+			responses = responses[1:]
+			return
+		}
+		io.WriteString(w, `{"access_token":"token1","refresh_token":"refreshtoken1","expires_in":3600}`)
+	}))
+	defer server.Close()
+
+	var waits []time.Duration
+	defer func(f func(context.Context, time.Duration) error) { pollWait = f }(pollWait)
+	pollWait = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+
+	transport := newDeviceTransport(server)
+	if _, err := transport.WaitForDeviceToken(context.Background(), &DeviceAuth{DeviceCode: "d3v1c3", Interval: 5 * time.Second}); err != nil {
+		t.Fatalf("WaitForDeviceToken: %v", err)
+	}
+	want := []time.Duration{5 * time.Second, 10 * time.Second, 15 * time.Second, 15 * time.Second}
+	if len(waits) != len(want) {
+		t.Fatalf("waited %v, want %v", waits, want)
+	}
+	for i := range want {
+		if waits[i] != want[i] {
+			t.Errorf("waited %v, want %v", waits, want)
+			break
+		}
+	}
+}
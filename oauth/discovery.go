@@ -0,0 +1,151 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// providerMetadata holds the endpoints of an OpenID Connect discovery
+// document (OpenID Connect Discovery 1.0 section 3).
+type providerMetadata struct {
+	Issuer                      string   `json:"issuer"`
+	AuthorizationEndpoint       string   `json:"authorization_endpoint"`
+	TokenEndpoint               string   `json:"token_endpoint"`
+	DeviceAuthorizationEndpoint string   `json:"device_authorization_endpoint"`
+	JWKSURI                     string   `json:"jwks_uri"`
+	RevocationEndpoint          string   `json:"revocation_endpoint"`
+	IntrospectionEndpoint       string   `json:"introspection_endpoint"`
+	PAREndpoint                 string   `json:"pushed_authorization_request_endpoint"`
+	UserInfoEndpoint            string   `json:"userinfo_endpoint"`
+	RegistrationEndpoint        string   `json:"registration_endpoint"`
+	ScopesSupported             []string `json:"scopes_supported"`
+}
+
+// DiscoverEndpoints fetches the OpenID Connect discovery document of the
+// Config's Issuer and fills in those of AuthURL, TokenURL, DeviceURL,
+// JWKSURL, RevokeURL, IntrospectURL, PARURL, UserInfoURL,
+// RegistrationURL and ScopesSupported that are empty. Call it before
+// using the Config.
+//
+// Documents are cached for as long as their Cache-Control header
+// allows, or for DocumentTTL if it says nothing, and concurrent calls
+// for the same Issuer share a single request.
+func (c *Config) DiscoverEndpoints(ctx context.Context) error {
+	if c.Issuer == "" {
+		return OAuthError{"DiscoverEndpoints", "no Issuer configured"}
+	}
+	m, err := discoveryCache.metadata(ctx, c.endpointClient(), c.Issuer, c.documentTTL())
+	if err != nil {
+		return err
+	}
+	for _, f := range []struct {
+		field *string
+		value string
+	}{
+		{&c.AuthURL, m.AuthorizationEndpoint},
+		{&c.TokenURL, m.TokenEndpoint},
+		{&c.DeviceURL, m.DeviceAuthorizationEndpoint},
+		{&c.JWKSURL, m.JWKSURI},
+		{&c.RevokeURL, m.RevocationEndpoint},
+		{&c.IntrospectURL, m.IntrospectionEndpoint},
+		{&c.PARURL, m.PAREndpoint},
+		{&c.UserInfoURL, m.UserInfoEndpoint},
+		{&c.RegistrationURL, m.RegistrationEndpoint},
+	} {
+		if *f.field == "" {
+			*f.field = f.value
+		}
+	}
+	if c.ScopesSupported == nil {
+		c.ScopesSupported = m.ScopesSupported
+	}
+	return nil
+}
+
+// Discover returns a Config for the OpenID Connect provider issuer, with
+// the endpoints and supported scopes of its discovery document. Set the
+// client credentials, RedirectURL and Scope before using it.
+func Discover(ctx context.Context, issuer string) (*Config, error) {
+	c := &Config{Issuer: issuer}
+	if err := c.DiscoverEndpoints(ctx); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+type metadataEntry struct {
+	mu     sync.Mutex // Held while fetching.
+	m      *providerMetadata
+	expiry time.Time
+}
+
+// metadataCache caches discovery documents by issuer.
+type metadataCache struct {
+	mu      sync.Mutex
+	entries map[string]*metadataEntry
+}
+
+var discoveryCache = &metadataCache{entries: make(map[string]*metadataEntry)}
+
+// metadata returns the discovery document of issuer, fetching it with
+// client if it is not cached or has expired. A fetched document without a
+// Cache-Control max-age is cached for ttl.
+func (mc *metadataCache) metadata(ctx context.Context, client *http.Client, issuer string, ttl time.Duration) (*providerMetadata, error) {
+	mc.mu.Lock()
+	e := mc.entries[issuer]
+	if e == nil {
+		e = new(metadataEntry)
+		mc.entries[issuer] = e
+	}
+	mc.mu.Unlock()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.m == nil || !timeNow().Before(e.expiry) {
+		m, age, err := fetchMetadata(ctx, client, issuer)
+		if err != nil {
+			return nil, err
+		}
+		e.m, e.expiry = m, timeNow().Add(maxAge(age, ttl))
+	}
+	return e.m, nil
+}
+
+// fetchMetadata fetches the discovery document of issuer with client and
+// decodes it, returning it with the response header.
+func fetchMetadata(ctx context.Context, client *http.Client, issuer string) (*providerMetadata, http.Header, error) {
+	u := strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != 200 {
+		return nil, nil, OAuthError{"DiscoverEndpoints", r.Status}
+	}
+	body, err := readBody(r.Body, defaultMaxResponseBytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	m := new(providerMetadata)
+	if err := json.Unmarshal(body, m); err != nil {
+		return nil, nil, OAuthError{"DiscoverEndpoints", err.Error()}
+	}
+	if m.Issuer != issuer {
+		return nil, nil, OAuthError{"DiscoverEndpoints", "issuer " + strconv.Quote(m.Issuer) + " does not match " + strconv.Quote(issuer)}
+	}
+	return m, r.Header, nil
+}
@@ -0,0 +1,89 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDiscoverEndpoints(t *testing.T) {
+	var fetches int32
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/.well-known/openid-configuration" {
+			http.NotFound(w, r)
+			return
+		}
+		atomic.AddInt32(&fetches, 1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"issuer":%q,"authorization_endpoint":"%[1]s/auth","token_endpoint":"%[1]s/token","jwks_uri":"%[1]s/keys"}`, server.URL)
+	}))
+	defer server.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c := &Config{Issuer: server.URL, TokenURL: "https://override.example/token"}
+			if err := c.DiscoverEndpoints(context.Background()); err != nil {
+				t.Errorf("DiscoverEndpoints: %v", err)
+				return
+			}
+			if c.AuthURL != server.URL+"/auth" || c.JWKSURL != server.URL+"/keys" || c.TokenURL != "https://override.example/token" {
+				t.Errorf("DiscoverEndpoints filled in %+v", c)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Errorf("concurrent discovery made %d requests, want 1", n)
+	}
+
+	c := &Config{Issuer: server.URL}
+	if err := c.DiscoverEndpoints(context.Background()); err != nil {
+		t.Fatalf("DiscoverEndpoints: %v", err)
+	}
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Errorf("discovery within the TTL made a request")
+	}
+
+	c = &Config{Issuer: server.URL + "/other"}
+	if err := c.DiscoverEndpoints(context.Background()); err == nil {
+		t.Errorf("DiscoverEndpoints of an unknown issuer succeeded")
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"issuer":%q,"authorization_endpoint":"%[1]s/auth","token_endpoint":"%[1]s/token","revocation_endpoint":"%[1]s/revoke","introspection_endpoint":"%[1]s/introspect","userinfo_endpoint":"%[1]s/userinfo","jwks_uri":"%[1]s/keys","scopes_supported":["openid","email"]}`, server.URL)
+	}))
+	defer server.Close()
+
+	c, err := Discover(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("Discover: %v", err)
+	}
+	if c.Issuer != server.URL || c.AuthURL != server.URL+"/auth" || c.TokenURL != server.URL+"/token" ||
+		c.RevokeURL != server.URL+"/revoke" || c.IntrospectURL != server.URL+"/introspect" || c.JWKSURL != server.URL+"/keys" ||
+		c.UserInfoURL != server.URL+"/userinfo" {
+		t.Errorf("Discover = %+v", c)
+	}
+	if len(c.ScopesSupported) != 2 || c.ScopesSupported[1] != "email" {
+		t.Errorf("ScopesSupported = %q, want [openid email]", c.ScopesSupported)
+	}
+
+	if _, err := Discover(context.Background(), server.URL+"/other"); err == nil {
+		t.Errorf("Discover of a mismatched issuer succeeded")
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// dpopNonceHeader carries the nonces servers require in DPoP proofs
+// (RFC 9449 section 8).
+const dpopNonceHeader = "DPoP-Nonce"
+
+// NewDPoPKey returns a new P-256 key for the Config's DPoPKey. The
+// tokens issued while it is in use are bound to it, so it must be kept
+// for as long as they are.
+func NewDPoPKey() (*ecdsa.PrivateKey, error) {
+	return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+}
+
+// dpopProof returns a DPoP proof (RFC 9449 section 4.2) of a request
+// with method to u, signed with c's DPoPKey. If accessToken is not
+// empty, the proof is bound to it with the "ath" claim.
+func (t *Transport) dpopProof(c *Config, method string, u *url.URL, accessToken string) (string, error) {
+	jwk, err := publicJWK(c.DPoPKey.Public())
+	if err != nil {
+		return "", err
+	}
+	jti, err := randomString(c.rand(), 16)
+	if err != nil {
+		return "", err
+	}
+	htu := *u
+	htu.RawQuery, htu.Fragment, htu.User = "", "", nil
+	claims := map[string]interface{}{
+		"jti": jti,
+		"htm": method,
+		"htu": htu.String(),
+		"iat": timeNow().Unix(),
+	}
+	if nonce := t.dpopNonce(u.Host); nonce != "" {
+		claims["nonce"] = nonce
+	}
+	if accessToken != "" {
+		sum := sha256.Sum256([]byte(accessToken))
+		claims["ath"] = base64.RawURLEncoding.EncodeToString(sum[:])
+	}
+	return signJWTHeader(c.rand(), c.DPoPKey, map[string]interface{}{"typ": "dpop+jwt", "jwk": jwk}, claims)
+}
+
+// addDPoP attaches a DPoP proof of req, bound to accessToken if it is
+// not empty, if c has a DPoPKey. RoundTrip passes the Config it read
+// under the Transport's lock, as UpdateConfig may replace it.
+func (t *Transport) addDPoP(c *Config, req *http.Request, accessToken string) error {
+	if c.DPoPKey == nil {
+		return nil
+	}
+	proof, err := t.dpopProof(c, req.Method, req.URL, accessToken)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("DPoP", proof)
+	return nil
+}
+
+// dpopNonce returns the last nonce host sent for DPoP proofs.
+func (t *Transport) dpopNonce(host string) string {
+	t.dpopMu.Lock()
+	defer t.dpopMu.Unlock()
+	return t.dpopNonces[host]
+}
+
+// saveDPoPNonce records the nonce resp carries for DPoP proofs to req's
+// host, if c has a DPoPKey and resp has a nonce. It reports whether the
+// nonce is new, so that a request rejected for want of it is worth
+// retrying.
+func (t *Transport) saveDPoPNonce(c *Config, req *http.Request, resp *http.Response) bool {
+	nonce := resp.Header.Get(dpopNonceHeader)
+	if c.DPoPKey == nil || nonce == "" {
+		return false
+	}
+	t.dpopMu.Lock()
+	defer t.dpopMu.Unlock()
+	if t.dpopNonces[req.URL.Host] == nonce {
+		return false
+	}
+	if t.dpopNonces == nil {
+		t.dpopNonces = make(map[string]string)
+	}
+	t.dpopNonces[req.URL.Host] = nonce
+	return true
+}
+
+// wantsDPoPNonce reports whether resp rejects a resource request for
+// lack of a DPoP nonce (RFC 9449 section 9).
+func wantsDPoPNonce(resp *http.Response) bool {
+	if resp.StatusCode != http.StatusUnauthorized {
+		return false
+	}
+	for _, v := range resp.Header.Values("WWW-Authenticate") {
+		cs, err := ParseWWWAuthenticate(v)
+		if err != nil {
+			continue
+		}
+		for _, c := range cs {
+			if strings.EqualFold(c.Scheme, "DPoP") && c.ErrorCode == "use_dpop_nonce" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isDPoP reports whether tok is a DPoP-bound token.
+func isDPoP(tok *Token) bool {
+	return strings.EqualFold(tok.TokenType, "DPoP")
+}
+
+// publicJWK returns the JSON Web Key (RFC 7517) of an RSA or P-256
+// public key.
+func publicJWK(pub crypto.PublicKey) (map[string]string, error) {
+	b64 := base64.RawURLEncoding.EncodeToString
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return map[string]string{
+			"kty": "RSA",
+			"n":   b64(pub.N.Bytes()),
+			"e":   b64(big.NewInt(int64(pub.E)).Bytes()),
+		}, nil
+	case *ecdsa.PublicKey:
+		if pub.Curve != elliptic.P256() {
+			return nil, OAuthError{"publicJWK", "ECDSA key is not on P-256"}
+		}
+		x, y := make([]byte, 32), make([]byte, 32)
+		pub.X.FillBytes(x)
+		pub.Y.FillBytes(y)
+		return map[string]string{"kty": "EC", "crv": "P-256", "x": b64(x), "y": b64(y)}, nil
+	}
+	return nil, OAuthError{"publicJWK", "unsupported key type"}
+}
@@ -0,0 +1,155 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// verifyDPoP checks the DPoP proof of r, signed with the P-256 key in
+// its header, and returns its claims, or nil if it is malformed.
+func verifyDPoP(t *testing.T, r *http.Request) map[string]interface{} {
+	parts := strings.Split(r.Header.Get("DPoP"), ".")
+	if len(parts) != 3 {
+		t.Errorf("%s %s: malformed DPoP proof %q", r.Method, r.URL.Path, r.Header.Get("DPoP"))
+		return nil
+	}
+	var header struct {
+		Typ, Alg string
+		JWK      struct{ Kty, Crv, X, Y string }
+	}
+	var claims map[string]interface{}
+	h, _ := base64.RawURLEncoding.DecodeString(parts[0])
+	c, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	if err := json.Unmarshal(h, &header); err != nil {
+		t.Errorf("DPoP header: %v", err)
+		return nil
+	}
+	if err := json.Unmarshal(c, &claims); err != nil {
+		t.Errorf("DPoP claims: %v", err)
+		return nil
+	}
+	if header.Typ != "dpop+jwt" || header.Alg != "ES256" || header.JWK.Kty != "EC" || header.JWK.Crv != "P-256" {
+		t.Errorf("DPoP header = %s", h)
+	}
+	x, _ := base64.RawURLEncoding.DecodeString(header.JWK.X)
+	y, _ := base64.RawURLEncoding.DecodeString(header.JWK.Y)
+	pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if len(sig) != 64 || !ecdsa.Verify(pub, digest[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+		t.Errorf("DPoP proof signature does not verify")
+	}
+	if claims["htm"] != r.Method || claims["htu"] != "http://"+r.Host+r.URL.Path || claims["jti"] == "" {
+		t.Errorf("DPoP claims = %v for %s %s", claims, r.Method, r.URL)
+	}
+	return claims
+}
+
+func TestDPoP(t *testing.T) {
+	key, err := NewDPoPKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tokenRequests, apiRequests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims := verifyDPoP(t, r)
+		switch r.URL.Path {
+		case "/token":
+			tokenRequests++
+			if claims["nonce"] != "n1" {
+				w.Header().Set("DPoP-Nonce", "n1")
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				io.WriteString(w, `{"error":"use_dpop_nonce"}`)
+				return
+			}
+			if claims["ath"] != nil {
+				t.Errorf("token request proof has ath claim")
+			}
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"access_token":"t0k3n","token_type":"DPoP","expires_in":3600}`)
+		case "/api":
+			apiRequests++
+			sum := sha256.Sum256([]byte("t0k3n"))
+			if r.Header.Get("Authorization") != "DPoP t0k3n" || claims["ath"] != base64.RawURLEncoding.EncodeToString(sum[:]) {
+				t.Errorf("resource request Authorization = %q, ath = %v", r.Header.Get("Authorization"), claims["ath"])
+			}
+			if claims["nonce"] != "n2" {
+				w.Header().Set("DPoP-Nonce", "n2")
+				w.Header().Set("WWW-Authenticate", `DPoP error="use_dpop_nonce"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			io.WriteString(w, "ok")
+		}
+	}))
+	defer server.Close()
+
+	transport := &Transport{Config: &Config{
+		TokenURL:        server.URL + "/token",
+		DPoPKey:         key,
+		StrictTokenType: true,
+	}}
+	tok, err := transport.Exchange("c0d3")
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if tok.TokenType != "DPoP" || tokenRequests != 2 {
+		t.Errorf("Exchange: TokenType %q after %d token requests, want DPoP after 2", tok.TokenType, tokenRequests)
+	}
+
+	req, _ := http.NewRequest("GET", server.URL+"/api?q=1", nil)
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "ok" || apiRequests != 2 {
+		t.Errorf("RoundTrip = %s %q after %d requests, want 200 ok after 2", resp.Status, body, apiRequests)
+	}
+	if req.Header.Get("DPoP") != "" || req.Header.Get("Authorization") != "" {
+		t.Errorf("caller's request was modified")
+	}
+}
+
+func TestDPoPNonceOtherError(t *testing.T) {
+	key, err := NewDPoPKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tokenRequests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenRequests++
+		w.Header().Set("DPoP-Nonce", "n1")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error":"invalid_grant"}`)
+	}))
+	defer server.Close()
+
+	transport := &Transport{Config: &Config{TokenURL: server.URL, DPoPKey: key}}
+	_, err = transport.Exchange("c0d3")
+	var re *RetrieveError
+	if !errors.As(err, &re) || re.ErrorCode != "invalid_grant" {
+		t.Errorf("Exchange error = %v, want invalid_grant RetrieveError", err)
+	}
+	if tokenRequests != 1 {
+		t.Errorf("%d token requests, want 1", tokenRequests)
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"io/ioutil"
+	"strconv"
+)
+
+// ErrCacheAuthentication is returned by EncryptedCacheFile.Token when
+// the file cannot be decrypted, because it was written with another key
+// or has been modified.
+var ErrCacheAuthentication error = OAuthError{"EncryptedCacheFile.Token", "message authentication failed"}
+
+// Parameters of the key derivation for EncryptedCacheFile.Passphrase.
+const (
+	passphraseSaltSize   = 16
+	passphraseIterations = 600000
+)
+
+// EncryptedCacheFile implements Cache like CacheFile, but stores the
+// Token encrypted with AES-256-GCM so that refresh tokens are not kept
+// on disk in plaintext. The file holds a random nonce followed by the
+// sealed encoding of the Token, and is written as a CacheFile is.
+type EncryptedCacheFile struct {
+	File  CacheFile
+	Key   []byte     // 32 bytes
+	Codec TokenCodec // Encodes the Token before sealing; JSONCodec if nil.
+
+	// Passphrase, if Key is nil, is a passphrase to derive the key
+	// from with PBKDF2-HMAC-SHA256, for programs that ask their user
+	// for one. The file then starts with the random salt of the
+	// derivation, which is chosen anew on every write.
+	Passphrase string
+}
+
+func (f *EncryptedCacheFile) Token() (*Token, error) {
+	b, err := ioutil.ReadFile(string(f.File))
+	if err != nil {
+		return nil, OAuthError{"EncryptedCacheFile.Token", err.Error()}
+	}
+	var salt []byte
+	if f.usesPassphrase() {
+		if len(b) < passphraseSaltSize {
+			return nil, ErrCacheAuthentication
+		}
+		salt, b = b[:passphraseSaltSize], b[passphraseSaltSize:]
+	}
+	aead, err := f.aead("EncryptedCacheFile.Token", salt)
+	if err != nil {
+		return nil, err
+	}
+	n := aead.NonceSize()
+	if len(b) < n {
+		return nil, ErrCacheAuthentication
+	}
+	plain, err := aead.Open(nil, b[:n], b[n:], nil)
+	if err != nil {
+		return nil, ErrCacheAuthentication
+	}
+	tok, err := codec(f.Codec).Unmarshal(plain)
+	if err != nil {
+		return nil, OAuthError{"EncryptedCacheFile.Token", err.Error()}
+	}
+	return tok, nil
+}
+
+func (f *EncryptedCacheFile) PutToken(tok *Token) error {
+	var salt []byte
+	if f.usesPassphrase() {
+		salt = make([]byte, passphraseSaltSize)
+		if _, err := rand.Read(salt); err != nil {
+			return OAuthError{"EncryptedCacheFile.PutToken", err.Error()}
+		}
+	}
+	aead, err := f.aead("EncryptedCacheFile.PutToken", salt)
+	if err != nil {
+		return err
+	}
+	plain, err := codec(f.Codec).Marshal(tok)
+	if err != nil {
+		return OAuthError{"EncryptedCacheFile.PutToken", err.Error()}
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return OAuthError{"EncryptedCacheFile.PutToken", err.Error()}
+	}
+	out := append(salt, nonce...)
+	if err := writeFile(string(f.File), aead.Seal(out, nonce, plain, nil)); err != nil {
+		return OAuthError{"EncryptedCacheFile.PutToken", err.Error()}
+	}
+	return nil
+}
+
+// Clear removes the cache file.
+func (f *EncryptedCacheFile) Clear() error {
+	return f.File.Clear()
+}
+
+func (f *EncryptedCacheFile) usesPassphrase() bool {
+	return f.Key == nil && f.Passphrase != ""
+}
+
+// aead returns the cipher of the file's Key or, with a passphrase, of
+// the key derived from it with salt.
+func (f *EncryptedCacheFile) aead(prefix string, salt []byte) (cipher.AEAD, error) {
+	key := f.Key
+	if f.usesPassphrase() {
+		var err error
+		key, err = pbkdf2.Key(sha256.New, f.Passphrase, salt, passphraseIterations, 32)
+		if err != nil {
+			return nil, OAuthError{prefix, err.Error()}
+		}
+	}
+	if len(key) != 32 {
+		return nil, OAuthError{prefix, "key must be 32 bytes, not " + strconv.Itoa(len(key))}
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, OAuthError{prefix, err.Error()}
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,103 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newEncryptedCacheFile(t *testing.T) *EncryptedCacheFile {
+	dir, err := ioutil.TempDir("", "goauth2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return &EncryptedCacheFile{
+		File: CacheFile(filepath.Join(dir, "token")),
+		Key:  bytes.Repeat([]byte{7}, 32),
+	}
+}
+
+func TestEncryptedCacheFile(t *testing.T) {
+	f := newEncryptedCacheFile(t)
+	want := &Token{AccessToken: "token1", RefreshToken: "refreshtoken1", Expiry: time.Unix(1e9, 0)}
+	if err := f.PutToken(want); err != nil {
+		t.Fatalf("PutToken: %v", err)
+	}
+	b, err := ioutil.ReadFile(string(f.File))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(b, []byte("refreshtoken1")) {
+		t.Errorf("cache file contains the refresh token in plaintext")
+	}
+	got, err := f.Token()
+	if err != nil {
+		t.Fatalf("Token: %v", err)
+	}
+	if !got.Equal(want) {
+		t.Errorf("Token = %+v, want %+v", got, want)
+	}
+}
+
+func TestEncryptedCacheFileTampered(t *testing.T) {
+	f := newEncryptedCacheFile(t)
+	if err := f.PutToken(&Token{AccessToken: "token1"}); err != nil {
+		t.Fatalf("PutToken: %v", err)
+	}
+	b, err := ioutil.ReadFile(string(f.File))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b[len(b)-1] ^= 1
+	if err := ioutil.WriteFile(string(f.File), b, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if tok, err := f.Token(); err != ErrCacheAuthentication {
+		t.Errorf("tampered file: Token = %v, %v; want ErrCacheAuthentication", tok, err)
+	}
+
+	b[len(b)-1] ^= 1
+	ioutil.WriteFile(string(f.File), b, 0600)
+	f.Key = bytes.Repeat([]byte{8}, 32)
+	if tok, err := f.Token(); err != ErrCacheAuthentication {
+		t.Errorf("wrong key: Token = %v, %v; want ErrCacheAuthentication", tok, err)
+	}
+}
+
+func TestEncryptedCacheFilePassphrase(t *testing.T) {
+	f := newEncryptedCacheFile(t)
+	f.Key, f.Passphrase = nil, "correct horse battery staple"
+	if err := f.PutToken(&Token{AccessToken: "token1", RefreshToken: "refreshtoken1"}); err != nil {
+		t.Fatalf("PutToken: %v", err)
+	}
+	b, err := ioutil.ReadFile(string(f.File))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(b, []byte("refreshtoken1")) {
+		t.Errorf("cache file contains the refresh token in plaintext")
+	}
+
+	// A Transport loads the Token from the cache on first use.
+	transport := &Transport{Config: &Config{TokenCache: f}}
+	if _, err := transport.accessToken(&http.Request{}); err != nil {
+		t.Fatalf("accessToken: %v", err)
+	}
+	if transport.RefreshToken != "refreshtoken1" {
+		t.Errorf("loaded refresh token = %q, want refreshtoken1", transport.RefreshToken)
+	}
+
+	f.Passphrase = "wrong"
+	if tok, err := f.Token(); err != ErrCacheAuthentication {
+		t.Errorf("wrong passphrase: Token = %v, %v; want ErrCacheAuthentication", tok, err)
+	}
+}
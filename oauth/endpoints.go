@@ -0,0 +1,93 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import "strings"
+
+// An Endpoint is the set of endpoints of an OAuth provider, together
+// with how its token endpoint expects client credentials. Empty fields
+// are endpoints the provider does not have.
+type Endpoint struct {
+	AuthURL   string
+	TokenURL  string
+	DeviceURL string
+	RevokeURL string
+	Issuer    string // OpenID Connect issuer identifier, for VerifyIDToken.
+	JWKSURL   string
+	AuthStyle AuthStyle
+}
+
+// Endpoints of well-known providers. Responses with non-standard fields,
+// such as Facebook's "expires" in place of "expires_in" or GitHub's
+// form-encoded token responses, need no further configuration.
+var (
+	Google = Endpoint{
+		AuthURL:   "https://accounts.google.com/o/oauth2/auth",
+		TokenURL:  "https://oauth2.googleapis.com/token",
+		DeviceURL: "https://oauth2.googleapis.com/device/code",
+		RevokeURL: "https://oauth2.googleapis.com/revoke",
+		Issuer:    "https://accounts.google.com",
+		JWKSURL:   "https://www.googleapis.com/oauth2/v3/certs",
+	}
+	GitHub = Endpoint{
+		AuthURL:   "https://github.com/login/oauth/authorize",
+		TokenURL:  "https://github.com/login/oauth/access_token",
+		DeviceURL: "https://github.com/login/device/code",
+	}
+	GitLab = Endpoint{
+		AuthURL:   "https://gitlab.com/oauth/authorize",
+		TokenURL:  "https://gitlab.com/oauth/token",
+		DeviceURL: "https://gitlab.com/oauth/authorize_device",
+		RevokeURL: "https://gitlab.com/oauth/revoke",
+		Issuer:    "https://gitlab.com",
+		JWKSURL:   "https://gitlab.com/oauth/discovery/keys",
+	}
+	Facebook = Endpoint{
+		AuthURL:  "https://www.facebook.com/v3.2/dialog/oauth",
+		TokenURL: "https://graph.facebook.com/v3.2/oauth/access_token",
+	}
+	// Microsoft is the Microsoft identity platform endpoint for work,
+	// school and personal accounts. ID tokens from it carry the issuer
+	// of the user's tenant, so set Issuer to verify them.
+	Microsoft = Endpoint{
+		AuthURL:   "https://login.microsoftonline.com/common/oauth2/v2.0/authorize",
+		TokenURL:  "https://login.microsoftonline.com/common/oauth2/v2.0/token",
+		DeviceURL: "https://login.microsoftonline.com/common/oauth2/v2.0/devicecode",
+		JWKSURL:   "https://login.microsoftonline.com/common/discovery/v2.0/keys",
+	}
+	Slack = Endpoint{
+		AuthURL:   "https://slack.com/oauth/v2/authorize",
+		TokenURL:  "https://slack.com/api/oauth.v2.access",
+		AuthStyle: AuthStyleInHeader,
+	}
+)
+
+// Endpoints maps provider names, such as might appear in a
+// configuration file, to their Endpoints.
+var Endpoints = map[string]Endpoint{
+	"google":    Google,
+	"github":    GitHub,
+	"gitlab":    GitLab,
+	"facebook":  Facebook,
+	"microsoft": Microsoft,
+	"slack":     Slack,
+}
+
+// NewConfig returns a Config for a client of the provider with endpoints
+// e, requesting scopes.
+func NewConfig(e Endpoint, clientId, clientSecret string, scopes ...string) *Config {
+	return &Config{
+		ClientId:     clientId,
+		ClientSecret: clientSecret,
+		Scope:        strings.Join(scopes, " "),
+		AuthURL:      e.AuthURL,
+		TokenURL:     e.TokenURL,
+		DeviceURL:    e.DeviceURL,
+		RevokeURL:    e.RevokeURL,
+		Issuer:       e.Issuer,
+		JWKSURL:      e.JWKSURL,
+		AuthStyle:    e.AuthStyle,
+	}
+}
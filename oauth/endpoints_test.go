@@ -0,0 +1,34 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestNewConfig(t *testing.T) {
+	c := NewConfig(Slack, "cl13nt1d", "s3cr3t", "chat:write", "channels:read")
+	if c.ClientId != "cl13nt1d" || c.ClientSecret != "s3cr3t" || c.TokenURL != Slack.TokenURL || c.AuthStyle != AuthStyleInHeader {
+		t.Errorf("NewConfig = %+v", c)
+	}
+	if c.Scope != "chat:write channels:read" {
+		t.Errorf("Scope = %q, want space-separated scopes", c.Scope)
+	}
+
+	for name, e := range Endpoints {
+		for _, u := range []string{e.AuthURL, e.TokenURL, e.DeviceURL, e.RevokeURL, e.JWKSURL} {
+			if u == "" {
+				continue
+			}
+			if p, err := url.Parse(u); err != nil || p.Scheme != "https" {
+				t.Errorf("%s: endpoint %q is not an https URL", name, u)
+			}
+		}
+		if e.AuthURL == "" || e.TokenURL == "" {
+			t.Errorf("%s: missing authorization or token endpoint", name)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"context"
+	"crypto/subtle"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// AuthorizeInteractive runs the authorization code flow for a command
+// line tool (RFC 8252). It listens on a loopback address, on the
+// Config's LoopbackPort or else any free port, and calls openBrowser
+// with an authorization URL, using PKCE and a random state, that
+// redirects there. When the user's browser arrives with the code and
+// the same state, the code is exchanged for a Token, which is stored in
+// the TokenCache, if any, and returned. Requests to the listener with
+// any other state are answered with an error and otherwise ignored.
+//
+// The RedirectURL of the Config is ignored. If the user abandons the
+// flow, AuthorizeInteractive returns when ctx is done.
+func (c *Config) AuthorizeInteractive(ctx context.Context, openBrowser func(url string) error) (*Token, error) {
+	l, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(c.LoopbackPort)))
+	if err != nil {
+		return nil, OAuthError{"AuthorizeInteractive", err.Error()}
+	}
+	defer l.Close()
+
+	redirect := setParam{"redirect_uri", "http://" + l.Addr().String() + "/"}
+	authURL, verifier, state, err := c.BeginAuth(redirect)
+	if err != nil {
+		return nil, err
+	}
+
+	type result struct {
+		cb  *Callback
+		err error
+	}
+	results := make(chan result, 1)
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		cb, err := ParseCallback(r)
+		// Other local programs can reach the listener too. Only a
+		// response carrying the state sent ends the flow.
+		var returned string
+		if ae, ok := err.(*AuthorizationError); ok {
+			returned = ae.State
+		} else if err == nil {
+			returned = cb.State
+		}
+		if subtle.ConstantTimeCompare([]byte(returned), []byte(state)) != 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, "Unexpected authorization response.\n")
+			return
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, "Authorization failed. You may close this window.\n")
+		} else {
+			io.WriteString(w, "Authorization complete. You may close this window.\n")
+		}
+		select {
+		case results <- result{cb, err}:
+		default: // a result is already pending
+		}
+	})}
+	go srv.Serve(l)
+	defer srv.Close()
+
+	if err := openBrowser(authURL); err != nil {
+		return nil, err
+	}
+	var res result
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res = <-results:
+	}
+	if res.err != nil {
+		return nil, res.err
+	}
+	// The handler has checked the state already.
+	t := &Transport{Config: c}
+	return t.ExchangeContext(ctx, res.cb.Code, CodeVerifier(verifier), redirect)
+}
@@ -0,0 +1,126 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuthorizeInteractive(t *testing.T) {
+	var challenge, redirectURI string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if g := r.FormValue("redirect_uri"); g != redirectURI {
+			t.Errorf("token request redirect_uri = %q, want %q", g, redirectURI)
+		}
+		if r.FormValue("code") != "c0d3" || Verifier(r.FormValue("code_verifier")).Challenge() != challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"error":"invalid_grant"}`)
+			return
+		}
+		io.WriteString(w, `{"access_token":"token1","refresh_token":"refreshtoken1","expires_in":3600}`)
+	}))
+	defer server.Close()
+
+	config := &Config{ClientId: "cl13nt1d", AuthURL: "https://example.com/auth", TokenURL: server.URL, RedirectURL: "https://app.example/callback"}
+	// The fake browser signs the user in at once and follows the
+	// provider's redirect back to the loopback listener.
+	browser := func(authURL string) error {
+		u, err := url.Parse(authURL)
+		if err != nil {
+			return err
+		}
+		q := u.Query()
+		challenge, redirectURI = q.Get("code_challenge"), q.Get("redirect_uri")
+		if !strings.HasPrefix(redirectURI, "http://127.0.0.1:") {
+			t.Errorf("redirect_uri = %q, want the loopback listener", redirectURI)
+		}
+		go func() {
+			// A stray request from another program must not end
+			// the flow.
+			for _, stray := range []string{"?code=f0rg3d&state=wrong", "?error=access_denied", "?code=f0rg3d"} {
+				resp, err := http.Get(q.Get("redirect_uri") + stray)
+				if err != nil {
+					t.Errorf("stray request: %v", err)
+					return
+				}
+				resp.Body.Close()
+				if resp.StatusCode != http.StatusBadRequest {
+					t.Errorf("stray request %s: %s, want 400", stray, resp.Status)
+				}
+			}
+			resp, err := http.Get(q.Get("redirect_uri") + "?code=c0d3&state=" + url.QueryEscape(q.Get("state")))
+			if err != nil {
+				t.Errorf("redirect: %v", err)
+				return
+			}
+			resp.Body.Close()
+		}()
+		return nil
+	}
+	tok, err := config.AuthorizeInteractive(context.Background(), browser)
+	if err != nil {
+		t.Fatalf("AuthorizeInteractive: %v", err)
+	}
+	checkToken(t, tok, "token1", "refreshtoken1")
+	if config.RedirectURL != "https://app.example/callback" {
+		t.Errorf("RedirectURL changed to %q", config.RedirectURL)
+	}
+}
+
+func TestAuthorizeInteractiveCancel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	config := &Config{AuthURL: "https://example.com/auth"}
+	browser := func(string) error { return nil } // the user closes the window
+	if _, err := config.AuthorizeInteractive(ctx, browser); err != context.DeadlineExceeded {
+		t.Errorf("AuthorizeInteractive error = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestAuthorizeInteractiveCancelExchange(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The user gives up while the token request is in flight.
+		cancel()
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	config := &Config{AuthURL: "https://example.com/auth", TokenURL: server.URL}
+	browser := func(authURL string) error {
+		u, err := url.Parse(authURL)
+		if err != nil {
+			return err
+		}
+		q := u.Query()
+		go func() {
+			resp, err := http.Get(q.Get("redirect_uri") + "?code=c0d3&state=" + url.QueryEscape(q.Get("state")))
+			if err != nil {
+				t.Errorf("redirect: %v", err)
+				return
+			}
+			resp.Body.Close()
+		}()
+		return nil
+	}
+	if _, err := config.AuthorizeInteractive(ctx, browser); !errors.Is(err, context.Canceled) {
+		t.Errorf("AuthorizeInteractive error = %v, want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"time"
+)
+
+// Introspection is the response of a token introspection request
+// (RFC 7662 section 2.2). Only Active is always present.
+type Introspection struct {
+	Active    bool
+	Scope     string
+	ClientId  string
+	Username  string
+	TokenType string
+	Subject   string
+	Issuer    string
+	Expiry    time.Time // The "exp" claim; zero if absent.
+	IssuedAt  time.Time // The "iat" claim; zero if absent.
+	NotBefore time.Time // The "nbf" claim; zero if absent.
+
+	// Audience holds the "aud" claim, which servers send as a string
+	// or a list, and JWTID the "jti" claim.
+	Audience []string
+	JWTID    string
+
+	// Leeway is the clock skew tolerated by Expired and Valid when
+	// comparing Expiry and NotBefore to the local time. Introspect
+	// sets it to the Config's IntrospectionLeeway.
+	Leeway time.Duration
+
+	// raw holds every field of the response. See Extra.
+	raw map[string]interface{}
+}
+
+// Extra returns the value of a field of the introspection response, or
+// nil if the server did not return it.
+func (in *Introspection) Extra(key string) interface{} {
+	return in.raw[key]
+}
+
+// HasScope reports whether the token was granted every one of scopes.
+func (in *Introspection) HasScope(scopes ...string) bool {
+	return hasScopes(in.Scope, scopes)
+}
+
+// Expired reports whether the token's expiry, allowing for Leeway, has
+// passed.
+func (in *Introspection) Expired() bool {
+	return !in.Expiry.IsZero() && timeNow().After(in.Expiry.Add(in.Leeway))
+}
+
+// Valid reports whether the token is active, unexpired and, allowing
+// for Leeway, already usable.
+func (in *Introspection) Valid() bool {
+	if !in.Active || in.Expired() {
+		return false
+	}
+	return in.NotBefore.IsZero() || !timeNow().Add(in.Leeway).Before(in.NotBefore)
+}
+
+// Introspect asks the Config's IntrospectURL about token, as a resource
+// server validating a token presented to it does. The Config's client
+// credentials authenticate the request.
+func (t *Transport) Introspect(ctx context.Context, token string) (*Introspection, error) {
+	if t.Config == nil {
+		return nil, OAuthError{"Introspect", "no Config supplied"}
+	}
+	if t.IntrospectURL == "" {
+		return nil, OAuthError{"Introspect", "no IntrospectURL configured"}
+	}
+	c := t.config()
+	in, err := t.introspect(ctx, c, token)
+	t.audit(ctx, "introspect", c.ClientId, err)
+	return in, err
+}
+
+func (t *Transport) introspect(ctx context.Context, c *Config, token string) (*Introspection, error) {
+	v := url.Values{"token": {token}}
+	r, err := t.postForm(ctx, c, c.IntrospectURL, v, &clientAuth{c.endpointAuthStyle(), c.ClientId, c.ClientSecret})
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != 200 {
+		return nil, retrieveError(r)
+	}
+	body, err := readBody(r.Body, c.maxResponseBytes())
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, OAuthError{"Introspect", err.Error()}
+	}
+	in := NewIntrospection(raw)
+	in.Leeway = c.IntrospectionLeeway
+	return in, nil
+}
+
+// NewIntrospection returns the Introspection with the given fields, as
+// decoded from an introspection response or from the claims of a JWT
+// access token (RFC 9068). A JWT has no "active" field, so a validator
+// building an Introspection from one sets Active itself once it has
+// verified the JWT.
+func NewIntrospection(claims map[string]interface{}) *Introspection {
+	in := &Introspection{raw: claims}
+	in.Active, _ = claims["active"].(bool)
+	in.Scope, _ = claims["scope"].(string)
+	in.ClientId, _ = claims["client_id"].(string)
+	in.Username, _ = claims["username"].(string)
+	in.TokenType, _ = claims["token_type"].(string)
+	in.Subject, _ = claims["sub"].(string)
+	in.Issuer, _ = claims["iss"].(string)
+	in.JWTID, _ = claims["jti"].(string)
+	switch aud := claims["aud"].(type) {
+	case string:
+		in.Audience = []string{aud}
+	case []interface{}:
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				in.Audience = append(in.Audience, s)
+			}
+		}
+	}
+	in.Expiry = unixClaim(claims["exp"])
+	in.IssuedAt = unixClaim(claims["iat"])
+	in.NotBefore = unixClaim(claims["nbf"])
+	return in
+}
+
+// unixClaim returns the time of a NumericDate claim, or the zero time
+// if v is not a number.
+func unixClaim(v interface{}) time.Time {
+	n, ok := v.(float64)
+	if !ok {
+		return time.Time{}
+	}
+	return time.Unix(int64(n), 0)
+}
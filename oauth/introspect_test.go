@@ -0,0 +1,78 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIntrospect(t *testing.T) {
+	now := time.Unix(1e9, 0)
+	defer func(f func() time.Time) { timeNow = f }(timeNow)
+	timeNow = func() time.Time { return now }
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id, secret, _ := r.BasicAuth(); r.FormValue("client_id")+id != "cl13nt1d" || r.FormValue("client_secret")+secret != "s3cr3t" {
+			t.Errorf("request not authenticated as the client")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.FormValue("token") {
+		case "skewed":
+			// Expired 3 seconds ago by the local clock.
+			fmt.Fprintf(w, `{"active":true,"scope":"read","sub":"alice","aud":"https://api.example.com","jti":"j1","exp":%d}`, now.Unix()-3)
+		case "multi":
+			fmt.Fprint(w, `{"active":true,"scope":"read write","aud":["https://api.example.com","https://other.example.com"]}`)
+		default:
+			fmt.Fprint(w, `{"active":false}`)
+		}
+	}))
+	defer server.Close()
+
+	transport := &Transport{Config: &Config{
+		ClientId:            "cl13nt1d",
+		ClientSecret:        "s3cr3t",
+		IntrospectURL:       server.URL,
+		IntrospectionLeeway: 10 * time.Second,
+	}}
+	in, err := transport.Introspect(context.Background(), "skewed")
+	if err != nil {
+		t.Fatalf("Introspect: %v", err)
+	}
+	if !in.Active || in.Scope != "read" || in.Subject != "alice" || in.Extra("sub") != "alice" || in.JWTID != "j1" {
+		t.Errorf("Introspect = %+v", in)
+	}
+	if len(in.Audience) != 1 || in.Audience[0] != "https://api.example.com" {
+		t.Errorf("Audience = %q, want [https://api.example.com]", in.Audience)
+	}
+	if !in.HasScope("read") || in.HasScope("read", "write") {
+		t.Errorf("HasScope wrong for scope %q", in.Scope)
+	}
+	if in.Expired() || !in.Valid() {
+		t.Errorf("token 3s past exp with 10s leeway: Expired = %v, Valid = %v; want false, true", in.Expired(), in.Valid())
+	}
+	in.Leeway = 0
+	if !in.Expired() || in.Valid() {
+		t.Errorf("token 3s past exp without leeway: Expired = %v, Valid = %v; want true, false", in.Expired(), in.Valid())
+	}
+
+	if in, err = transport.Introspect(context.Background(), "multi"); err != nil {
+		t.Fatalf("Introspect: %v", err)
+	}
+	if len(in.Audience) != 2 || in.Audience[1] != "https://other.example.com" || !in.HasScope("write", "read") {
+		t.Errorf("Introspect = %+v, want two audiences and scopes read and write", in)
+	}
+
+	if in, err = transport.Introspect(context.Background(), "revoked"); err != nil {
+		t.Fatalf("Introspect: %v", err)
+	}
+	if in.Active || in.Valid() {
+		t.Errorf("inactive token reported valid")
+	}
+}
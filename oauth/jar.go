@@ -0,0 +1,128 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/url"
+	"time"
+)
+
+// requestObjectLifetime is how long a request object is valid.
+const requestObjectLifetime = 5 * time.Minute
+
+// RequestObjectURL is like AuthCodeURL, but sends the parameters of the
+// authorization request in a request object (RFC 9101): a JWT signed
+// with the Config's SigningKey, passed as the "request" parameter. Only
+// client_id is also sent in the clear. The request object is issued by
+// ClientId to the Config's Issuer, or if that is empty to its AuthURL,
+// and expires after five minutes.
+func (c *Config) RequestObjectURL(state string, opts ...AuthCodeOption) (string, error) {
+	if c.SigningKey == nil {
+		return "", OAuthError{"RequestObjectURL", "no SigningKey configured"}
+	}
+	if _, err := url.Parse(c.AuthURL); err != nil {
+		return "", OAuthError{"RequestObjectURL", "AuthURL malformed: " + err.Error()}
+	}
+	// A parameter given more than once, such as resource, becomes an
+	// array of its values.
+	claims := make(map[string]interface{})
+	for k, vs := range c.authParams(state, opts) {
+		var set []string
+		for _, v := range vs {
+			if v != "" {
+				set = append(set, v)
+			}
+		}
+		switch len(set) {
+		case 0:
+		case 1:
+			claims[k] = set[0]
+		default:
+			claims[k] = set
+		}
+	}
+	aud := c.Issuer
+	if aud == "" {
+		aud = c.AuthURL
+	}
+	now := timeNow()
+	claims["iss"] = c.ClientId
+	claims["aud"] = aud
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(requestObjectLifetime).Unix()
+	request, err := signJWT(c.rand(), c.SigningKey, c.SigningKeyID, "oauth-authz-req+jwt", claims)
+	if err != nil {
+		return "", err
+	}
+
+	return c.authorizeURL(url.Values{
+		"client_id": {c.ClientId},
+		"request":   {request},
+	}), nil
+}
+
+// signJWT returns the compact JWT of claims signed with key, using
+// randomness from r: RS256 for an RSA key and ES256 for a P-256 key.
+// typ is its "typ" header.
+func signJWT(r io.Reader, key crypto.Signer, kid, typ string, claims map[string]interface{}) (string, error) {
+	h := map[string]interface{}{"typ": typ}
+	if kid != "" {
+		h["kid"] = kid
+	}
+	return signJWTHeader(r, key, h, claims)
+}
+
+// signJWTHeader is like signJWT with the header fields h, to which it
+// adds "alg".
+func signJWTHeader(r io.Reader, key crypto.Signer, h map[string]interface{}, claims map[string]interface{}) (string, error) {
+	var alg string
+	switch pub := key.Public().(type) {
+	case *rsa.PublicKey:
+		alg = "RS256"
+	case *ecdsa.PublicKey:
+		if pub.Curve != elliptic.P256() {
+			return "", OAuthError{"signJWT", "ECDSA key is not on P-256"}
+		}
+		alg = "ES256"
+	default:
+		return "", OAuthError{"signJWT", "unsupported key type"}
+	}
+	h["alg"] = alg
+	header, err := json.Marshal(h)
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := key.Sign(r, digest[:], crypto.SHA256)
+	if err != nil {
+		return "", err
+	}
+	if alg == "ES256" {
+		// JWS wants the raw r || s, not the ASN.1 a crypto.Signer returns.
+		var rs struct{ R, S *big.Int }
+		if _, err := asn1.Unmarshal(sig, &rs); err != nil {
+			return "", OAuthError{"signJWT", "bad ECDSA signature: " + err.Error()}
+		}
+		sig = make([]byte, 64)
+		rs.R.FillBytes(sig[:32])
+		rs.S.FillBytes(sig[32:])
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
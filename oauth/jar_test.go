@@ -0,0 +1,93 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"crypto"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestObjectURL(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		key  crypto.Signer
+		pub  crypto.PublicKey
+		alg  string
+	}{
+		{"rsa", testRSAKey, &testRSAKey.PublicKey, "RS256"},
+		{"ec", testECKey, &testECKey.PublicKey, "ES256"},
+	} {
+		config := &Config{
+			ClientId:     "cl13nt1d",
+			Scope:        "openid profile",
+			AuthURL:      "https://example.com/auth",
+			Issuer:       "https://example.com",
+			RedirectURL:  "https://app.example/callback",
+			SigningKey:   tt.key,
+			SigningKeyID: "k1",
+			Resources:    []string{"https://api.example", "https://files.example"},
+		}
+		var log auditLog
+		var logged []string
+		config.AuditSink = &log
+		config.Logf = func(format string, args ...interface{}) { logged = append(logged, fmt.Sprintf(format, args...)) }
+		authURL, err := config.RequestObjectURL("st4t3", LoginHint("alice"))
+		if err != nil {
+			t.Fatalf("%s: RequestObjectURL: %v", tt.name, err)
+		}
+		if len(log) != 1 || log[0].Flow != "authorize" {
+			t.Errorf("%s: audit events = %+v, want one authorize event", tt.name, log)
+		}
+		if len(logged) != 1 || !strings.Contains(logged[0], "request=[redacted]") {
+			t.Errorf("%s: logged %q, want the request object redacted", tt.name, logged)
+		}
+		u, err := url.Parse(authURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		q := u.Query()
+		if q.Get("client_id") != "cl13nt1d" || q.Get("scope") != "" || q.Get("state") != "" {
+			t.Errorf("%s: authorization parameters sent in the clear: %s", tt.name, authURL)
+		}
+		header, claims, signed, sig, err := splitJWT(q.Get("request"))
+		if err != nil {
+			t.Fatalf("%s: request is not a JWT: %v", tt.name, err)
+		}
+		if header.Alg != tt.alg || header.Kid != "k1" {
+			t.Errorf("%s: header = %+v, want alg %s and kid k1", tt.name, header, tt.alg)
+		}
+		if err := verifySignature(header.Alg, tt.pub, signed, sig); err != nil {
+			t.Errorf("%s: signature: %v", tt.name, err)
+		}
+		for k, want := range map[string]string{
+			"iss":           "cl13nt1d",
+			"aud":           "https://example.com",
+			"client_id":     "cl13nt1d",
+			"response_type": "code",
+			"scope":         "openid profile",
+			"state":         "st4t3",
+			"redirect_uri":  "https://app.example/callback",
+			"login_hint":    "alice",
+		} {
+			if claims[k] != want {
+				t.Errorf("%s: claim %s = %v, want %q", tt.name, k, claims[k], want)
+			}
+		}
+		if g, w := fmt.Sprint(claims["resource"]), "[https://api.example https://files.example]"; g != w {
+			t.Errorf("%s: claim resource = %s, want %s", tt.name, g, w)
+		}
+		if exp, _ := claims["exp"].(float64); time.Unix(int64(exp), 0).Before(time.Now()) {
+			t.Errorf("%s: request object already expired", tt.name)
+		}
+	}
+
+	if _, err := (&Config{AuthURL: "https://example.com/auth"}).RequestObjectURL("st4t3"); err == nil {
+		t.Errorf("RequestObjectURL without a SigningKey succeeded")
+	}
+}
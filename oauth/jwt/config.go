@@ -0,0 +1,108 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jwt
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	"code.google.com/p/goauth2/oauth"
+)
+
+// Config describes a service account that obtains access tokens with
+// the JWT bearer grant (RFC 7523), as Google service accounts and many
+// enterprise identity providers do. Unlike Token, whose assertion can
+// only be used once, a Config signs a new assertion whenever it needs a
+// new access token.
+type Config struct {
+	Email      string   // Issuer of the assertion: the service account's client email.
+	PrivateKey []byte   // PEM encoding of the RSA private key that signs the assertion.
+	Scopes     []string // Scopes requested in the assertion.
+
+	// TokenURL is the token endpoint. It defaults to Google's.
+	TokenURL string
+
+	// Audience is the "aud" claim of the assertion. It defaults to
+	// TokenURL.
+	Audience string
+
+	// Subject, if set, is the user the service account requests
+	// delegated access for.
+	Subject string
+
+	// Client makes the token requests. It defaults to
+	// http.DefaultClient.
+	Client *http.Client
+}
+
+// Token signs a new assertion and exchanges it for an access token.
+func (c *Config) Token() (*oauth.Token, error) {
+	tokenURL := c.TokenURL
+	if tokenURL == "" {
+		tokenURL = stdAud
+	}
+	aud := c.Audience
+	if aud == "" {
+		aud = tokenURL
+	}
+	t := &Token{
+		ClaimSet: &ClaimSet{
+			Iss:   c.Email,
+			Scope: strings.Join(c.Scopes, " "),
+			Aud:   aud,
+			Prn:   c.Subject,
+		},
+		Key: c.PrivateKey,
+	}
+	_, v, err := t.buildRequest()
+	if err != nil {
+		return nil, err
+	}
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.PostForm(tokenURL, v)
+	if err != nil {
+		return nil, err
+	}
+	return handleResponse(resp)
+}
+
+// TokenSource returns an oauth.TokenSource that returns the same
+// access token until it expires, and then signs a new assertion to
+// obtain another.
+func (c *Config) TokenSource() oauth.TokenSource {
+	return &configSource{c: c}
+}
+
+// Transport returns an http.RoundTripper that authorizes requests with
+// access tokens from the Config's TokenSource and sends them through
+// base, or http.DefaultTransport if base is nil.
+func (c *Config) Transport(base http.RoundTripper) http.RoundTripper {
+	return oauth.WrapRoundTripper(base, c.TokenSource())
+}
+
+type configSource struct {
+	c *Config
+
+	mu  sync.Mutex
+	tok *oauth.Token
+}
+
+func (s *configSource) Token() (*oauth.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tok == nil || s.tok.Expired() {
+		tok, err := s.c.Token()
+		if err != nil {
+			return nil, err
+		}
+		s.tok = tok
+	}
+	tok := *s.tok
+	return &tok, nil
+}
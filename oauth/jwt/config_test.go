@@ -0,0 +1,95 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jwt
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"code.google.com/p/goauth2/oauth"
+)
+
+func TestConfig(t *testing.T) {
+	key := &Token{Key: privateKeyPemBytes}
+	if err := key.parsePrivateKey(); err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api" {
+			fmt.Fprint(w, r.Header.Get("Authorization"))
+			return
+		}
+		n++
+		if g := r.FormValue("grant_type"); g != stdGrantType {
+			t.Errorf("grant_type = %q, want %q", g, stdGrantType)
+		}
+		parts := strings.Split(r.FormValue("assertion"), ".")
+		if len(parts) != 3 {
+			t.Fatalf("assertion is not a JWT: %q", r.FormValue("assertion"))
+		}
+		sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		h := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		if err := rsa.VerifyPKCS1v15(&key.pKey.PublicKey, crypto.SHA256, h[:], sig); err != nil {
+			t.Errorf("assertion signature: %v", err)
+		}
+		b, _ := base64.RawURLEncoding.DecodeString(parts[1])
+		var claims map[string]interface{}
+		if err := json.Unmarshal(b, &claims); err != nil {
+			t.Fatalf("assertion claims: %v", err)
+		}
+		if claims["iss"] != iss || claims["scope"] != "read write" || claims["aud"] != "https://idp.example.com" || claims["prn"] != "user@example.com" {
+			t.Errorf("assertion claims = %v", claims)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"token%d","token_type":"Bearer","expires_in":3600}`, n)
+	}))
+	defer server.Close()
+
+	c := &Config{
+		Email:      iss,
+		PrivateKey: privateKeyPemBytes,
+		Scopes:     []string{"read", "write"},
+		TokenURL:   server.URL + "/token",
+		Audience:   "https://idp.example.com",
+		Subject:    "user@example.com",
+	}
+	src := c.TokenSource()
+	client := &http.Client{Transport: oauth.WrapRoundTripper(nil, src)}
+	get := func() string {
+		resp, err := client.Get(server.URL + "/api")
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		defer resp.Body.Close()
+		var scheme, tok string
+		fmt.Fscan(resp.Body, &scheme, &tok)
+		return tok
+	}
+	if g := get(); g != "token1" {
+		t.Errorf("first request sent %q, want token1", g)
+	}
+	if g := get(); g != "token1" || n != 1 {
+		t.Errorf("second request sent %q after %d token requests, want token1 after 1", g, n)
+	}
+	src.(*configSource).tok.Expiry = time.Now().Add(-time.Minute)
+	if g := get(); g != "token2" {
+		t.Errorf("request after expiry sent %q, want token2", g)
+	}
+
+	client.Transport = c.Transport(nil)
+	if g := get(); g != "token3" {
+		t.Errorf("request through Transport sent %q, want token3", g)
+	}
+}
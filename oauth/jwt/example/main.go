@@ -40,7 +40,7 @@ func main() {
 
 	if *secretsFile == "" || *pemFile == "" {
 		flag.Usage()
-		fmt.Println(usageMsg)
+		fmt.Print(usageMsg)
 		return
 	}
 
@@ -0,0 +1,95 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"net/http"
+	"sync"
+)
+
+// A TokenStore stores the Tokens of many users, keyed by an identifier
+// chosen by the caller, such as a user ID. MultiCache and SQLStore are
+// TokenStores.
+//
+// A TokenStore shared between processes should also have a method
+//
+//	SwapToken(key string, old, tok *Token) error
+//
+// that works like the SwapToken of a SwapCache. SQLStore has one.
+type TokenStore interface {
+	Token(key string) (*Token, error)
+	PutToken(key string, tok *Token) error
+	DeleteToken(key string) error
+}
+
+// A TokenManager holds the Tokens of many users of one Config, as a web
+// application acting for its users does. Each user's Token is kept in
+// Store under the user's key and used through a Transport of its own,
+// which loads it on first use and refreshes it when needed; refreshes
+// for one key are serialized, so concurrent requests for a user share
+// one. A TokenManager is safe for concurrent use.
+type TokenManager struct {
+	Config *Config
+	Store  TokenStore
+
+	mu         sync.Mutex
+	transports map[string]*Transport
+}
+
+// NewTokenManager returns a TokenManager for the users of c, whose
+// Tokens are kept in store.
+func NewTokenManager(c *Config, store TokenStore) *TokenManager {
+	return &TokenManager{Config: c, Store: store}
+}
+
+// Transport returns the Transport for the user key. Use its Exchange to
+// obtain the user's first Token; later Tokens are written to the Store.
+func (m *TokenManager) Transport(key string) *Transport {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if t, ok := m.transports[key]; ok {
+		return t
+	}
+	if m.transports == nil {
+		m.transports = make(map[string]*Transport)
+	}
+	t := &Transport{Config: m.Config, Cache: storeCache{m.Store, key}}
+	m.transports[key] = t
+	return t
+}
+
+// Client returns an *http.Client that makes requests as the user key.
+func (m *TokenManager) Client(key string) *http.Client {
+	return m.Transport(key).Client()
+}
+
+// Forget drops the Transport of the user key from memory, keeping the
+// user's Token in the Store; the next use loads it again. Call it when
+// a user's session ends.
+func (m *TokenManager) Forget(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.transports, key)
+}
+
+// storeCache is the Cache of one TokenStore key. It is a SwapCache,
+// which falls back to PutToken for stores without a SwapToken method.
+type storeCache struct {
+	store TokenStore
+	key   string
+}
+
+func (c storeCache) Token() (*Token, error)    { return c.store.Token(c.key) }
+func (c storeCache) PutToken(tok *Token) error { return c.store.PutToken(c.key, tok) }
+func (c storeCache) Clear() error              { return c.store.DeleteToken(c.key) }
+
+func (c storeCache) SwapToken(old, tok *Token) error {
+	if s, ok := c.store.(interface {
+		SwapToken(key string, old, tok *Token) error
+	}); ok {
+		return s.SwapToken(c.key, old, tok)
+	}
+	return c.store.PutToken(c.key, tok)
+}
@@ -0,0 +1,81 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTokenManager(t *testing.T) {
+	var refreshes atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			refreshes.Add(1)
+			time.Sleep(10 * time.Millisecond)
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"access_token":"%s-n3w","expires_in":3600}`, r.FormValue("refresh_token"))
+		case "/me":
+			io.WriteString(w, r.Header.Get("Authorization"))
+		}
+	}))
+	defer server.Close()
+
+	store := &MultiCache{File: filepath.Join(t.TempDir(), "tokens.json")}
+	for _, user := range []string{"alice", "bob"} {
+		if err := store.PutToken(user, &Token{RefreshToken: user}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := NewTokenManager(&Config{TokenURL: server.URL + "/token"}, store)
+	if m.Transport("alice") != m.Transport("alice") || m.Transport("alice") == m.Transport("bob") {
+		t.Errorf("Transport does not return one Transport per key")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		user := []string{"alice", "bob"}[i%2]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := m.Client(user).Get(server.URL + "/me")
+			if err != nil {
+				t.Errorf("Get: %v", err)
+				return
+			}
+			body, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			if want := "Bearer " + user + "-n3w"; string(body) != want {
+				t.Errorf("%s: Authorization = %q, want %q", user, body, want)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := refreshes.Load(); n != 2 {
+		t.Errorf("made %d refreshes, want one per user", n)
+	}
+	if tok, err := store.Token("bob"); err != nil || tok.AccessToken != "bob-n3w" {
+		t.Errorf("stored token for bob = %v, %v; want bob-n3w", tok, err)
+	}
+
+	m.Forget("bob")
+	resp, err := m.Client("bob").Get(server.URL + "/me")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	resp.Body.Close()
+	if n := refreshes.Load(); n != 2 {
+		t.Errorf("forgotten user's stored token was not reused")
+	}
+}
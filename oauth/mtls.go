@@ -0,0 +1,64 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"strings"
+)
+
+// ErrCertificateMismatch is returned by VerifyCertificate when a token
+// is bound to a different certificate.
+var ErrCertificateMismatch error = OAuthError{"VerifyCertificate", "token is bound to another certificate"}
+
+// CertificateThumbprint returns the "x5t#S256" confirmation claim of a
+// certificate-bound access token (RFC 8705 section 3.1): the base64url
+// SHA-256 thumbprint of the client certificate the token is bound to.
+// It is read from the "cnf" field of the token response or, failing
+// that, from the claims of a JWT access token. It returns "" if the
+// token is not certificate-bound.
+func (t *Token) CertificateThumbprint() string {
+	if cnf, ok := t.Extra("cnf").(map[string]interface{}); ok {
+		if x5t, ok := cnf["x5t#S256"].(string); ok {
+			return x5t
+		}
+	}
+	if !isJWT(t.AccessToken) {
+		return ""
+	}
+	var claims struct {
+		Cnf struct {
+			X5t string `json:"x5t#S256"`
+		} `json:"cnf"`
+	}
+	if decodeSegment(strings.Split(t.AccessToken, ".")[1], &claims) != nil {
+		return ""
+	}
+	return claims.Cnf.X5t
+}
+
+// CertificateThumbprint returns the x5t#S256 thumbprint of cert.
+func CertificateThumbprint(cert *x509.Certificate) string {
+	h := sha256.Sum256(cert.Raw)
+	return base64.RawURLEncoding.EncodeToString(h[:])
+}
+
+// VerifyCertificate checks that the token, if certificate-bound, is
+// bound to cert, and returns ErrCertificateMismatch if it is not. Use
+// it before sending the token over a TLS connection authenticated with
+// cert. A token that is not certificate-bound passes.
+func (t *Token) VerifyCertificate(cert *x509.Certificate) error {
+	x5t := t.CertificateThumbprint()
+	if x5t == "" {
+		return nil
+	}
+	if subtle.ConstantTimeCompare([]byte(x5t), []byte(CertificateThumbprint(cert))) != 1 {
+		return ErrCertificateMismatch
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestCertificate(t *testing.T, name string) *x509.Certificate {
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, testECKey.Public(), testECKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestVerifyCertificate(t *testing.T) {
+	mine := newTestCertificate(t, "mine")
+	other := newTestCertificate(t, "other")
+
+	// Bound through the token response.
+	tok := (&Token{AccessToken: "opaque"}).WithExtra(map[string]interface{}{
+		"cnf": map[string]interface{}{"x5t#S256": CertificateThumbprint(mine)},
+	})
+	if err := tok.VerifyCertificate(mine); err != nil {
+		t.Errorf("matching certificate: %v", err)
+	}
+	if err := tok.VerifyCertificate(other); err != ErrCertificateMismatch {
+		t.Errorf("mismatching certificate: err = %v, want ErrCertificateMismatch", err)
+	}
+
+	// Bound through the claims of a JWT access token.
+	tok = &Token{AccessToken: signTestJWT(t, testRSAKey, "rsa1", map[string]interface{}{
+		"cnf": map[string]string{"x5t#S256": CertificateThumbprint(other)},
+	})}
+	if g, w := tok.CertificateThumbprint(), CertificateThumbprint(other); g != w {
+		t.Errorf("CertificateThumbprint = %q, want %q", g, w)
+	}
+	if err := tok.VerifyCertificate(mine); err != ErrCertificateMismatch {
+		t.Errorf("mismatching certificate: err = %v, want ErrCertificateMismatch", err)
+	}
+
+	if err := (&Token{AccessToken: "opaque"}).VerifyCertificate(mine); err != nil {
+		t.Errorf("unbound token: %v", err)
+	}
+}
+
+func TestClientCertificate(t *testing.T) {
+	x509Cert := newTestCertificate(t, "client")
+	cert := &tls.Certificate{Certificate: [][]byte{x509Cert.Raw}, PrivateKey: testECKey}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) != 1 || !r.TLS.PeerCertificates[0].Equal(x509Cert) {
+			t.Errorf("%s: client certificate not presented", r.URL.Path)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/token":
+			if r.FormValue("client_id") != "cl13nt1d" || r.FormValue("client_secret") != "" {
+				t.Errorf("token request form = %v, want client_id alone", r.Form)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"access_token":"t0k3n","expires_in":3600,"cnf":{"x5t#S256":%q}}`, CertificateThumbprint(r.TLS.PeerCertificates[0]))
+		case "/api":
+			io.WriteString(w, "ok")
+		}
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+
+	transport := &Transport{Config: &Config{
+		ClientId:          "cl13nt1d",
+		TokenURL:          server.URL + "/token",
+		AuthStyle:         AuthStyleTLSClientAuth,
+		TLSConfig:         &tls.Config{RootCAs: roots},
+		ClientCertificate: cert,
+	}}
+	tok, err := transport.Exchange("c0d3")
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if err := tok.VerifyCertificate(x509Cert); err != nil || tok.CertificateThumbprint() == "" {
+		t.Errorf("token not bound to the client certificate: %v", err)
+	}
+	resp, err := transport.Client().Get(server.URL + "/api")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	checkBody(t, resp, "ok")
+}
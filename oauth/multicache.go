@@ -0,0 +1,128 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// MultiCache stores the Tokens of several accounts in a single JSON
+// file, keyed by an account identifier chosen by the caller. Use
+// Account to get a Cache for one account, as the Cache of a Transport.
+type MultiCache struct {
+	File string
+
+	mu sync.Mutex // serializes reading and rewriting File
+}
+
+// Accounts returns the identifiers of the accounts with a stored Token,
+// in sorted order.
+func (m *MultiCache) Accounts() ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	toks, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+	accounts := make([]string, 0, len(toks))
+	for a := range toks {
+		accounts = append(accounts, a)
+	}
+	sort.Strings(accounts)
+	return accounts, nil
+}
+
+// Token returns the Token stored for account.
+func (m *MultiCache) Token(account string) (*Token, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	toks, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+	tok := toks[account]
+	if tok == nil {
+		return nil, OAuthError{"MultiCache.Token", "no token for account " + strconv.Quote(account)}
+	}
+	return tok, nil
+}
+
+// PutToken stores tok for account, replacing any Token it had.
+func (m *MultiCache) PutToken(account string, tok *Token) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	toks, err := m.load()
+	if err != nil {
+		return err
+	}
+	toks[account] = tok
+	return m.save(toks)
+}
+
+// DeleteToken removes the Token stored for account, if any.
+func (m *MultiCache) DeleteToken(account string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	toks, err := m.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := toks[account]; !ok {
+		return nil
+	}
+	delete(toks, account)
+	return m.save(toks)
+}
+
+// Account returns a Cache holding the Token of account. Clearing it
+// deletes the account's Token.
+func (m *MultiCache) Account(account string) ClearableCache {
+	return accountCache{m, account}
+}
+
+// load reads the stored Tokens. A missing file holds none.
+func (m *MultiCache) load() (map[string]*Token, error) {
+	b, err := ioutil.ReadFile(m.File)
+	if os.IsNotExist(err) {
+		return make(map[string]*Token), nil
+	}
+	if err != nil {
+		return nil, OAuthError{"MultiCache", err.Error()}
+	}
+	var toks map[string]*Token
+	if err := json.Unmarshal(b, &toks); err != nil {
+		return nil, OAuthError{"MultiCache", err.Error()}
+	}
+	if toks == nil {
+		toks = make(map[string]*Token)
+	}
+	return toks, nil
+}
+
+func (m *MultiCache) save(toks map[string]*Token) error {
+	b, err := json.Marshal(toks)
+	if err != nil {
+		return OAuthError{"MultiCache", err.Error()}
+	}
+	if err := writeFile(m.File, b); err != nil {
+		return OAuthError{"MultiCache", err.Error()}
+	}
+	return nil
+}
+
+// accountCache is the Cache of one MultiCache account.
+type accountCache struct {
+	m       *MultiCache
+	account string
+}
+
+func (c accountCache) Token() (*Token, error)    { return c.m.Token(c.account) }
+func (c accountCache) PutToken(tok *Token) error { return c.m.PutToken(c.account, tok) }
+func (c accountCache) Clear() error              { return c.m.DeleteToken(c.account) }
@@ -0,0 +1,57 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMultiCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goauth2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	m := &MultiCache{File: filepath.Join(dir, "tokens.json")}
+
+	if accounts, err := m.Accounts(); err != nil || len(accounts) != 0 {
+		t.Fatalf("empty cache: Accounts = %q, %v", accounts, err)
+	}
+	if err := m.PutToken("bob@example.com", &Token{AccessToken: "bobtoken"}); err != nil {
+		t.Fatalf("PutToken: %v", err)
+	}
+	if err := m.Account("alice@example.com").PutToken(&Token{AccessToken: "alicetoken"}); err != nil {
+		t.Fatalf("PutToken: %v", err)
+	}
+	accounts, err := m.Accounts()
+	if err != nil {
+		t.Fatalf("Accounts: %v", err)
+	}
+	if g, w := strings.Join(accounts, ","), "alice@example.com,bob@example.com"; g != w {
+		t.Errorf("Accounts = %s, want %s", g, w)
+	}
+	tok, err := m.Token("bob@example.com")
+	if err != nil || tok.AccessToken != "bobtoken" {
+		t.Errorf("Token(bob) = %v, %v; want bobtoken", tok, err)
+	}
+
+	transport := &Transport{Config: &Config{}, Cache: m.Account("alice@example.com")}
+	if err := transport.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, err := m.Token("alice@example.com"); err == nil {
+		t.Errorf("alice's token survived Close")
+	}
+	if err := m.DeleteToken("bob@example.com"); err != nil {
+		t.Fatalf("DeleteToken: %v", err)
+	}
+	if accounts, err := m.Accounts(); err != nil || len(accounts) != 0 {
+		t.Errorf("after deletes: Accounts = %q, %v", accounts, err)
+	}
+}
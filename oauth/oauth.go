@@ -34,16 +34,29 @@
 //		// ...
 //		// btw, r.FormValue("state") == "foo"
 //	}
-//
 package oauth
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto"
+	"crypto/tls"
+	"encoding/base64"
 	"encoding/json"
+	"io"
 	"io/ioutil"
+	"math"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -56,48 +69,215 @@ func (oe OAuthError) Error() string {
 	return "OAuthError: " + oe.prefix + ": " + oe.msg
 }
 
+// ErrMissingAccessToken is returned when the token endpoint responds
+// successfully but without an access_token.
+var ErrMissingAccessToken error = OAuthError{"updateToken", "server response missing access_token"}
+
+// ErrTokenEndpointUnavailable is returned by Refresh, without contacting
+// the server, while the circuit breaker configured by the Config's
+// BreakerThreshold is open.
+var ErrTokenEndpointUnavailable error = OAuthError{"Refresh", "token endpoint unavailable (circuit breaker open)"}
+
+// ErrAuthorizationCodeExpired matches, with errors.Is, the error
+// Exchange returns when the server rejects the authorization code with
+// invalid_grant: it has expired, typically because the user took too
+// long, or was already used. The user should be asked to sign in again.
+// The error also unwraps to the server's *RetrieveError.
+var ErrAuthorizationCodeExpired error = OAuthError{"Exchange", "authorization code expired or invalid"}
+
+// ErrRefreshTooSoon is returned by RoundTrip when the Transport has no
+// access token and its last refresh was less than the Config's
+// MinRefreshInterval ago.
+var ErrRefreshTooSoon error = OAuthError{"RoundTrip", "refresh attempted within MinRefreshInterval"}
+
+// ErrResponseTooLarge is returned when a token response body exceeds the
+// Config's MaxResponseBytes.
+var ErrResponseTooLarge error = OAuthError{"updateToken", "token response too large"}
+
+// ErrNoToken is returned by RoundTrip, before any request is made, when
+// the Transport has no Token and no cache to load one from, or its Token
+// holds neither an access token nor a refresh token.
+var ErrNoToken error = OAuthError{"RoundTrip", "no Token supplied"}
+
+// ErrInsufficientScope is returned when the token endpoint grants a
+// scope that lacks one of the Config's RequiredScopes.
+var ErrInsufficientScope error = OAuthError{"updateToken", "granted scope lacks a required scope"}
+
+// ErrUnsupportedTokenType is returned by RoundTrip, for a Config with
+// StrictTokenType set, when the Token's TokenType is not Bearer.
+var ErrUnsupportedTokenType error = OAuthError{"RoundTrip", "unsupported token type"}
+
+// timeNow is time.Now, replaceable by tests.
+var timeNow = time.Now
+
 // Cache specifies the methods that implement a Token cache.
 type Cache interface {
 	Token() (*Token, error)
 	PutToken(*Token) error
 }
 
+// A ClearableCache is a Cache that can discard its stored Token.
+// Transport.Close clears caches that implement it.
+type ClearableCache interface {
+	Cache
+	Clear() error
+}
+
+// A SwapCache is a Cache shared between processes that can replace its
+// Token only if no other process has done so first, as when servers
+// rotate refresh tokens on every refresh. A Transport stores a Token it
+// has refreshed with SwapToken, and if that fails with ErrTokenConflict
+// it adopts the stored Token instead, so that all processes go on with
+// the same refresh token.
+type SwapCache interface {
+	Cache
+
+	// SwapToken stores tok if the stored Token's refresh token is that
+	// of old, and otherwise returns ErrTokenConflict.
+	SwapToken(old, tok *Token) error
+}
+
+// ErrTokenConflict is returned by SwapToken when the stored Token has
+// changed.
+var ErrTokenConflict error = OAuthError{"SwapToken", "stored token was changed by another process"}
+
 // CacheFile implements Cache. Its value is the name of the file in which
-// the Token is stored in JSON format.
+// the Token is stored in JSON format. The file is written with mode
+// 0600, since it holds the refresh token, and replaced whole, so that a
+// crash while writing leaves the previous Token in place.
 type CacheFile string
 
 func (f CacheFile) Token() (*Token, error) {
-	file, err := os.Open(string(f))
+	b, err := ioutil.ReadFile(string(f))
 	if err != nil {
 		return nil, OAuthError{"CacheFile.Token", err.Error()}
 	}
-	tok := &Token{}
-	dec := json.NewDecoder(file)
-	if err = dec.Decode(tok); err != nil {
+	tok, err := JSONCodec.Unmarshal(b)
+	if err != nil {
 		return nil, OAuthError{"CacheFile.Token", err.Error()}
 	}
 	return tok, nil
 }
 
 func (f CacheFile) PutToken(tok *Token) error {
-	file, err := os.Create(string(f))
+	b, err := JSONCodec.Marshal(tok)
 	if err != nil {
 		return OAuthError{"CacheFile.PutToken", err.Error()}
 	}
-	enc := json.NewEncoder(file)
-	return enc.Encode(tok)
+	if err := writeFile(string(f), b); err != nil {
+		return OAuthError{"CacheFile.PutToken", err.Error()}
+	}
+	return nil
+}
+
+// Clear removes the cache file.
+func (f CacheFile) Clear() error {
+	if err := os.Remove(string(f)); err != nil && !os.IsNotExist(err) {
+		return OAuthError{"CacheFile.Clear", err.Error()}
+	}
+	return nil
+}
+
+// writeFile replaces the file name with one holding b and mode 0600,
+// whatever the mode of the file it replaces. The data is written to a
+// temporary file in the same directory and synced before that is
+// renamed over name, so name holds either its old contents or b.
+func writeFile(name string, b []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(name), "."+filepath.Base(name)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	if err = f.Chmod(0600); err == nil {
+		if _, err = f.Write(b); err == nil {
+			err = f.Sync()
+		}
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, name)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
 }
 
+// AuthStyle is how a Config sends its client credentials to the token
+// endpoint.
+type AuthStyle int
+
+const (
+	// AuthStyleInParams sends the client_id and client_secret in the
+	// POST body. It is the default.
+	AuthStyleInParams AuthStyle = iota
+
+	// AuthStyleInHeader sends the client credentials with HTTP Basic
+	// authentication (RFC 6749 section 2.3.1), leaving both client_id
+	// and client_secret out of the body.
+	AuthStyleInHeader
+
+	// AuthStyleBoth sends the client credentials both with HTTP Basic
+	// authentication and in the POST body. RFC 6749 forbids using more
+	// than one method, so this is only for servers that insist on it.
+	AuthStyleBoth
+
+	// AuthStyleAutoDetect tries AuthStyleInParams first and, if the
+	// server rejects it with invalid_client, AuthStyleInHeader. The
+	// style that works is remembered by the Config and used for all
+	// later requests.
+	AuthStyleAutoDetect
+
+	// AuthStylePrivateKeyJWT authenticates the client with a JWT
+	// signed with the Config's SigningKey (RFC 7523 section 2.2, the
+	// private_key_jwt method of OpenID Connect) instead of a client
+	// secret. Each request carries a new assertion, issued by
+	// ClientId to the TokenURL and valid for a minute.
+	AuthStylePrivateKeyJWT
+
+	// AuthStyleTLSClientAuth authenticates the client with the Config's
+	// ClientCertificate in the TLS handshake (RFC 8705 section 2),
+	// sending only the client_id in the POST body.
+	AuthStyleTLSClientAuth
+)
+
+// clientAssertionType is the client_assertion_type of
+// AuthStylePrivateKeyJWT.
+const clientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// clientAssertionLifetime is how long an AuthStylePrivateKeyJWT
+// assertion is valid.
+const clientAssertionLifetime = time.Minute
+
 // Config is the configuration of an OAuth consumer.
 type Config struct {
-	ClientId     string
-	ClientSecret string
-	Scope        string
-	AuthURL      string
-	TokenURL     string
-	RedirectURL  string // Defaults to out-of-band mode if empty.
-	TokenCache   Cache
-	AccessType   string // Optional, "online" (default) or "offline", no refresh token if "online"
+	ClientId      string
+	ClientSecret  string
+	Scope         string
+	AuthURL       string
+	TokenURL      string // May name a Unix socket, as in "unix:///run/broker.sock:/token".
+	DeviceURL     string // Device authorization endpoint (RFC 8628), used by DeviceAuth.
+	JWKSURL       string // OpenID Connect JSON Web Key Set, used by VerifyIDToken.
+	Issuer        string // OpenID Connect issuer identifier, used by VerifyIDToken.
+	RevokeURL     string // Token revocation endpoint (RFC 7009), used by Close.
+	IntrospectURL string // Token introspection endpoint (RFC 7662), used by Introspect.
+	UserInfoURL   string // OpenID Connect UserInfo endpoint, used by UserInfo.
+	PARURL        string // Pushed authorization request endpoint (RFC 9126), used by PushedAuthorizationRequest.
+	RedirectURL   string // Defaults to out-of-band mode if empty.
+	TokenCache    Cache
+	AccessType    string // Optional, "online" (default) or "offline", no refresh token if "online"
+	ResponseType  string // Defaults to "code" if empty. OpenID Connect hybrid flows use e.g. "code id_token".
+
+	// RegistrationURL is the dynamic client registration endpoint (RFC
+	// 7591), used by RegisterClient.
+	RegistrationURL string
+
+	// RedirectURLs are the other redirect URIs registered for the
+	// client, any of which RedirectURI may select in place of
+	// RedirectURL.
+	RedirectURLs []string
 
 	// ApprovalPrompt indicates whether the user should be
 	// re-prompted for consent. If set to "auto" (default) the
@@ -107,6 +287,288 @@ type Config struct {
 	// If set to "force" the user will always be prompted, and the
 	// code can be exchanged for a refresh token.
 	ApprovalPrompt string
+
+	// Audience, if set, is sent as the "audience" parameter of the
+	// authorization URL and of every token request. Some providers
+	// (Auth0, for example) require it to issue an access token for
+	// a particular API.
+	Audience string
+
+	// Resources, if set, are the URIs of the resource servers the
+	// tokens are for (RFC 8707), sent as "resource" parameters of the
+	// authorization URL and of every token request alongside Audience.
+	Resources []string
+
+	// Scopes, if set, are requested along with those of Scope, as a
+	// list that is easier to extend for incremental authorization
+	// than a space-separated string.
+	Scopes []string
+
+	// RequiredScopes, if set, are scopes the application cannot work
+	// without. If a token response lists the granted scope and any of
+	// these is missing, Exchange and Refresh fail with
+	// ErrInsufficientScope and the Token is left unchanged.
+	RequiredScopes []string
+
+	// FieldMap renames the fields of token responses for providers
+	// that do not use the standard names. Its keys are the standard
+	// names "access_token", "refresh_token", "token_type", "scope",
+	// "expires_in", "expires_at", "refresh_after" and
+	// "issued_token_type"; its values are the names the provider uses.
+	// Fields missing from the map keep their standard names.
+	FieldMap map[string]string
+
+	// AuthStyle selects how client credentials are sent with token
+	// requests, for exchange and refresh alike.
+	AuthStyle AuthStyle
+
+	// ClientSecrets, if not empty, replaces ClientSecret with a list
+	// of secrets to try in order, for use while a secret is being
+	// rotated. A token request rejected with invalid_client is
+	// retried with the next secret.
+	ClientSecrets []string
+
+	// RefreshClientId and RefreshClientSecret, if RefreshClientId is
+	// set, are the client credentials used to refresh tokens in place
+	// of ClientId and ClientSecret, for example while migrating tokens
+	// issued to one registered client to another.
+	RefreshClientId     string
+	RefreshClientSecret string
+
+	// OnRefreshError, if non-nil, is called with the error of every
+	// failed token request, including those that are retried.
+	OnRefreshError func(error)
+
+	// OnPersistError, if non-nil, is called when a new Token cannot be
+	// written to the TokenCache. The write happens before Exchange or
+	// Refresh returns, and its error is also returned by them, so a
+	// rotated refresh token is never lost silently.
+	OnPersistError func(error)
+
+	// PersistAfterRefresh, if non-nil and false, keeps refreshed Tokens
+	// out of the TokenCache, for applications that persist them from
+	// OnTokenChange themselves; Tokens from Exchange and other grants
+	// are still written. If nil, it is taken to be true: every
+	// refreshed Token is written before the refresh returns.
+	PersistAfterRefresh *bool
+
+	// OnTokenChange, if non-nil, is called with a copy of every new
+	// Token obtained by Exchange, a refresh or another grant, before
+	// it is written to the TokenCache and before the call that
+	// obtained it returns, so that an application can persist a
+	// rotated refresh token durably. It is called with the Transport
+	// locked and must not use the Transport. If a SwapCache holds a
+	// Token another process refreshed in the meantime, the Transport
+	// adopts that Token instead, and OnTokenChange is called again
+	// with it.
+	OnTokenChange func(*Token)
+
+	// BreakerThreshold, if positive, enables a circuit breaker around
+	// token refreshes: after that many consecutive failures, refreshes
+	// fail fast with ErrTokenEndpointUnavailable for BreakerCooldown.
+	// Failures further apart than BreakerCooldown are not consecutive,
+	// so occasional errors over a long run do not open the breaker.
+	// The first refresh after the cooldown probes the endpoint again;
+	// success closes the breaker and failure reopens it.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+
+	// MinRefreshInterval, if positive, is the least time between two
+	// refreshes made automatically by RoundTrip, guarding the token
+	// endpoint against a loop of refreshes when the server keeps
+	// issuing tokens that are already expired. Within it RoundTrip
+	// sends the current access token, even if expired, or fails with
+	// ErrRefreshTooSoon if there is none. Explicit calls to Refresh
+	// are not limited.
+	MinRefreshInterval time.Duration
+
+	// UserAgent, if set, is sent as the User-Agent of token endpoint
+	// requests, and of requests made through a Transport that do not
+	// set their own.
+	UserAgent string
+
+	// ExtraHeaders are added to every request made to the token,
+	// device authorization, revocation and introspection endpoints,
+	// such as an API key required by a gateway in front of them.
+	ExtraHeaders http.Header
+
+	// Proxy, if non-nil, selects the proxy for requests to the token,
+	// device authorization, revocation and introspection endpoints,
+	// as does the Proxy field of http.Transport. By default these
+	// requests use the Transport's own RoundTripper, which for
+	// http.DefaultTransport honors the HTTP_PROXY environment
+	// variables. If Proxy is set and the Transport's RoundTripper is
+	// not an *http.Transport, these requests go through a copy of
+	// http.DefaultTransport instead.
+	Proxy func(*http.Request) (*url.URL, error)
+
+	// TLSConfig, if non-nil, is the TLS configuration for requests to
+	// the provider's endpoints: those Proxy applies to, and discovery
+	// and key set documents. Set its RootCAs to trust a private
+	// provider's certificate authority. It is not used for requests
+	// made through a Transport; to trust the same authority for those,
+	// give the Transport an *http.Transport with this TLSClientConfig.
+	TLSConfig *tls.Config
+
+	// ClientCertificate, if non-nil, is presented in the TLS handshake
+	// with the provider's endpoints, for AuthStyleTLSClientAuth or a
+	// provider issuing certificate-bound access tokens (RFC 8705).
+	// Transports whose Transport is nil present it to resource servers
+	// as well, with the TLSConfig, so that the tokens bound to it are
+	// accepted there; give any other Transport a TLS configuration with
+	// the same certificate. See Token.VerifyCertificate.
+	ClientCertificate *tls.Certificate
+
+	// TokenTransport, if non-nil, is the HTTP transport for requests to
+	// the provider's endpoints, in place of the Transport's own: token,
+	// device, revocation and introspection requests as well as
+	// discovery and key set documents. Use it to give these requests
+	// their own dialer, TLS settings or tracing. Proxy and TLSConfig
+	// still apply if it is an *http.Transport.
+	TokenTransport http.RoundTripper
+
+	// MaxResponseBytes limits the size of token response bodies read
+	// from the server. If zero, the limit is 1MB.
+	MaxResponseBytes int64
+
+	// ExpiryDelta is how long before its expiry a Token is considered
+	// due for renewal ahead of time: by EnsureValid, the TokenSources
+	// and, with PreflightRefresh, requests with a body. It is meant to
+	// be longer than ExpirySkew, and has no effect if it is shorter. A
+	// Token whose RefreshAfter has passed is due for renewal as well.
+	ExpiryDelta time.Duration
+
+	// ExpirySkew is how long before its expiry a Token is treated as
+	// expired: RoundTrip refreshes it before sending any request, and
+	// Transport.Valid reports false. It allows for clock skew and the
+	// time a request takes to reach the server. If zero, it is
+	// DefaultExpirySkew; if negative, Tokens are used until their
+	// exact expiry.
+	ExpirySkew time.Duration
+
+	// RequestTimeout bounds each request to the provider's endpoints,
+	// including reading its response, so that a hung provider cannot
+	// stall Exchange or a refresh forever. If zero, it is
+	// DefaultRequestTimeout; if negative, requests are bounded only by
+	// their context. DialTimeout, if positive, bounds connecting to the
+	// provider, which otherwise takes as long as the Transport's
+	// RoundTripper allows.
+	RequestTimeout time.Duration
+	DialTimeout    time.Duration
+
+	// AdjustExpiry, if non-nil, is called with the expiry computed from
+	// each token response, zero if the response gave none, and the
+	// response itself. The token's Expiry is set to what it returns.
+	// Use it to correct for clock skew or for a provider whose
+	// expires_in cannot be trusted.
+	AdjustExpiry func(computed time.Time, resp *http.Response) time.Time
+
+	// Rand is the source of randomness for the PKCE verifiers and
+	// states generated by BeginAuth and AuthorizeInteractive. If nil,
+	// crypto/rand.Reader is used. Anything else is for tests.
+	Rand io.Reader
+
+	// IntrospectionLeeway is the clock skew between this host and the
+	// authorization server tolerated when checking the expiry of
+	// tokens returned by Introspect.
+	IntrospectionLeeway time.Duration
+
+	// AuditSink, if non-nil, receives an AuditEvent for every
+	// authorization URL built and every request made to the token,
+	// pushed authorization request, revocation and introspection
+	// endpoints.
+	AuditSink AuditSink
+
+	// Logf, if non-nil, is called with a summary of every
+	// authorization URL built and of every request made to, and
+	// response received from, the provider's endpoints, for debugging
+	// an integration. Client secrets, codes, tokens and the values of
+	// Authorization headers are redacted. log.Printf will do.
+	Logf func(format string, args ...interface{})
+
+	// LoopbackPort is the port on 127.0.0.1 that AuthorizeInteractive
+	// receives the authorization response on. If zero, a free port is
+	// chosen; providers that require an exact redirect URI need it set.
+	LoopbackPort int
+
+	// StrictTokenType, if true, makes RoundTrip fail with
+	// ErrUnsupportedTokenType rather than send a Token whose TokenType
+	// names a scheme other than Bearer. Otherwise every Token is sent
+	// as a Bearer token. Tokens without a TokenType are sent as Bearer
+	// tokens either way.
+	StrictTokenType bool
+
+	// ScopesSupported lists the scopes the provider supports, as filled
+	// in from its discovery document by Discover or DiscoverEndpoints.
+	// It is informational; Scope is what is requested.
+	ScopesSupported []string
+
+	// VerifyIDTokens, if true, makes Exchange verify the ID token of
+	// the token response with VerifyIDToken, failing if it is missing
+	// or invalid, and set the Token's IDToken to its claims. Passing
+	// Exchange the Nonce option sent with the authorization request
+	// does the same, and also checks the ID token's nonce claim.
+	VerifyIDTokens bool
+
+	// DocumentTTL is how long DiscoverEndpoints and VerifyIDToken cache
+	// provider metadata and key sets whose responses carry no
+	// Cache-Control max-age. If zero, they are cached for an hour.
+	DocumentTTL time.Duration
+
+	// NoCache, if true, keeps tokens out of every cache: Transports
+	// using the Config neither read nor write their TokenCache or
+	// Cache, for deployments where tokens must never be persisted.
+	NoCache bool
+
+	// SigningKey, if set, is the client's private key for signing
+	// request objects (RFC 9101) with RequestObjectURL, and client
+	// assertions with AuthStylePrivateKeyJWT: an RSA key
+	// signs with RS256 and a P-256 key with ES256. SigningKeyID names
+	// it in the "kid" header, so the provider can find its public key.
+	SigningKey   crypto.Signer
+	SigningKeyID string
+
+	// DPoPKey, if set, makes every request to the provider's endpoints
+	// and every request a Transport authorizes carry a DPoP proof of
+	// possession of it (RFC 9449), so that the tokens issued are bound
+	// to it. Tokens whose TokenType is "DPoP" are then sent with the
+	// DPoP scheme. An RSA key signs with RS256 and a P-256 key, as
+	// NewDPoPKey returns, with ES256.
+	DPoPKey crypto.Signer
+
+	// RetryPolicy, if non-nil, retries token requests that fail
+	// transiently.
+	RetryPolicy *RetryPolicy
+
+	// StateKey is the secret key with which SignedState signs state
+	// values, so that they can be checked without being stored.
+	// StateMaxAge, if positive, is how long a signed state stays valid.
+	StateKey    []byte
+	StateMaxAge time.Duration
+
+	// detectedAuthStyle is the AuthStyle found by AuthStyleAutoDetect,
+	// plus one; zero means not yet detected. Accessed atomically.
+	detectedAuthStyle int32
+
+	// endpoint holds the *builtTransport endpointClient last built, so
+	// that requests made without a Transport share its connections.
+	endpoint atomic.Value
+}
+
+// field returns the name of the token response field that holds the
+// standard field name, as remapped by FieldMap.
+func (c *Config) field(name string) string {
+	if f, ok := c.FieldMap[name]; ok {
+		return f
+	}
+	return name
+}
+
+func (c *Config) responseType() string {
+	if c.ResponseType != "" {
+		return c.ResponseType
+	}
+	return "code"
 }
 
 func (c *Config) redirectURL() string {
@@ -122,25 +584,302 @@ type Token struct {
 	AccessToken  string
 	RefreshToken string
 	Expiry       time.Time // If zero the token has no (known) expiry time.
+	TokenType    string    // As reported by the server, e.g. "Bearer".
+	GrantedScope string    // Space-separated; empty if the server did not say.
+
+	// IssuedTokenType is the type of token issued, as reported by a
+	// token exchange (RFC 8693) or brokered response, e.g.
+	// "urn:ietf:params:oauth:token-type:access_token". It is empty if
+	// the server did not say.
+	IssuedTokenType string
+
+	// RefreshAfter is when the provider recommends refreshing the
+	// token, from the nonstandard "refresh_after" field of the token
+	// response, in seconds. It is zero if the server did not say.
+	// EnsureValid and RoundTrip refresh the token once it has passed,
+	// even if it is not yet close to its expiry.
+	RefreshAfter time.Time
+
+	// IDToken holds the claims of the ID token of the token response
+	// once Exchange has verified it, with Config.VerifyIDTokens or the
+	// Nonce option, and is nil otherwise. It is kept when a refresh
+	// response has no new ID token, but is not stored in caches.
+	IDToken *IDToken `json:"-"`
+
+	// raw holds every field of the token response, including
+	// provider-specific ones. See Extra.
+	raw map[string]interface{}
+}
+
+// Extra returns the value of a field returned by the token endpoint
+// alongside the standard ones, such as "id_token" or "scope", or nil if
+// the server did not return it. Values from JSON responses keep their
+// decoded types (string, float64, bool, ...); values from form-encoded
+// responses are strings.
+func (t *Token) Extra(key string) interface{} {
+	return t.raw[key]
+}
+
+// ExtraString returns the extra field key as a string. The boolean is
+// false if the field is absent or not a string.
+func (t *Token) ExtraString(key string) (string, bool) {
+	s, ok := t.raw[key].(string)
+	return s, ok
+}
+
+// ExtraInt returns the extra field key as an integer. The boolean is
+// false if the field is absent or not an integral number. Numeric strings,
+// as found in form-encoded responses, are converted.
+func (t *Token) ExtraInt(key string) (int64, bool) {
+	switch v := t.raw[key].(type) {
+	case float64:
+		if v != math.Trunc(v) {
+			return 0, false
+		}
+		return int64(v), true
+	case int:
+		return int64(v), true
+	case int64:
+		return v, true
+	case string:
+		n, err := strconv.ParseInt(v, 10, 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// WithExtra returns a copy of t whose extra fields are replaced by extra.
+func (t *Token) WithExtra(extra map[string]interface{}) *Token {
+	t2 := *t
+	t2.raw = make(map[string]interface{}, len(extra))
+	for k, v := range extra {
+		t2.raw[k] = v
+	}
+	return &t2
+}
+
+// MarshalJSON encodes the Token for a cache, with the fields returned by
+// the token endpoint under "Extra" so that Extra still finds them once
+// the Token is loaded again.
+func (t Token) MarshalJSON() ([]byte, error) {
+	type token Token
+	return json.Marshal(struct {
+		token
+		Extra map[string]interface{} `json:",omitempty"`
+	}{token(t), t.raw})
+}
+
+// UnmarshalJSON decodes a Token encoded by MarshalJSON.
+func (t *Token) UnmarshalJSON(b []byte) error {
+	type token Token
+	var v struct {
+		token
+		Extra map[string]interface{}
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*t = Token(v.token)
+	t.raw = v.Extra
+	return nil
 }
 
+// NeverExpires is the lifetime ExpiresIn reports for a Token without a
+// (known) expiry time.
+const NeverExpires time.Duration = math.MaxInt64
+
+// Expired reports whether the token's expiry time has passed.
 func (t *Token) Expired() bool {
+	return t.expiresWithin(0)
+}
+
+// Valid reports whether t is non-nil, holds an access token and does
+// not expire within DefaultExpirySkew, so that a request sent with it
+// now should not be rejected as expired. Transport.Valid applies the
+// Config's ExpirySkew instead.
+func (t *Token) Valid() bool {
+	return t != nil && !t.needsRefresh(DefaultExpirySkew)
+}
+
+// ExpiresIn returns the token's remaining lifetime, which is negative if
+// it has expired, or NeverExpires if it has no expiry time.
+func (t *Token) ExpiresIn() time.Duration {
 	if t.Expiry.IsZero() {
-		return false
+		return NeverExpires
+	}
+	return t.Expiry.Sub(timeNow())
+}
+
+// Equal reports whether t and other hold the same tokens, expiry, token
+// type and extra fields. Two nil Tokens are equal.
+func (t *Token) Equal(other *Token) bool {
+	if t == nil || other == nil {
+		return t == other
+	}
+	return t.AccessToken == other.AccessToken &&
+		t.RefreshToken == other.RefreshToken &&
+		t.Expiry.Equal(other.Expiry) &&
+		t.TokenType == other.TokenType &&
+		t.GrantedScope == other.GrantedScope &&
+		t.IssuedTokenType == other.IssuedTokenType &&
+		t.RefreshAfter.Equal(other.RefreshAfter) &&
+		reflect.DeepEqual(t.raw, other.raw)
+}
+
+// String returns a description of the token that is safe to log: its
+// type, the first few characters of the access token, whether it has a
+// refresh token, and its expiry. It is also used by the %v and %+v
+// formats, so that printing a Token does not leak it.
+func (t Token) String() string {
+	s := "Token{Type: " + strconv.Quote(t.TokenType) + ", AccessToken: " + redact(t.AccessToken)
+	if t.RefreshToken != "" {
+		s += ", RefreshToken: [redacted]"
+	}
+	if !t.Expiry.IsZero() {
+		s += ", Expiry: " + t.Expiry.Format(time.RFC3339)
+	}
+	return s + "}"
+}
+
+// GoString is like String, for the %#v format.
+func (t Token) GoString() string {
+	return t.String()
+}
+
+// redact returns a quoted prefix of secret, short enough not to be
+// usable, followed by an ellipsis.
+func redact(secret string) string {
+	if secret == "" {
+		return `""`
+	}
+	if len(secret) < 16 {
+		return "[redacted]"
+	}
+	return strconv.Quote(secret[:4] + "...")
+}
+
+// merge fills in the fields of a refreshed token that the token
+// response left out from prev, the token it replaces: an omitted
+// refresh token, token type, issued token type or scope is unchanged
+// (RFC 6749 sections 5.1 and 6), and so are other response fields such
+// as id_token. The expiry and refresh hint are not carried over; a
+// response without expires_in gives a token with no known expiry.
+func (t *Token) merge(prev *Token) {
+	if t.RefreshToken == "" {
+		t.RefreshToken = prev.RefreshToken
+	}
+	if t.TokenType == "" {
+		t.TokenType = prev.TokenType
+	}
+	if t.GrantedScope == "" {
+		t.GrantedScope = prev.GrantedScope
+	}
+	if t.IssuedTokenType == "" {
+		t.IssuedTokenType = prev.IssuedTokenType
+	}
+	if _, ok := t.raw["id_token"]; !ok {
+		t.IDToken = prev.IDToken
+	}
+	for k, v := range prev.raw {
+		if _, ok := t.raw[k]; ok || k == "expires_in" || k == "expires" || k == "expires_at" || k == "refresh_after" {
+			continue
+		}
+		if t.raw == nil {
+			t.raw = make(map[string]interface{})
+		}
+		t.raw[k] = v
+	}
+}
+
+// HasScopes reports whether the token's GrantedScope includes every
+// scope in required.
+func (t *Token) HasScopes(required ...string) bool {
+	return hasScopes(t.GrantedScope, required)
+}
+
+// MissingScopes returns the scopes in required that the token's
+// GrantedScope lacks, so that an application can find out which of the
+// scopes it asked for the server declined. It returns nil if the
+// server did not say which scopes it granted.
+func (t *Token) MissingScopes(required ...string) []string {
+	if t.GrantedScope == "" {
+		return nil
+	}
+	return missingScopes(t.GrantedScope, required)
+}
+
+func hasScopes(scope string, required []string) bool {
+	return len(missingScopes(scope, required)) == 0
+}
+
+// missingScopes returns the scopes in required that the space-separated
+// scope lacks.
+func missingScopes(scope string, required []string) []string {
+	var missing []string
+	granted := strings.Fields(scope)
+	for _, r := range required {
+		found := false
+		for _, g := range granted {
+			if g == r {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, r)
+		}
+	}
+	return missing
+}
+
+// needsRefresh reports whether the token has no access token or
+// expires within d from now.
+func (t *Token) needsRefresh(d time.Duration) bool {
+	return t.AccessToken == "" || t.expiresWithin(d)
+}
+
+// dueForRefresh is like needsRefresh, but also reports whether
+// RefreshAfter has passed.
+func (t *Token) dueForRefresh(d time.Duration) bool {
+	if !t.RefreshAfter.IsZero() && !timeNow().Before(t.RefreshAfter) {
+		return true
 	}
-	return t.Expiry.Before(time.Now())
+	return t.needsRefresh(d)
+}
+
+// expiresWithin reports whether the token expires within d from now.
+func (t *Token) expiresWithin(d time.Duration) bool {
+	return t.ExpiresIn() < d
+}
+
+// A RefreshTrace records whether a request sent through a Transport
+// caused its Token to be refreshed. Attach one to a request's context
+// with WithRefreshTrace; RoundTrip updates it before sending the request.
+type RefreshTrace struct {
+	Refreshed bool
+}
+
+type refreshTraceKey struct{}
+
+// WithRefreshTrace returns a copy of ctx carrying trace.
+func WithRefreshTrace(ctx context.Context, trace *RefreshTrace) context.Context {
+	return context.WithValue(ctx, refreshTraceKey{}, trace)
 }
 
 // Transport implements http.RoundTripper. When configured with a valid
 // Config and Token it can be used to make authenticated HTTP requests.
+// A Token holding only a RefreshToken is enough; the first request
+// obtains an access token.
 //
-//	t := &oauth.Transport{config}
-//      t.Exchange(code)
-//      // t now contains a valid Token
-//	r, _, err := t.Client().Get("http://example.org/url/requiring/auth")
+//	t := &oauth.Transport{Config: config}
+//	t.Exchange(code)
+//	// t now contains a valid Token
+//	r, err := t.Client().Get("http://example.org/url/requiring/auth")
 //
 // It will automatically refresh the Token if it can,
-// updating the supplied Token in place.
+// updating the supplied Token in place. Code that may run concurrently
+// with requests made through the Transport should read the Token using
+// CurrentToken rather than the Token field.
 type Transport struct {
 	*Config
 	*Token
@@ -149,178 +888,1669 @@ type Transport struct {
 	// It will default to http.DefaultTransport if nil.
 	// (It should never be an oauth.Transport.)
 	Transport http.RoundTripper
+
+	// AllowedHosts restricts the hosts that receive the Token.
+	// Requests to any other host are passed to the underlying
+	// transport without an Authorization header. If empty, every
+	// request is authorized.
+	// Entries may be a bare host name ("example.org") or include
+	// a port ("example.org:8080").
+	AllowedHosts []string
+
+	// PreflightRefresh, if true, makes requests with a body refresh
+	// the Token before sending if it expires within the Config's
+	// ExpiryDelta, as EnsureValid does. A long upload can then be
+	// streamed without the Token expiring partway through, and the
+	// body never needs to be buffered for a retry.
+	PreflightRefresh bool
+
+	// StepUp, if true, makes a request rejected with a Bearer
+	// insufficient_scope challenge naming the scope it needs (RFC 6750
+	// section 3.1) refresh the Token requesting that scope as well,
+	// and send the request once more. Requests whose body cannot be
+	// replayed, because GetBody is nil, are not retried.
+	StepUp bool
+
+	// SetAuthorization, if non-nil, attaches the access token to each
+	// request in place of the default "Authorization: Bearer" header,
+	// for APIs that expect another scheme or a query parameter; see
+	// HeaderScheme, TokenTypeScheme and QueryParameter. It is given a
+	// copy of the request and of the Token, and StrictTokenType does
+	// not apply.
+	SetAuthorization func(req *http.Request, tok *Token)
+
+	// RetryUnauthorized, if true, makes a request rejected with 401
+	// Unauthorized, as when the provider has invalidated the access
+	// token early, refresh the Token and send the request once more.
+	// If the refresh fails, the 401 response is returned. As with
+	// StepUp, requests whose body cannot be replayed are not retried.
+	RetryUnauthorized bool
+
+	// ChallengeErrors, if true, makes RoundTrip fail with an
+	// *AuthChallengeError instead of returning a 401 or 403 response
+	// that carries a Bearer or DPoP error challenge, after StepUp and
+	// RetryUnauthorized have had their go, so that callers can ask the
+	// user to consent to the scopes the resource requires.
+	ChallengeErrors bool
+
+	// Cache, if non-nil, is used in place of the Config's TokenCache,
+	// so that Transports sharing a Config can keep separate tokens,
+	// for example one per MultiCache account.
+	Cache Cache
+
+	mu sync.Mutex // guards Token during exchange and refresh
+
+	proxyOnce sync.Once
+	proxied   http.RoundTripper // built from the Config's Proxy, TLSConfig and ClientCertificate
+
+	mtlsOnce sync.Once
+	mtls     http.RoundTripper // presenting the Config's ClientCertificate
+
+	idOnce        sync.Once
+	correlationID string // for AuditEvents; see correlation
+
+	// Circuit breaker state, guarded by mu.
+	failures    int       // consecutive refresh failures
+	lastFailure time.Time // of the last refresh failure
+	openUntil   time.Time // refreshes fail fast until then
+
+	lastRefresh time.Time // of the last refresh attempt, guarded by mu
+
+	dpopMu     sync.Mutex
+	dpopNonces map[string]string // by host; see saveDPoPNonce
+
+	hits, refreshes atomic.Int64 // for Stats
 }
 
-// Client returns an *http.Client that makes OAuth-authenticated requests.
-func (t *Transport) Client() *http.Client {
-	return &http.Client{Transport: t}
+// TransportStats counts how often a Transport reused its Token.
+type TransportStats struct {
+	CacheHits int64 // Requests sent with the current Token, without refreshing.
+	Refreshes int64 // Successful refreshes, whether automatic or explicit.
 }
 
-func (t *Transport) transport() http.RoundTripper {
-	if t.Transport != nil {
-		return t.Transport
+// Stats returns the Transport's counters, for example to compute the
+// share of requests that reused a Token.
+func (t *Transport) Stats() TransportStats {
+	return TransportStats{
+		CacheHits: t.hits.Load(),
+		Refreshes: t.refreshes.Load(),
 	}
-	return http.DefaultTransport
 }
 
-// AuthCodeURL returns a URL that the end-user should be redirected to,
-// so that they may obtain an authorization code.
-func (c *Config) AuthCodeURL(state string) string {
-	url_, err := url.Parse(c.AuthURL)
-	if err != nil {
-		panic("AuthURL malformed: " + err.Error())
-	}
-	q := url.Values{
-		"response_type":   {"code"},
-		"client_id":       {c.ClientId},
-		"redirect_uri":    {c.redirectURL()},
-		"scope":           {c.Scope},
-		"state":           {state},
-		"access_type":     {c.AccessType},
-		"approval_prompt": {c.ApprovalPrompt},
-	}.Encode()
-	if url_.RawQuery == "" {
-		url_.RawQuery = q
-	} else {
-		url_.RawQuery += "&" + q
-	}
-	return url_.String()
+// Client returns an *http.Client that makes OAuth-authenticated requests.
+func (t *Transport) Client() *http.Client {
+	return &http.Client{Transport: t}
 }
 
-// Exchange takes a code and gets access Token from the remote server.
-func (t *Transport) Exchange(code string) (*Token, error) {
-	if t.Config == nil {
-		return nil, OAuthError{"Exchange", "no Config supplied"}
-	}
+// NewClient returns an *http.Client that makes requests authorized
+// with tok, refreshing it when it expires. Refreshed Tokens are written
+// to the Config's TokenCache, if it has one.
+func NewClient(c *Config, tok *Token) *http.Client {
+	return (&Transport{Config: c, Token: tok}).Client()
+}
 
-	// If the transport or the cache already has a token, it is
-	// passed to `updateToken ` to preserve existing refresh token.
-	tok := t.Token
-	if t.Token == nil {
-		if t.TokenCache != nil {
-			tok, _ = t.TokenCache.Token()
-		}
-	}
-	if tok == nil {
-		tok = new(Token)
-	}
-	err := t.updateToken(tok, url.Values{
-		"grant_type":   {"authorization_code"},
-		"redirect_uri": {t.redirectURL()},
-		"scope":        {t.Scope},
-		"code":         {code},
-	})
+// NewClientFromCache is like NewClient, but with the Token stored in
+// cache, which refreshed Tokens are written back to in place of the
+// Config's TokenCache:
+//
+//	client, err := oauth.NewClientFromCache(config, oauth.CacheFile("token.json"))
+//
+// It returns an error if the Token cannot be read from cache.
+func NewClientFromCache(c *Config, cache Cache) (*http.Client, error) {
+	tok, err := cache.Token()
 	if err != nil {
 		return nil, err
 	}
-	t.Token = tok
-	if t.TokenCache != nil {
-		return tok, t.TokenCache.PutToken(tok)
+	if tok == nil {
+		return nil, ErrNoToken
 	}
-	return tok, nil
+	return (&Transport{Config: c, Token: tok, Cache: cache}).Client(), nil
 }
 
-// RoundTrip executes a single HTTP transaction using the Transport's
-// Token as authorization headers.
-//
-// This method will attempt to renew the Token if it has expired and may return
-// an error related to that Token renewal before attempting the client request.
-// If the Token cannot be renewed a non-nil os.Error value will be returned.
-// If the Token is invalid callers should expect HTTP-level errors,
-// as indicated by the Response's StatusCode.
-func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
-	if t.Config == nil {
-		return nil, OAuthError{"RoundTrip", "no Config supplied"}
+// authorizes reports whether req should carry the Token. A redirect
+// never carries it to a host other than that of the request first sent,
+// nor from https to plain http.
+func (t *Transport) authorizes(req *http.Request) bool {
+	orig := originalRequest(req)
+	if orig.URL.Host != req.URL.Host || orig.URL.Scheme == "https" && req.URL.Scheme != "https" {
+		return false
 	}
-	if t.Token == nil {
-		if t.TokenCache == nil {
-			return nil, OAuthError{"RoundTrip", "no Token supplied"}
-		}
-		var err error
-		t.Token, err = t.TokenCache.Token()
-		if err != nil {
-			return nil, err
+	if len(t.AllowedHosts) == 0 {
+		return true
+	}
+	for _, h := range t.AllowedHosts {
+		if h == req.URL.Host || h == req.URL.Hostname() {
+			return true
 		}
 	}
+	return false
+}
 
-	// Refresh the Token if it has expired.
-	if t.Expired() {
-		if err := t.Refresh(); err != nil {
-			return nil, err
-		}
+// originalRequest returns the request whose redirects led to req, or req
+// itself if it is not a redirect.
+func originalRequest(req *http.Request) *http.Request {
+	for req.Response != nil && req.Response.Request != nil {
+		req = req.Response.Request
 	}
+	return req
+}
 
-	// Make the HTTP request.
-	req.Header.Set("Authorization", "Bearer "+t.AccessToken)
-	return t.transport().RoundTrip(req)
+// config returns the Transport's Config, which UpdateConfig may swap.
+func (t *Transport) config() *Config {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.Config
 }
 
-// Refresh renews the Transport's AccessToken using its RefreshToken.
-func (t *Transport) Refresh() error {
-	if t.Config == nil {
-		return OAuthError{"Refresh", "no Config supplied"}
-	} else if t.Token == nil {
+// UpdateConfig replaces the Transport's Config with cfg, keeping its
+// Token, as a server reloading its configuration might to rotate the
+// client secret or move endpoints. It waits for any refresh in progress
+// and is safe to call while requests are made through the Transport.
+// The Transport keeps the HTTP transport derived from the old Config's
+// Proxy and TLSConfig, if it has already made one.
+func (t *Transport) UpdateConfig(cfg *Config) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.Config = cfg
+}
+
+// CurrentToken returns a copy of the Transport's Token, or nil if it has
+// none. Unlike reading the Token field directly, it is safe to call while
+// other goroutines make requests that may refresh the Token.
+func (t *Transport) CurrentToken() *Token {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.Token == nil {
+		return nil
+	}
+	tok := *t.Token
+	return &tok
+}
+
+// Extra is like the Token's Extra, but safe to call while other
+// goroutines make requests that may refresh the Token. It returns nil
+// if the Transport has no Token.
+func (t *Transport) Extra(key string) interface{} {
+	if tok := t.CurrentToken(); tok != nil {
+		return tok.Extra(key)
+	}
+	return nil
+}
+
+// ExtraString is like the Token's ExtraString, but safe to call while
+// other goroutines make requests that may refresh the Token.
+func (t *Transport) ExtraString(key string) (string, bool) {
+	if tok := t.CurrentToken(); tok != nil {
+		return tok.ExtraString(key)
+	}
+	return "", false
+}
+
+// ExtraInt is like the Token's ExtraInt, but safe to call while other
+// goroutines make requests that may refresh the Token.
+func (t *Transport) ExtraInt(key string) (int64, bool) {
+	if tok := t.CurrentToken(); tok != nil {
+		return tok.ExtraInt(key)
+	}
+	return 0, false
+}
+
+// transport returns the transport for requests authorized with the
+// Token, which for a Transport without its own presents the
+// ClientCertificate of c, with its TLSConfig, if c is non-nil and has
+// one.
+func (t *Transport) transport(c *Config) http.RoundTripper {
+	if t.Transport != nil {
+		return t.Transport
+	}
+	if c == nil || c.ClientCertificate == nil {
+		return http.DefaultTransport
+	}
+	t.mtlsOnce.Do(func() {
+		base := http.DefaultTransport.(*http.Transport).Clone()
+		base.TLSClientConfig = new(tls.Config)
+		if c.TLSConfig != nil {
+			base.TLSClientConfig = c.TLSConfig.Clone()
+		}
+		base.TLSClientConfig.Certificates = []tls.Certificate{*c.ClientCertificate}
+		t.mtls = base
+	})
+	return t.mtls
+}
+
+// tokenTransport returns the transport for requests to the token and
+// other OAuth endpoints: the Config's TokenTransport or else the
+// Transport's own, but using the Config's Proxy, TLSConfig and
+// ClientCertificate if they are set.
+func (t *Transport) tokenTransport() http.RoundTripper {
+	rt := t.transport(t.Config)
+	if t.TokenTransport != nil {
+		rt = t.TokenTransport
+	}
+	if t.Proxy == nil && t.TLSConfig == nil && t.ClientCertificate == nil && t.DialTimeout <= 0 {
+		return rt
+	}
+	t.proxyOnce.Do(func() {
+		t.proxied = t.Config.configureTransport(rt)
+	})
+	return t.proxied
+}
+
+// configureTransport returns a copy of rt, or of http.DefaultTransport
+// if rt is not an *http.Transport, using c's Proxy, DialTimeout,
+// TLSConfig and ClientCertificate.
+func (c *Config) configureTransport(rt http.RoundTripper) *http.Transport {
+	base, ok := rt.(*http.Transport)
+	if !ok {
+		base = http.DefaultTransport.(*http.Transport)
+	}
+	base = base.Clone()
+	if c.Proxy != nil {
+		base.Proxy = c.Proxy
+	}
+	if c.DialTimeout > 0 {
+		base.DialContext = (&net.Dialer{Timeout: c.DialTimeout, KeepAlive: 30 * time.Second}).DialContext
+	}
+	if c.TLSConfig != nil {
+		base.TLSClientConfig = c.TLSConfig.Clone()
+	}
+	if c.ClientCertificate != nil {
+		if base.TLSClientConfig == nil {
+			base.TLSClientConfig = new(tls.Config)
+		}
+		base.TLSClientConfig.Certificates = []tls.Certificate{*c.ClientCertificate}
+	}
+	return base
+}
+
+// A builtTransport is an HTTP transport endpointClient built, with the
+// settings of the Config it was built from.
+type builtTransport struct {
+	tlsConfig   *tls.Config
+	cert        *tls.Certificate
+	dialTimeout time.Duration
+	rt          *http.Transport
+}
+
+// endpointClient returns a client for requests to the provider's
+// endpoints that are made without a Transport. If the Config's
+// settings call for an HTTP transport of its own, it is built once and
+// shared by later calls, until TLSConfig, ClientCertificate or
+// DialTimeout are changed; like a Transport, it keeps the Proxy and
+// TokenTransport it was first built with.
+func (c *Config) endpointClient() *http.Client {
+	var rt http.RoundTripper = http.DefaultTransport
+	if c.TokenTransport != nil {
+		rt = c.TokenTransport
+	}
+	if c.Proxy != nil || c.TLSConfig != nil || c.ClientCertificate != nil || c.DialTimeout > 0 {
+		rt = c.endpointTransport(rt)
+	}
+	return &http.Client{Transport: rt, Timeout: c.requestTimeout()}
+}
+
+// endpointTransport returns the HTTP transport endpointClient built from
+// rt and the Config's settings, building it if it has not yet or the
+// settings have changed since.
+func (c *Config) endpointTransport(rt http.RoundTripper) *http.Transport {
+	for {
+		old, _ := c.endpoint.Load().(*builtTransport)
+		if old != nil && old.tlsConfig == c.TLSConfig && old.cert == c.ClientCertificate && old.dialTimeout == c.DialTimeout {
+			return old.rt
+		}
+		b := &builtTransport{c.TLSConfig, c.ClientCertificate, c.DialTimeout, c.configureTransport(rt)}
+		if old == nil && c.endpoint.CompareAndSwap(nil, b) || old != nil && c.endpoint.CompareAndSwap(old, b) {
+			if old != nil {
+				old.rt.CloseIdleConnections()
+			}
+			return b.rt
+		}
+		// Another caller built one first; use that.
+	}
+}
+
+// An AuthCodeOption adds a parameter to the URL returned by AuthCodeURL,
+// or to the token request made by Exchange.
+type AuthCodeOption interface {
+	setValue(url.Values)
+}
+
+type setParam struct{ k, v string }
+
+func (p setParam) setValue(m url.Values) { m.Set(p.k, p.v) }
+
+// ResponseMode returns an AuthCodeOption that sets the "response_mode"
+// parameter, asking the provider to return the authorization response
+// by "query", "fragment" or "form_post".
+func ResponseMode(mode string) AuthCodeOption {
+	return setParam{"response_mode", mode}
+}
+
+// OutOfBandURI is the redirect URI of the out-of-band flow, in which
+// the provider shows the authorization code to the user to copy into
+// the application rather than redirecting to it. A Config without a
+// RedirectURL uses the legacy form, "oob".
+const OutOfBandURI = "urn:ietf:wg:oauth:2.0:oob"
+
+// OutOfBand is an AuthCodeOption that sets the redirect URI to
+// OutOfBandURI, for desktop and command-line applications that cannot
+// receive a redirect on a loopback address. Pass it to both AuthCodeURL
+// and Exchange, since the token request must repeat the redirect URI
+// of the authorization request.
+var OutOfBand AuthCodeOption = setParam{"redirect_uri", OutOfBandURI}
+
+// RedirectURI returns an AuthCodeOption that sets the redirect URI to
+// uri in place of the Config's RedirectURL, for applications registered
+// with several. It returns an error unless uri is the RedirectURL or
+// one of the RedirectURLs. As with OutOfBand, pass the option to both
+// AuthCodeURL and Exchange.
+func (c *Config) RedirectURI(uri string) (AuthCodeOption, error) {
+	if uri != "" && uri == c.RedirectURL {
+		return setParam{"redirect_uri", uri}, nil
+	}
+	for _, u := range c.RedirectURLs {
+		if u == uri {
+			return setParam{"redirect_uri", uri}, nil
+		}
+	}
+	return nil, OAuthError{"RedirectURI", "redirect URI " + strconv.Quote(uri) + " is not registered"}
+}
+
+// SetParam returns an AuthCodeOption that sets the parameter key to
+// value, for parameters without an option of their own. It replaces a
+// parameter the Config sets, such as "scope".
+func SetParam(key, value string) AuthCodeOption {
+	return setParam{key, value}
+}
+
+// AccessTypeOffline is an AuthCodeOption that asks Google-style
+// providers for a refresh token, like a Config's AccessType of
+// "offline".
+var AccessTypeOffline AuthCodeOption = setParam{"access_type", "offline"}
+
+// IncludeGrantedScopes is an AuthCodeOption for incremental
+// authorization: the authorization server is asked to include the
+// scopes the user has already granted the client in the new grant, and,
+// passed to Exchange, the new token's GrantedScope is merged with the
+// previous token's, for servers that only report the scopes just
+// granted. See Transport.IncrementalAuthCodeURL.
+var IncludeGrantedScopes AuthCodeOption = setParam{"include_granted_scopes", "true"}
+
+// Prompt returns an AuthCodeOption that sets the OpenID Connect
+// "prompt" parameter to the space-separated values, such as "consent"
+// or "select_account".
+func Prompt(values ...string) AuthCodeOption {
+	return setParam{"prompt", strings.Join(values, " ")}
+}
+
+// LoginHint returns an AuthCodeOption that sets the OpenID Connect
+// "login_hint" parameter, suggesting the account the user signs in with.
+func LoginHint(hint string) AuthCodeOption {
+	return setParam{"login_hint", hint}
+}
+
+// IDTokenHint returns an AuthCodeOption that sets the OpenID Connect
+// "id_token_hint" parameter to a previously issued ID token, as used for
+// silent re-authentication. It returns an error if idToken is not shaped
+// like a JWT (three dot-separated base64url segments).
+func IDTokenHint(idToken string) (AuthCodeOption, error) {
+	if !isJWT(idToken) {
+		return nil, OAuthError{"IDTokenHint", "id_token_hint is not a JWT"}
+	}
+	return setParam{"id_token_hint", idToken}, nil
+}
+
+// isJWT reports whether s has the compact serialization shape of a JWT.
+func isJWT(s string) bool {
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return false
+	}
+	for _, p := range parts[:2] {
+		if p == "" {
+			return false
+		}
+		if _, err := base64.RawURLEncoding.DecodeString(p); err != nil {
+			return false
+		}
+	}
+	_, err := base64.RawURLEncoding.DecodeString(parts[2])
+	return err == nil
+}
+
+// AuthCodeURL returns a URL that the end-user should be redirected to,
+// so that they may obtain an authorization code.
+// The options, if any, add parameters to the URL.
+func (c *Config) AuthCodeURL(state string, opts ...AuthCodeOption) string {
+	return c.authorizeURL(c.authParams(state, opts))
+}
+
+// authorizeURL returns the AuthURL with the request parameters q added
+// to its query, recording the authorization request with the AuditSink
+// and Logf.
+func (c *Config) authorizeURL(q url.Values) string {
+	url_, err := url.Parse(c.AuthURL)
+	if err != nil {
+		panic("AuthURL malformed: " + err.Error())
+	}
+	if url_.RawQuery == "" {
+		url_.RawQuery = q.Encode()
+	} else {
+		url_.RawQuery += "&" + q.Encode()
+	}
+	if c.AuditSink != nil {
+		c.AuditSink.Audit(AuditEvent{Flow: "authorize", Time: timeNow(), ClientId: c.ClientId, Outcome: "success"})
+	}
+	if c.Logf != nil {
+		c.Logf("oauth: authorize %s", c.redactURL(url_))
+	}
+	return url_.String()
+}
+
+// IncrementalAuthCodeURL is like AuthCodeURL, but for adding scopes to
+// the grant of the Transport's Token: it requests only those of scopes
+// the Token has not been granted, with IncludeGrantedScopes, so that the
+// user is asked to consent to just those. It returns "" if the Token
+// already has every scope. Exchange the resulting code with
+// IncludeGrantedScopes to keep the Token's scopes in the new one.
+func (t *Transport) IncrementalAuthCodeURL(state string, scopes []string, opts ...AuthCodeOption) string {
+	missing := scopes
+	if tok := t.CurrentToken(); tok != nil && tok.GrantedScope != "" {
+		missing = tok.MissingScopes(scopes...)
+	}
+	if len(missing) == 0 {
+		return ""
+	}
+	opts = append([]AuthCodeOption{setParam{"scope", strings.Join(missing, " ")}, IncludeGrantedScopes}, opts...)
+	return t.config().AuthCodeURL(state, opts...)
+}
+
+// authParams returns the parameters of an authorization request.
+func (c *Config) authParams(state string, opts []AuthCodeOption) url.Values {
+	q := url.Values{
+		"response_type":   {c.responseType()},
+		"client_id":       {c.ClientId},
+		"redirect_uri":    {c.redirectURL()},
+		"scope":           {c.requestedScope()},
+		"state":           {state},
+		"access_type":     {c.AccessType},
+		"approval_prompt": {c.ApprovalPrompt},
+	}
+	if c.Audience != "" {
+		q.Set("audience", c.Audience)
+	}
+	if len(c.Resources) > 0 {
+		q["resource"] = append([]string(nil), c.Resources...)
+	}
+	for _, opt := range opts {
+		opt.setValue(q)
+	}
+	return q
+}
+
+// ValidateAuthCodeURL checks the parts of the Config that go into
+// AuthCodeURL, with the same options, and reports the first problem
+// found: a missing or relative AuthURL, a missing ClientId, a scope
+// with characters not allowed by RFC 6749, or a redirect URI that is
+// neither out-of-band nor an absolute URL without a fragment.
+// AuthCodeURL does not call it; it is meant for checking a
+// configuration before users are sent to it.
+func (c *Config) ValidateAuthCodeURL(opts ...AuthCodeOption) error {
+	u, err := url.Parse(c.AuthURL)
+	if err != nil {
+		return OAuthError{"ValidateAuthCodeURL", "AuthURL malformed: " + err.Error()}
+	}
+	if !u.IsAbs() || u.Host == "" {
+		return OAuthError{"ValidateAuthCodeURL", "AuthURL " + strconv.Quote(c.AuthURL) + " is not an absolute URL"}
+	}
+	q := url.Values{
+		"response_type": {c.responseType()},
+		"client_id":     {c.ClientId},
+		"redirect_uri":  {c.redirectURL()},
+		"scope":         {c.requestedScope()},
+	}
+	for _, opt := range opts {
+		opt.setValue(q)
+	}
+	for _, k := range []string{"response_type", "client_id", "redirect_uri"} {
+		if q.Get(k) == "" {
+			return OAuthError{"ValidateAuthCodeURL", "missing " + k}
+		}
+	}
+	for _, r := range q.Get("scope") {
+		// scope-token = 1*( %x21 / %x23-5B / %x5D-7E ), space separated
+		if r != ' ' && (r < 0x21 || r > 0x7e || r == '"' || r == '\\') {
+			return OAuthError{"ValidateAuthCodeURL", "scope " + strconv.Quote(q.Get("scope")) + " contains invalid characters"}
+		}
+	}
+	if ru := q.Get("redirect_uri"); ru != "oob" && ru != OutOfBandURI {
+		u, err := url.Parse(ru)
+		if err != nil || !u.IsAbs() || u.Fragment != "" || (u.Scheme == "http" || u.Scheme == "https") && u.Host == "" {
+			return OAuthError{"ValidateAuthCodeURL", "redirect URI " + strconv.Quote(ru) + " is not an absolute URL without a fragment"}
+		}
+	}
+	return nil
+}
+
+// Exchange takes a code and gets access Token from the remote server.
+// The options, if any, add parameters to the token request, except for
+// Nonce, which makes Exchange verify the ID token returned and check
+// that it carries the nonce (see Config.VerifyIDTokens), and
+// IncludeGrantedScopes.
+func (t *Transport) Exchange(code string, opts ...AuthCodeOption) (*Token, error) {
+	return t.ExchangeContext(context.Background(), code, opts...)
+}
+
+// ExchangeContext is like Exchange but makes the token request with ctx,
+// so that it can be cancelled or given a deadline, as when exchanging a
+// code inside a request handler.
+func (t *Transport) ExchangeContext(ctx context.Context, code string, opts ...AuthCodeOption) (*Token, error) {
+	if t.config() == nil {
+		return nil, OAuthError{"Exchange", "no Config supplied"}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// If the transport or the cache already has a token, it is
+	// passed to `updateToken ` to preserve existing refresh token.
+	tok := t.Token
+	if t.Token == nil {
+		if c := t.cache(); c != nil {
+			tok, _ = c.Token()
+		}
+	}
+	if tok == nil {
+		tok = new(Token)
+	}
+	prev := *tok
+	v := url.Values{
+		"grant_type":   {"authorization_code"},
+		"redirect_uri": {t.redirectURL()},
+		"scope":        {t.requestedScope()},
+		"code":         {code},
+	}
+	for _, opt := range opts {
+		opt.setValue(v)
+	}
+	incremental := v.Get("include_granted_scopes") == "true"
+	nonce := v.Get("nonce")
+	v.Del("include_granted_scopes")
+	v.Del("nonce")
+	err := t.updateToken(ctx, tok, v)
+	if re, ok := err.(*RetrieveError); ok && re.ErrorCode == "invalid_grant" {
+		return nil, &codeExpiredError{re}
+	}
+	if err == nil && incremental && prev.GrantedScope != "" && tok.GrantedScope != "" {
+		tok.GrantedScope = strings.Join(mergeScopes(prev.GrantedScope, tok.GrantedScope), " ")
+	}
+	if err == nil && (t.VerifyIDTokens || nonce != "") {
+		err = t.verifyIDToken(tok, nonce)
+		if err != nil {
+			*tok = prev
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	t.Token = tok
+	return tok, t.cacheToken(&prev, tok)
+}
+
+// verifyIDToken verifies the ID token of a token response, and its
+// nonce if nonce is not empty, and sets tok's IDToken to its claims.
+func (t *Transport) verifyIDToken(tok *Token, nonce string) error {
+	idToken, _ := tok.ExtraString("id_token")
+	if idToken == "" {
+		return OAuthError{"Exchange", "no id_token in token response"}
+	}
+	claims, err := t.VerifyIDToken(idToken)
+	if err != nil {
+		return err
+	}
+	if nonce != "" {
+		if err := CheckNonce(claims, nonce); err != nil {
+			return err
+		}
+	}
+	tok.IDToken = newIDToken(claims)
+	return nil
+}
+
+// RoundTrip executes a single HTTP transaction using the Transport's
+// Token as authorization headers.
+//
+// This method will attempt to renew the Token if it has expired and may return
+// an error related to that Token renewal before attempting the client request.
+// If the Token cannot be renewed a non-nil os.Error value will be returned.
+// If the Token is invalid callers should expect HTTP-level errors,
+// as indicated by the Response's StatusCode.
+//
+// Requests to hosts not listed in AllowedHosts are sent unmodified.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	config := t.config()
+	if config != nil && config.UserAgent != "" && req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", config.UserAgent)
+	}
+	if !t.authorizes(req) {
+		if req.Response != nil {
+			req.Header.Del("Authorization")
+		}
+		return t.transport(config).RoundTrip(req)
+	}
+	if config == nil {
+		return nil, OAuthError{"RoundTrip", "no Config supplied"}
+	}
+	tok, err := t.accessToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Make the HTTP request.
+	if t.SetAuthorization != nil || config.DPoPKey != nil {
+		req = req.Clone(req.Context())
+	}
+	if err := t.authorize(config, req, &tok); err != nil {
+		return nil, err
+	}
+	resp, err := t.transport(config).RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	if t.saveDPoPNonce(config, req, resp) && wantsDPoPNonce(resp) {
+		if retry, ok := replayable(req); ok {
+			resp.Body.Close()
+			if err := t.authorize(config, retry, &tok); err != nil {
+				return nil, err
+			}
+			if resp, err = t.transport(config).RoundTrip(retry); err != nil {
+				return resp, err
+			}
+			req = retry
+		}
+	}
+	if t.StepUp && (resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden) {
+		if required := stepUpScope(resp.Header); required != "" {
+			return t.challenged(t.replay(req, resp, tok.AccessToken, required))
+		}
+	}
+	if t.RetryUnauthorized && resp.StatusCode == http.StatusUnauthorized {
+		return t.challenged(t.replay(req, resp, tok.AccessToken, ""))
+	}
+	return t.challenged(resp, nil)
+}
+
+// challenged returns the result of a RoundTrip, replacing a response
+// rejected with an error challenge by an *AuthChallengeError if
+// ChallengeErrors is set.
+func (t *Transport) challenged(resp *http.Response, err error) (*http.Response, error) {
+	if err != nil || !t.ChallengeErrors {
+		return resp, err
+	}
+	if ce := challengeError(resp); ce != nil {
+		resp.Body.Close()
+		return nil, ce
+	}
+	return resp, nil
+}
+
+// authorize attaches tok to req with SetAuthorization, or else as a
+// Bearer or DPoP token, adding a DPoP proof if c has a DPoPKey.
+func (t *Transport) authorize(c *Config, req *http.Request, tok *Token) error {
+	switch {
+	case t.SetAuthorization != nil:
+		t.SetAuthorization(req, tok)
+	case c.DPoPKey != nil && isDPoP(tok):
+		req.Header.Set("Authorization", "DPoP "+tok.AccessToken)
+	default:
+		req.Header.Set("Authorization", "Bearer "+tok.AccessToken)
+	}
+	return t.addDPoP(c, req, tok.AccessToken)
+}
+
+// HeaderScheme returns a Transport.SetAuthorization that sends the
+// access token in the Authorization header with scheme, such as
+// "token" for GitHub's older API.
+func HeaderScheme(scheme string) func(*http.Request, *Token) {
+	return func(req *http.Request, tok *Token) {
+		req.Header.Set("Authorization", scheme+" "+tok.AccessToken)
+	}
+}
+
+// TokenTypeScheme is a Transport.SetAuthorization that sends the access
+// token in the Authorization header with the Token's TokenType as the
+// scheme. A TokenType of "bearer" in any case, or none, is sent as
+// "Bearer".
+func TokenTypeScheme(req *http.Request, tok *Token) {
+	scheme := tok.TokenType
+	if scheme == "" || strings.EqualFold(scheme, "Bearer") {
+		scheme = "Bearer"
+	}
+	req.Header.Set("Authorization", scheme+" "+tok.AccessToken)
+}
+
+// QueryParameter returns a Transport.SetAuthorization that sends the
+// access token as the URL query parameter name, such as "access_token"
+// (RFC 6750 section 2.3), for APIs that accept no header. Servers and
+// proxies may log URLs, so prefer a header where the API allows one.
+func QueryParameter(name string) func(*http.Request, *Token) {
+	return func(req *http.Request, tok *Token) {
+		u := *req.URL
+		q := u.Query()
+		q.Set(name, tok.AccessToken)
+		u.RawQuery = q.Encode()
+		req.URL = &u
+	}
+}
+
+// replay handles a rejected response to req for StepUp and
+// RetryUnauthorized: if req can be sent again, it refreshes the Token,
+// requesting the extra scope required if it is not empty, unless a
+// concurrent request has already done so, and retries req once.
+// Otherwise, or if the refresh fails, it returns resp.
+func (t *Transport) replay(req *http.Request, resp *http.Response, sent, required string) (*http.Response, error) {
+	retry, ok := replayable(req)
+	if !ok {
+		return resp, nil
+	}
+
+	// Requests rejected at the same time share one refresh: if another
+	// has already replaced the access token sent with req, req is
+	// retried with the new one.
+	var err error
+	t.mu.Lock()
+	if t.Token == nil || t.AccessToken == sent {
+		var scope string
+		if required != "" {
+			scope = strings.Join(mergeScopes(t.requestedScope(), t.GrantedScope, required), " ")
+		}
+		err = t.refreshScope(req.Context(), scope)
+	}
+	var tok Token
+	if t.Token != nil {
+		tok = *t.Token
+	}
+	config := t.Config
+	t.mu.Unlock()
+	if err != nil {
+		if retry.Body != nil {
+			retry.Body.Close()
+		}
+		return resp, nil
+	}
+	resp.Body.Close()
+	if err := t.authorize(config, retry, &tok); err != nil {
+		if retry.Body != nil {
+			retry.Body.Close()
+		}
+		return nil, err
+	}
+	return t.transport(config).RoundTrip(retry)
+}
+
+// replayable returns a copy of req to send again, with a fresh body,
+// and reports whether req can be sent again at all: requests whose body
+// cannot be replayed, because GetBody is nil, cannot.
+func replayable(req *http.Request) (*http.Request, bool) {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return nil, false
+	}
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, false
+		}
+		retry.Body = body
+	}
+	return retry, true
+}
+
+// requestedScope returns the space-separated scopes of Scope and Scopes.
+func (c *Config) requestedScope() string {
+	return strings.Join(mergeScopes(append([]string{c.Scope}, c.Scopes...)...), " ")
+}
+
+// mergeScopes returns the distinct scopes of the space-separated lists,
+// in order of first appearance.
+func mergeScopes(lists ...string) []string {
+	var scopes []string
+	seen := make(map[string]bool)
+	for _, l := range lists {
+		for _, s := range strings.Fields(l) {
+			if !seen[s] {
+				seen[s] = true
+				scopes = append(scopes, s)
+			}
+		}
+	}
+	return scopes
+}
+
+// accessToken returns a copy of the Token to send with req, loading it
+// from the cache or refreshing it first if necessary.
+func (t *Transport) accessToken(req *http.Request) (Token, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.Token == nil {
+		c := t.cache()
+		if c == nil {
+			return Token{}, ErrNoToken
+		}
+		var err error
+		t.Token, err = c.Token()
+		if err != nil {
+			return Token{}, err
+		}
+	}
+
+	if t.AccessToken == "" && t.RefreshToken == "" {
+		return Token{}, ErrNoToken
+	}
+
+	trace, _ := req.Context().Value(refreshTraceKey{}).(*RefreshTrace)
+	if trace != nil {
+		trace.Refreshed = false
+	}
+
+	// Refresh the Token if it expires within ExpirySkew, or if it
+	// holds only a refresh token. With PreflightRefresh, a request
+	// with a body also refreshes a Token that expires within
+	// ExpiryDelta. A Token past its RefreshAfter is refreshed as well,
+	// but if that fails it is still good to send, and the next request
+	// tries again.
+	due := t.needsRefresh(t.expirySkew())
+	if t.PreflightRefresh && req.Body != nil && req.Body != http.NoBody {
+		due = due || t.dueForRefresh(t.ExpiryDelta)
+	}
+	hinted := !due && t.dueForRefresh(t.expirySkew())
+	refreshed := false
+	if (due || hinted) && !t.refreshedWithin(t.MinRefreshInterval) {
+		err := t.refresh(req.Context())
+		if err != nil && !hinted {
+			return Token{}, err
+		}
+		refreshed = err == nil
+		if refreshed && trace != nil {
+			trace.Refreshed = true
+		}
+	}
+	if t.AccessToken == "" {
+		return Token{}, ErrRefreshTooSoon
+	}
+	if t.StrictTokenType && t.SetAuthorization == nil && t.TokenType != "" && !strings.EqualFold(t.TokenType, "Bearer") && (t.DPoPKey == nil || !isDPoP(t.Token)) {
+		return Token{}, ErrUnsupportedTokenType
+	}
+	// A hit is a request sent with a Token that was still valid, not
+	// one that MinRefreshInterval kept from being refreshed.
+	if !refreshed && !t.needsRefresh(t.expirySkew()) {
+		t.hits.Add(1)
+	}
+	return *t.Token, nil
+}
+
+// Refresh renews the Transport's AccessToken using its RefreshToken.
+func (t *Transport) Refresh() error {
+	return t.RefreshContext(context.Background())
+}
+
+// RefreshContext is like Refresh but makes the token request with ctx,
+// so that it can be cancelled or given a deadline.
+func (t *Transport) RefreshContext(ctx context.Context) error {
+	if t.config() == nil {
+		return OAuthError{"Refresh", "no Config supplied"}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.refresh(ctx)
+}
+
+// Renew is like Refresh but also returns a copy of the new Token, for
+// callers that need its value at once, for example to forward it.
+func (t *Transport) Renew() (*Token, error) {
+	if t.config() == nil {
+		return nil, OAuthError{"Renew", "no Config supplied"}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.refresh(context.Background()); err != nil {
+		return nil, err
+	}
+	tok := *t.Token
+	return &tok, nil
+}
+
+// EnsureValid refreshes the Transport's Token if it has expired, will
+// expire within the Config's ExpiryDelta, or is past its RefreshAfter,
+// and does nothing otherwise.
+// Call it before a long-running operation to avoid a refresh midway.
+func (t *Transport) EnsureValid() error {
+	if t.config() == nil {
+		return OAuthError{"EnsureValid", "no Config supplied"}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.Token != nil && !t.dueForRefresh(t.ExpiryDelta) {
+		return nil
+	}
+	return t.refresh(context.Background())
+}
+
+// Valid reports whether the Transport holds a Token that RoundTrip
+// would send without refreshing it first: one with an access token
+// that does not expire within the Config's ExpirySkew.
+func (t *Transport) Valid() bool {
+	config := t.config()
+	tok := t.CurrentToken()
+	return config != nil && tok != nil && !tok.needsRefresh(config.expirySkew())
+}
+
+// TokenValidFor returns a copy of the Transport's Token, refreshing it
+// first if it has expired or will expire within d. It returns an error
+// if even the refreshed Token expires within d.
+func (t *Transport) TokenValidFor(d time.Duration) (*Token, error) {
+	if t.config() == nil {
+		return nil, OAuthError{"TokenValidFor", "no Config supplied"}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.Token == nil || t.needsRefresh(d) {
+		if err := t.refresh(context.Background()); err != nil {
+			return nil, err
+		}
+		if t.needsRefresh(d) {
+			return nil, OAuthError{"TokenValidFor", "new token expires within " + d.String()}
+		}
+	}
+	tok := *t.Token
+	return &tok, nil
+}
+
+// Idle discards the Transport's access token, keeping its refresh token,
+// so that it no longer sits in memory while the Transport is unused.
+// The next request obtains a new access token by refreshing.
+func (t *Transport) Idle() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.Token == nil {
+		return
+	}
+	t.AccessToken = ""
+	t.Expiry = time.Time{}
+	t.RefreshAfter = time.Time{}
+	// The raw response holds the access token too, and is what Extra
+	// and MarshalJSON use. Copies of the Token returned earlier share
+	// the map, so it is replaced rather than modified.
+	if t.raw != nil {
+		raw := make(map[string]interface{}, len(t.raw))
+		for k, v := range t.raw {
+			switch k {
+			case "access_token", "expires_in", "expires", "expires_at", "refresh_after":
+				continue
+			}
+			raw[k] = v
+		}
+		t.raw = raw
+	}
+}
+
+// refresh implements RefreshContext. The caller must hold t.mu.
+func (t *Transport) refresh(ctx context.Context) error {
+	return t.refreshScope(ctx, "")
+}
+
+// refreshScope refreshes the Token, requesting scope if it is not
+// empty. The caller must hold t.mu.
+func (t *Transport) refreshScope(ctx context.Context, scope string) error {
+	if t.Token == nil {
 		return OAuthError{"Refresh", "no existing Token"}
 	}
 
-	err := t.updateToken(t.Token, url.Values{
+	if t.BreakerThreshold > 0 && t.failures >= t.BreakerThreshold && timeNow().Before(t.openUntil) {
+		return ErrTokenEndpointUnavailable
+	}
+	t.lastRefresh = timeNow()
+	prev := *t.Token
+	v := url.Values{
 		"grant_type":    {"refresh_token"},
 		"refresh_token": {t.RefreshToken},
-	})
+	}
+	if scope != "" {
+		v.Set("scope", scope)
+	}
+	err := t.updateToken(ctx, t.Token, v)
 	if err != nil {
+		if t.BreakerThreshold > 0 {
+			now := timeNow()
+			if t.failures < t.BreakerThreshold && now.Sub(t.lastFailure) > t.BreakerCooldown {
+				t.failures = 0
+			}
+			t.failures++
+			t.lastFailure = now
+			if t.failures >= t.BreakerThreshold {
+				t.openUntil = now.Add(t.BreakerCooldown)
+			}
+		}
 		return err
 	}
-	if t.TokenCache != nil {
-		return t.TokenCache.PutToken(t.Token)
+	t.failures = 0
+	t.refreshes.Add(1)
+	return t.storeToken(&prev, t.Token, true)
+}
+
+// SetCache makes c the Transport's Cache, as when migrating a live
+// Transport to a new cache backend. It first writes the current Token,
+// if any, to c, and keeps the old cache if that fails. It waits for
+// any refresh in progress.
+func (t *Transport) SetCache(c Cache) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.Token != nil && c != nil && (t.Config == nil || !t.NoCache) {
+		if err := c.PutToken(t.Token); err != nil {
+			return err
+		}
 	}
+	t.Cache = c
 	return nil
 }
 
-func (t *Transport) updateToken(tok *Token, v url.Values) error {
-	v.Set("client_id", t.ClientId)
-	v.Set("client_secret", t.ClientSecret)
-	r, err := (&http.Client{Transport: t.transport()}).PostForm(t.TokenURL, v)
+// refreshedWithin reports whether the Transport attempted a refresh
+// less than d ago. The caller must hold t.mu.
+func (t *Transport) refreshedWithin(d time.Duration) bool {
+	return d > 0 && !t.lastRefresh.IsZero() && timeNow().Before(t.lastRefresh.Add(d))
+}
+
+// cache returns the Cache the Transport keeps its Token in, or nil if
+// it keeps it in none.
+func (t *Transport) cache() Cache {
+	if t.NoCache {
+		return nil
+	}
+	if t.Cache != nil {
+		return t.Cache
+	}
+	return t.TokenCache
+}
+
+// cacheToken reports tok to OnTokenChange and writes it to the cache,
+// if there is one, unless tok is unchanged from prev.
+func (t *Transport) cacheToken(prev, tok *Token) error {
+	return t.storeToken(prev, tok, false)
+}
+
+// storeToken implements cacheToken. If swap is set, tok was refreshed
+// from prev, and a SwapCache that another process has written to since
+// replaces tok with its stored Token.
+func (t *Transport) storeToken(prev, tok *Token, swap bool) error {
+	if prev.Equal(tok) {
+		return nil
+	}
+	t.tokenChanged(tok)
+	if swap && t.PersistAfterRefresh != nil && !*t.PersistAfterRefresh {
+		return nil
+	}
+	var err error
+	c := t.cache()
+	if s, ok := c.(SwapCache); ok && swap && prev.RefreshToken != "" {
+		if err = s.SwapToken(prev, tok); err == ErrTokenConflict {
+			if stored, serr := s.Token(); serr == nil {
+				*tok = *stored
+				err = nil
+				if !prev.Equal(tok) {
+					t.tokenChanged(tok)
+				}
+			} else {
+				// Nothing is stored to conflict with.
+				err = c.PutToken(tok)
+			}
+		}
+	} else if c != nil {
+		err = c.PutToken(tok)
+	}
+	if err != nil && t.OnPersistError != nil {
+		t.OnPersistError(err)
+	}
+	return err
+}
+
+// tokenChanged calls OnTokenChange, if set, with a copy of tok.
+func (t *Transport) tokenChanged(tok *Token) {
+	if t.OnTokenChange != nil {
+		tok2 := *tok
+		t.OnTokenChange(&tok2)
+	}
+}
+
+// DefaultExpirySkew is the default of Config.ExpirySkew, and the margin
+// applied by Token.Valid.
+const DefaultExpirySkew = 10 * time.Second
+
+// DefaultRequestTimeout is the default of Config.RequestTimeout.
+const DefaultRequestTimeout = 30 * time.Second
+
+func (c *Config) requestTimeout() time.Duration {
+	switch {
+	case c.RequestTimeout < 0:
+		return 0
+	case c.RequestTimeout == 0:
+		return DefaultRequestTimeout
+	}
+	return c.RequestTimeout
+}
+
+// cancelBody is a response body that releases its request's context
+// when closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+func (c *Config) expirySkew() time.Duration {
+	switch {
+	case c.ExpirySkew < 0:
+		return 0
+	case c.ExpirySkew == 0:
+		return DefaultExpirySkew
+	}
+	return c.ExpirySkew
+}
+
+// defaultMaxResponseBytes is the default of Config.MaxResponseBytes.
+const defaultMaxResponseBytes = 1 << 20
+
+func (c *Config) maxResponseBytes() int64 {
+	if c.MaxResponseBytes > 0 {
+		return c.MaxResponseBytes
+	}
+	return defaultMaxResponseBytes
+}
+
+var utf8BOM = []byte("\xef\xbb\xbf")
+
+// readBody reads all of body, failing with ErrResponseTooLarge if it is
+// longer than max bytes.
+func readBody(body io.Reader, max int64) ([]byte, error) {
+	b, err := ioutil.ReadAll(io.LimitReader(body, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) > max {
+		return nil, ErrResponseTooLarge
+	}
+	return b, nil
+}
+
+// parseExpiresAt parses the nonstandard expires_at field that some
+// servers send in place of expires_in, in Unix seconds or RFC 3339.
+// It returns the zero time if s is neither.
+func parseExpiresAt(s string) time.Time {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(n, 0)
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t
+	}
+	return time.Time{}
+}
+
+// readTokenBody reads a token response body of at most max bytes,
+// decompressing it if the server sent it gzip-encoded without the
+// transport having asked for it.
+func readTokenBody(r *http.Response, max int64) ([]byte, error) {
+	if !strings.EqualFold(r.Header.Get("Content-Encoding"), "gzip") {
+		return readBody(r.Body, max)
+	}
+	gz, err := gzip.NewReader(r.Body)
+	if err != nil {
+		return nil, OAuthError{"updateToken", "invalid gzip response: " + err.Error()}
+	}
+	defer gz.Close()
+	b, err := readBody(gz, max)
+	if err != nil && err != ErrResponseTooLarge {
+		return nil, OAuthError{"updateToken", "invalid gzip response: " + err.Error()}
+	}
+	return b, err
+}
+
+// RetrieveError is returned when the token endpoint responds with a
+// status other than 200 OK, or with an OAuth 2.0 error response (RFC
+// 6749 section 5.2) in place of a token, as some providers do with 200
+// OK. The fields of an error response are decoded. For a
+// problem details body (RFC 7807), as some gateways send, the title and
+// detail make up the ErrorDescription.
+type RetrieveError struct {
+	StatusCode       int
+	Status           string
+	ErrorCode        string // e.g. "invalid_grant"
+	ErrorDescription string
+	ErrorURI         string // A page describing the error, if the server gave one.
+
+	// RetryAfter is the delay the server asked for with a Retry-After
+	// header, or zero if it sent none.
+	RetryAfter time.Duration
+}
+
+// codeExpiredError is the error Exchange returns for an invalid_grant
+// response, which is ErrAuthorizationCodeExpired.
+type codeExpiredError struct {
+	*RetrieveError
+}
+
+func (e *codeExpiredError) Error() string {
+	return ErrAuthorizationCodeExpired.Error() + ": " + e.RetrieveError.Error()
+}
+
+func (e *codeExpiredError) Is(target error) bool { return target == ErrAuthorizationCodeExpired }
+
+func (e *codeExpiredError) Unwrap() error { return e.RetrieveError }
+
+func (e *RetrieveError) Error() string {
+	s := "OAuthError: updateToken: " + e.Status
+	if e.ErrorCode != "" {
+		s += ": " + e.ErrorCode
+	}
+	if e.ErrorDescription != "" {
+		s += ": " + e.ErrorDescription
+	}
+	return s
+}
+
+// expiresIn returns the lifetime of a token response whose fields get
+// returns: its expires_in, or, for older providers that send it under
+// that name, expires, as a number or a string of seconds.
+func (t *Transport) expiresIn(get func(string) interface{}) time.Duration {
+	v := get(t.field("expires_in"))
+	if _, mapped := t.FieldMap["expires_in"]; !mapped && (v == nil || v == "") {
+		v = get("expires")
+	}
+	var n float64
+	switch v := v.(type) {
+	case float64:
+		n = v
+	case string:
+		n, _ = strconv.ParseFloat(strings.TrimSpace(v), 64)
+	}
+	return time.Duration(n) * time.Second
+}
+
+// retrieveError builds a *RetrieveError from the unsuccessful response r.
+func retrieveError(r *http.Response) *RetrieveError {
+	e := &RetrieveError{StatusCode: r.StatusCode, Status: r.Status, RetryAfter: retryAfter(r.Header)}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		return e
+	}
+	content := strings.Split(r.Header.Get("Content-Type"), ";")
+	switch content[0] {
+	case "application/x-www-form-urlencoded", "text/plain":
+		vals, err := url.ParseQuery(string(body))
+		if err != nil {
+			return e
+		}
+		e.ErrorCode = vals.Get("error")
+		e.ErrorDescription = vals.Get("error_description")
+		e.ErrorURI = vals.Get("error_uri")
+	default:
+		var b struct {
+			Error            string `json:"error"`
+			ErrorDescription string `json:"error_description"`
+			ErrorURI         string `json:"error_uri"`
+			Title            string `json:"title"`  // RFC 7807
+			Detail           string `json:"detail"` // RFC 7807
+		}
+		if json.Unmarshal(body, &b) == nil {
+			e.ErrorCode = b.Error
+			e.ErrorDescription = b.ErrorDescription
+			e.ErrorURI = b.ErrorURI
+			if e.ErrorDescription == "" {
+				e.ErrorDescription = b.Title
+				if b.Title != "" && b.Detail != "" {
+					e.ErrorDescription += ": "
+				}
+				e.ErrorDescription += b.Detail
+			}
+		}
+	}
+	return e
+}
+
+// clientAuth holds the client credentials of a token endpoint request.
+type clientAuth struct {
+	style  AuthStyle
+	id     string
+	secret string
+}
+
+// postForm posts v to the endpoint u, using the Transport's HTTP transport.
+// If auth is non-nil the client credentials are added as auth.style
+// directs; v itself is not modified. c is the Config to apply, read
+// under t.mu or taken from t.config by the caller.
+func (t *Transport) postForm(ctx context.Context, c *Config, u string, v url.Values, auth *clientAuth) (*http.Response, error) {
+	if auth != nil && (auth.style == AuthStyleInParams || auth.style == AuthStyleBoth) {
+		v2 := make(url.Values, len(v)+2)
+		for k, vs := range v {
+			v2[k] = vs
+		}
+		v2.Set("client_id", auth.id)
+		v2.Set("client_secret", auth.secret)
+		v = v2
+	}
+	if auth != nil && auth.style == AuthStyleTLSClientAuth {
+		v2 := make(url.Values, len(v)+1)
+		for k, vs := range v {
+			v2[k] = vs
+		}
+		v2.Set("client_id", auth.id)
+		v = v2
+	}
+	if auth != nil && auth.style == AuthStylePrivateKeyJWT {
+		assertion, err := c.clientAssertion(auth.id)
+		if err != nil {
+			return nil, err
+		}
+		v2 := make(url.Values, len(v)+3)
+		for k, vs := range v {
+			v2[k] = vs
+		}
+		v2.Set("client_id", auth.id)
+		v2.Set("client_assertion_type", clientAssertionType)
+		v2.Set("client_assertion", assertion)
+		v = v2
+	}
+	client := &http.Client{Transport: t.tokenTransport()}
+	if socket, path, ok := splitUnixURL(u); ok {
+		u, client.Transport = "http://unix"+path, unixTransport(socket)
+	}
+	cancel := context.CancelFunc(func() {})
+	if d := c.requestTimeout(); d > 0 {
+		ctx, cancel = context.WithTimeout(ctx, d)
+	}
+	body := v.Encode()
+	req, err := http.NewRequestWithContext(ctx, "POST", u, strings.NewReader(body))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	for k, vs := range c.ExtraHeaders {
+		req.Header[k] = append([]string(nil), vs...)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+	if auth != nil && (auth.style == AuthStyleInHeader || auth.style == AuthStyleBoth) {
+		req.SetBasicAuth(url.QueryEscape(auth.id), url.QueryEscape(auth.secret))
+	}
+	for attempt := 0; ; attempt++ {
+		if err := t.addDPoP(c, req, ""); err != nil {
+			cancel()
+			return nil, err
+		}
+		c.logRequest(req, v)
+		resp, err := client.Do(req)
+		if err != nil {
+			cancel()
+			if c.Logf != nil {
+				c.Logf("oauth: POST %s: %v", c.redactURL(req.URL), err)
+			}
+			return nil, err
+		}
+		c.logResponse(resp)
+		// A server demanding a DPoP nonce answers 400 use_dpop_nonce
+		// with the nonce to use (RFC 9449 section 8).
+		if !t.saveDPoPNonce(c, req, resp) || resp.StatusCode != http.StatusBadRequest || attempt > 0 || !isDPoPNonceError(resp, c.maxResponseBytes()) {
+			resp.Body = cancelBody{resp.Body, cancel}
+			return resp, nil
+		}
+		resp.Body.Close()
+		req = req.Clone(ctx)
+		req.Body = ioutil.NopCloser(strings.NewReader(body))
+	}
+}
+
+// isDPoPNonceError reports whether resp, a 400 response from one of the
+// provider's endpoints, is a use_dpop_nonce error response. The body of
+// resp stays readable.
+func isDPoPNonceError(resp *http.Response, max int64) bool {
+	b, err := readBody(resp.Body, max)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(b))
+	if err != nil {
+		return false
+	}
+	var e struct {
+		Error string `json:"error"`
+	}
+	return json.Unmarshal(b, &e) == nil && e.Error == "use_dpop_nonce"
+}
+
+// clientAssertion returns a new AuthStylePrivateKeyJWT assertion for
+// the client id.
+func (c *Config) clientAssertion(id string) (string, error) {
+	if c.SigningKey == nil {
+		return "", OAuthError{"clientAssertion", "no SigningKey configured"}
+	}
+	jti, err := randomString(c.rand(), 16)
+	if err != nil {
+		return "", err
+	}
+	now := timeNow()
+	return signJWT(c.rand(), c.SigningKey, c.SigningKeyID, "JWT", map[string]interface{}{
+		"iss": id,
+		"sub": id,
+		"aud": c.TokenURL,
+		"jti": jti,
+		"iat": now.Unix(),
+		"exp": now.Add(clientAssertionLifetime).Unix(),
+	})
+}
+
+// updateToken requests a token from the token endpoint with the
+// parameters v and stores the result in tok. During secret rotation
+// each of the Config's ClientSecrets is tried in turn while the server
+// rejects the client with invalid_client.
+func (t *Transport) updateToken(ctx context.Context, tok *Token, v url.Values) error {
+	if t.Audience != "" && v.Get("audience") == "" {
+		v.Set("audience", t.Audience)
+	}
+	if len(t.Resources) > 0 && v.Get("resource") == "" {
+		v["resource"] = append([]string(nil), t.Resources...)
+	}
+	id, secrets := t.ClientId, t.ClientSecrets
+	if len(secrets) == 0 {
+		secrets = []string{t.ClientSecret}
+	}
+	if v.Get("grant_type") == "refresh_token" && t.RefreshClientId != "" {
+		id, secrets = t.RefreshClientId, []string{t.RefreshClientSecret}
+	}
+	err := t.retry(ctx, func() error {
+		return t.retrieveTokenSecrets(ctx, tok, v, id, secrets)
+	})
+	t.audit(ctx, grantFlow(v.Get("grant_type")), id, err)
+	return err
+}
+
+// retrieveTokenSecrets tries each of secrets in turn while the server
+// rejects the client with invalid_client.
+func (t *Transport) retrieveTokenSecrets(ctx context.Context, tok *Token, v url.Values, id string, secrets []string) error {
+	for i, secret := range secrets {
+		var err error
+		if t.AuthStyle == AuthStyleAutoDetect {
+			err = t.retrieveTokenAutoDetect(ctx, tok, v, id, secret)
+		} else {
+			err = t.retrieveToken(ctx, tok, v, &clientAuth{t.AuthStyle, id, secret})
+		}
+		if err == nil {
+			return nil
+		}
+		if t.OnRefreshError != nil {
+			t.OnRefreshError(err)
+		}
+		if !isInvalidClient(err) || i == len(secrets)-1 {
+			return err
+		}
+	}
+	panic("unreachable")
+}
+
+// retrieveTokenAutoDetect implements AuthStyleAutoDetect for a single
+// client secret.
+func (t *Transport) retrieveTokenAutoDetect(ctx context.Context, tok *Token, v url.Values, id, secret string) error {
+	if s := atomic.LoadInt32(&t.detectedAuthStyle); s != 0 {
+		return t.retrieveToken(ctx, tok, v, &clientAuth{AuthStyle(s - 1), id, secret})
+	}
+	err := t.retrieveToken(ctx, tok, v, &clientAuth{AuthStyleInParams, id, secret})
+	if err == nil {
+		atomic.StoreInt32(&t.detectedAuthStyle, int32(AuthStyleInParams)+1)
+		return nil
+	}
+	if !isInvalidClient(err) {
+		return err
+	}
+	if t.OnRefreshError != nil {
+		t.OnRefreshError(err)
+	}
+	err = t.retrieveToken(ctx, tok, v, &clientAuth{AuthStyleInHeader, id, secret})
+	if err == nil {
+		atomic.StoreInt32(&t.detectedAuthStyle, int32(AuthStyleInHeader)+1)
+	}
+	return err
+}
+
+// endpointAuthStyle returns the AuthStyle for requests to endpoints
+// other than the token endpoint, which AuthStyleAutoDetect does not
+// probe: the style detected at the token endpoint, if any, or else
+// AuthStyleInParams.
+func (c *Config) endpointAuthStyle() AuthStyle {
+	if c.AuthStyle != AuthStyleAutoDetect {
+		return c.AuthStyle
+	}
+	if s := atomic.LoadInt32(&c.detectedAuthStyle); s != 0 {
+		return AuthStyle(s - 1)
+	}
+	return AuthStyleInParams
+}
+
+// isInvalidClient reports whether err is the token endpoint rejecting
+// the client's credentials.
+func isInvalidClient(err error) bool {
+	re, ok := err.(*RetrieveError)
+	return ok && re.ErrorCode == "invalid_client"
+}
+
+// retrieveToken makes a single token request and decodes the response.
+func (t *Transport) retrieveToken(ctx context.Context, tok *Token, v url.Values, auth *clientAuth) error {
+	r, err := t.postForm(ctx, t.Config, t.TokenURL, v, auth)
 	if err != nil {
 		return err
 	}
 	defer r.Body.Close()
 	if r.StatusCode != 200 {
-		return OAuthError{"updateToken", r.Status}
+		return retrieveError(r)
 	}
+	body, err := readTokenBody(r, t.maxResponseBytes())
+	if err != nil {
+		return err
+	}
+	// Some proxies prepend a UTF-8 byte order mark.
+	body = bytes.TrimSpace(bytes.TrimPrefix(body, utf8BOM))
 	var b struct {
-		Access    string        `json:"access_token"`
-		Refresh   string        `json:"refresh_token"`
-		ExpiresIn time.Duration `json:"expires_in"`
+		Access     string
+		Refresh    string
+		Type       string
+		Scope      string
+		IssuedType string
+		RefreshIn  time.Duration
+		ExpiresIn  time.Duration
+		ExpiresAt  time.Time
+		raw        map[string]interface{}
 	}
 
 	content := strings.Split(r.Header.Get("Content-Type"), ";")
 	switch content[0] {
 	case "application/x-www-form-urlencoded", "text/plain":
-		body, err := ioutil.ReadAll(r.Body)
-		if err != nil {
-			return err
-		}
 		vals, err := url.ParseQuery(string(body))
 		if err != nil {
 			return err
 		}
 
-		b.Access = vals.Get("access_token")
-		b.ExpiresIn, _ = time.ParseDuration(vals.Get("expires") + "s")
+		b.Access = vals.Get(t.field("access_token"))
+		b.Refresh = vals.Get(t.field("refresh_token"))
+		b.Type = vals.Get(t.field("token_type"))
+		b.Scope = vals.Get(t.field("scope"))
+		b.IssuedType = vals.Get(t.field("issued_token_type"))
+		b.RefreshIn, _ = time.ParseDuration(vals.Get(t.field("refresh_after")) + "s")
+		b.ExpiresIn = t.expiresIn(func(k string) interface{} { return vals.Get(k) })
+		b.ExpiresAt = parseExpiresAt(vals.Get(t.field("expires_at")))
+		b.raw = make(map[string]interface{}, len(vals))
+		for k := range vals {
+			b.raw[k] = vals.Get(k)
+		}
 	default:
-		if err = json.NewDecoder(r.Body).Decode(&b); err != nil {
+		var raw map[string]interface{}
+		if err = json.Unmarshal(body, &raw); err != nil {
 			return err
 		}
+		b.Access, _ = raw[t.field("access_token")].(string)
+		b.Refresh, _ = raw[t.field("refresh_token")].(string)
+		b.Type, _ = raw[t.field("token_type")].(string)
+		b.Scope, _ = raw[t.field("scope")].(string)
+		b.IssuedType, _ = raw[t.field("issued_token_type")].(string)
+		if n, ok := raw[t.field("refresh_after")].(float64); ok {
+			b.RefreshIn = time.Duration(n) * time.Second
+		}
+		b.ExpiresIn = t.expiresIn(func(k string) interface{} { return raw[k] })
+		switch at := raw[t.field("expires_at")].(type) {
+		case float64:
+			b.ExpiresAt = time.Unix(int64(at), 0)
+		case string:
+			b.ExpiresAt = parseExpiresAt(at)
+		}
+		b.raw = raw
+	}
+	if b.Access == "" {
+		if code, _ := b.raw["error"].(string); code != "" {
+			e := &RetrieveError{StatusCode: r.StatusCode, Status: r.Status, ErrorCode: code}
+			e.ErrorDescription, _ = b.raw["error_description"].(string)
+			e.ErrorURI, _ = b.raw["error_uri"].(string)
+			return e
+		}
+		return ErrMissingAccessToken
+	}
+	if b.Scope != "" && !hasScopes(b.Scope, t.RequiredScopes) {
+		return ErrInsufficientScope
 	}
-	tok.AccessToken = b.Access
-	// Don't overwrite `RefreshToken` with an empty value
-	if len(b.Refresh) > 0 {
-		tok.RefreshToken = b.Refresh
+	nt := &Token{
+		AccessToken:     b.Access,
+		RefreshToken:    b.Refresh,
+		TokenType:       b.Type,
+		GrantedScope:    b.Scope,
+		IssuedTokenType: b.IssuedType,
+		raw:             b.raw,
 	}
-	if b.ExpiresIn == 0 {
-		tok.Expiry = time.Time{}
+	if b.ExpiresIn != 0 {
+		nt.Expiry = timeNow().Add(b.ExpiresIn)
 	} else {
-		tok.Expiry = time.Now().Add(b.ExpiresIn * time.Second)
+		nt.Expiry = b.ExpiresAt
+	}
+	if t.AdjustExpiry != nil {
+		nt.Expiry = t.AdjustExpiry(nt.Expiry, r)
+	}
+	if b.RefreshIn > 0 {
+		nt.RefreshAfter = timeNow().Add(b.RefreshIn)
+	}
+	// A refreshed token replaces tok; a token from any other grant
+	// starts a new session and keeps only tok's refresh token.
+	if v.Get("grant_type") == "refresh_token" {
+		nt.merge(tok)
+	} else if nt.RefreshToken == "" {
+		nt.RefreshToken = tok.RefreshToken
 	}
+	*tok = *nt
 	return nil
 }
@@ -0,0 +1,220 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// The oauth1 package signs HTTP requests with OAuth 1.0a HMAC-SHA1
+// signatures (RFC 5849), for legacy services that do not support
+// OAuth 2.0. It only signs requests; obtaining token credentials is left
+// to the caller.
+//
+// Example usage:
+//
+//	s := &oauth1.Signer{
+//		Consumer: oauth1.Credentials{Key: "consumer-key", Secret: "consumer-secret"},
+//		Token:    oauth1.Credentials{Key: "token", Secret: "token-secret"},
+//	}
+//	c := (&oauth1.Transport{Signer: s}).Client()
+//	resp, err := c.Get("https://legacy.example.com/api")
+//
+// Leave Token empty for one-legged requests signed by the consumer alone.
+package oauth1
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Credentials are a key and its shared secret.
+type Credentials struct {
+	Key    string
+	Secret string
+}
+
+// A Signer signs requests on behalf of a consumer and, unless Token is
+// empty, a resource owner.
+type Signer struct {
+	Consumer Credentials
+	Token    Credentials
+	Realm    string // Optional; sent with the Authorization header.
+
+	// For tests; default to a random nonce and the current time.
+	nonce func() string
+	now   func() time.Time
+}
+
+// Sign sets the Authorization header of req to an OAuth 1.0a HMAC-SHA1
+// signature over req's method, URL, query and, for form-encoded
+// requests, body parameters. The body is read and replaced.
+func (s *Signer) Sign(req *http.Request) error {
+	params := map[string]string{
+		"oauth_consumer_key":     s.Consumer.Key,
+		"oauth_signature_method": "HMAC-SHA1",
+		"oauth_timestamp":        strconv.FormatInt(s.time().Unix(), 10),
+		"oauth_nonce":            s.newNonce(),
+	}
+	if s.Token.Key != "" {
+		params["oauth_token"] = s.Token.Key
+	}
+	form, err := formParams(req)
+	if err != nil {
+		return err
+	}
+
+	mac := hmac.New(sha1.New, []byte(encode(s.Consumer.Secret)+"&"+encode(s.Token.Secret)))
+	io.WriteString(mac, baseString(req, form, params))
+	params["oauth_signature"] = base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var h bytes.Buffer
+	h.WriteString("OAuth ")
+	if s.Realm != "" {
+		h.WriteString(`realm="` + encode(s.Realm) + `", `)
+	}
+	for i, k := range keys {
+		if i > 0 {
+			h.WriteString(", ")
+		}
+		h.WriteString(k + `="` + encode(params[k]) + `"`)
+	}
+	req.Header.Set("Authorization", h.String())
+	return nil
+}
+
+func (s *Signer) time() time.Time {
+	if s.now != nil {
+		return s.now()
+	}
+	return time.Now()
+}
+
+func (s *Signer) newNonce() string {
+	if s.nonce != nil {
+		return s.nonce()
+	}
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// formParams returns the parameters of a form-encoded request body,
+// leaving the body readable again.
+func formParams(req *http.Request) (url.Values, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	ct := strings.TrimSpace(strings.Split(req.Header.Get("Content-Type"), ";")[0])
+	if ct != "application/x-www-form-urlencoded" {
+		return nil, nil
+	}
+	b, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(b))
+	return url.ParseQuery(string(b))
+}
+
+// baseString returns the signature base string of req (RFC 5849
+// section 3.4.1).
+func baseString(req *http.Request, form url.Values, oauthParams map[string]string) string {
+	var pairs [][2]string
+	add := func(k, v string) { pairs = append(pairs, [2]string{encode(k), encode(v)}) }
+	for k, vs := range req.URL.Query() {
+		for _, v := range vs {
+			add(k, v)
+		}
+	}
+	for k, vs := range form {
+		for _, v := range vs {
+			add(k, v)
+		}
+	}
+	for k, v := range oauthParams {
+		add(k, v)
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i][0] != pairs[j][0] {
+			return pairs[i][0] < pairs[j][0]
+		}
+		return pairs[i][1] < pairs[j][1]
+	})
+	normalized := make([]string, len(pairs))
+	for i, p := range pairs {
+		normalized[i] = p[0] + "=" + p[1]
+	}
+	return req.Method + "&" + encode(baseURI(req.URL)) + "&" + encode(strings.Join(normalized, "&"))
+}
+
+// baseURI returns u without its query and fragment, with the scheme and
+// host in lower case and any default port removed.
+func baseURI(u *url.URL) string {
+	scheme, host := strings.ToLower(u.Scheme), strings.ToLower(u.Host)
+	if scheme == "http" && strings.HasSuffix(host, ":80") || scheme == "https" && strings.HasSuffix(host, ":443") {
+		host = host[:strings.LastIndex(host, ":")]
+	}
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	return scheme + "://" + host + path
+}
+
+// encode percent-encodes s as RFC 5849 section 3.6 requires: every byte
+// but ALPHA, DIGIT, '-', '.', '_' and '~'.
+func encode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '.' || c == '_' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			b.WriteString("%" + strings.ToUpper(hex.EncodeToString([]byte{c})))
+		}
+	}
+	return b.String()
+}
+
+// Transport is an http.RoundTripper that signs every request with
+// Signer.
+type Transport struct {
+	Signer *Signer
+
+	// Transport is the HTTP transport to use when making requests.
+	// It will default to http.DefaultTransport if nil.
+	Transport http.RoundTripper
+}
+
+// Client returns an *http.Client that makes signed requests.
+func (t *Transport) Client() *http.Client {
+	return &http.Client{Transport: t}
+}
+
+// RoundTrip signs a copy of req and sends it.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req2 := req.Clone(req.Context())
+	if err := t.Signer.Sign(req2); err != nil {
+		return nil, err
+	}
+	rt := t.Transport
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	return rt.RoundTrip(req2)
+}
@@ -0,0 +1,87 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth1
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The example of RFC 5849 section 1.2.
+func exampleSigner() *Signer {
+	return &Signer{
+		Consumer: Credentials{Key: "dpf43f3p2l4k3l03", Secret: "kd94hf93k423kf44"},
+		Token:    Credentials{Key: "nnch734d00sl2jdk", Secret: "pfkkdhi9sl3r4s00"},
+		Realm:    "Photos",
+		nonce:    func() string { return "chapoH" },
+		now:      func() time.Time { return time.Unix(137131202, 0) },
+	}
+}
+
+func TestSign(t *testing.T) {
+	req, _ := http.NewRequest("GET", "http://photos.example.net/photos?file=vacation.jpg&size=original", nil)
+	if err := exampleSigner().Sign(req); err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	want := `OAuth realm="Photos", ` +
+		`oauth_consumer_key="dpf43f3p2l4k3l03", ` +
+		`oauth_nonce="chapoH", ` +
+		`oauth_signature="MdpQcU8iPSUjWoN%2FUDMsK2sui9I%3D", ` +
+		`oauth_signature_method="HMAC-SHA1", ` +
+		`oauth_timestamp="137131202", ` +
+		`oauth_token="nnch734d00sl2jdk"`
+	if g := req.Header.Get("Authorization"); g != want {
+		t.Errorf("Authorization =\n%s\nwant\n%s", g, want)
+	}
+}
+
+func TestBaseString(t *testing.T) {
+	// RFC 5849 section 3.4.1.1, with its oauth parameters.
+	req, _ := http.NewRequest("POST", "http://example.com/request?b5=%3D%253D&a3=a&c%40=&a2=r%20b", strings.NewReader("c2&a3=2+q"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	form, err := formParams(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := baseString(req, form, map[string]string{
+		"oauth_consumer_key":     "9djdj82h48djs9d2",
+		"oauth_token":            "kkk9d7dh3k39sjv7",
+		"oauth_signature_method": "HMAC-SHA1",
+		"oauth_timestamp":        "137131201",
+		"oauth_nonce":            "7d8f3e4a",
+	})
+	want := "POST&http%3A%2F%2Fexample.com%2Frequest&a2%3Dr%2520b%26a3%3D2%2520q" +
+		"%26a3%3Da%26b5%3D%253D%25253D%26c%2540%3D%26c2%3D%26oauth_consumer_" +
+		"key%3D9djdj82h48djs9d2%26oauth_nonce%3D7d8f3e4a%26oauth_signature_m" +
+		"ethod%3DHMAC-SHA1%26oauth_timestamp%3D137131201%26oauth_token%3Dkkk" +
+		"9d7dh3k39sjv7"
+	if got != want {
+		t.Errorf("baseString =\n%s\nwant\n%s", got, want)
+	}
+	if body, _ := ioutil.ReadAll(req.Body); string(body) != "c2&a3=2+q" {
+		t.Errorf("body after signing = %q, want it unchanged", body)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+	}))
+	defer server.Close()
+
+	resp, err := (&Transport{Signer: exampleSigner()}).Client().Get(server.URL + "/photos")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	resp.Body.Close()
+	if !strings.HasPrefix(auth, `OAuth realm="Photos", oauth_consumer_key="dpf43f3p2l4k3l03", `) {
+		t.Errorf("Authorization = %q, want an OAuth signature", auth)
+	}
+}
@@ -0,0 +1,549 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultDocumentTTL is the default of Config.DocumentTTL.
+const defaultDocumentTTL = time.Hour
+
+func (c *Config) documentTTL() time.Duration {
+	if c.DocumentTTL > 0 {
+		return c.DocumentTTL
+	}
+	return defaultDocumentTTL
+}
+
+// VerifyIDToken verifies the signature of an OpenID Connect ID token
+// against the provider's keys, fetched from JWKSURL, and checks that it
+// was issued by Issuer to ClientId and has not expired. It returns the
+// token's claims.
+//
+// Key sets are cached for as long as their Cache-Control header allows,
+// or for DocumentTTL if it says nothing. A token signed with an unknown
+// key ID makes the set be refetched early, at most once a minute.
+// RS256 and ES256 signatures are supported.
+func (c *Config) VerifyIDToken(idToken string) (claims map[string]interface{}, err error) {
+	if c.JWKSURL == "" {
+		return nil, OAuthError{"VerifyIDToken", "no JWKSURL configured"}
+	}
+	if c.Issuer == "" {
+		return nil, OAuthError{"VerifyIDToken", "no Issuer configured"}
+	}
+	header, claims, signed, sig, err := splitJWT(idToken)
+	if err != nil {
+		return nil, err
+	}
+	key, err := jwksCache.key(c.endpointClient(), c.JWKSURL, header.Kid, c.documentTTL())
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(header.Alg, key, signed, sig); err != nil {
+		return nil, err
+	}
+	if iss, _ := claims["iss"].(string); iss != c.Issuer {
+		return nil, OAuthError{"VerifyIDToken", "issuer " + strconv.Quote(iss) + " does not match " + strconv.Quote(c.Issuer)}
+	}
+	if !audienceContains(claims["aud"], c.ClientId) {
+		return nil, OAuthError{"VerifyIDToken", "audience does not include " + strconv.Quote(c.ClientId)}
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return nil, OAuthError{"VerifyIDToken", "missing exp claim"}
+	}
+	if !time.Unix(int64(exp), 0).After(timeNow()) {
+		return nil, OAuthError{"VerifyIDToken", "token expired"}
+	}
+	return claims, nil
+}
+
+// Claims returns the claims of the ID token in the token response,
+// without verifying its signature; use VerifyIDToken for that. A
+// malformed ID token does not fail the exchange or refresh that
+// returned it, since the access token is still usable; Claims reports
+// the problem instead. The raw ID token is available as
+// ExtraString("id_token").
+func (t *Token) Claims() (map[string]interface{}, error) {
+	idToken, ok := t.ExtraString("id_token")
+	if !ok || idToken == "" {
+		return nil, OAuthError{"Claims", "no id_token in token response"}
+	}
+	_, claims, _, _, err := splitJWT(idToken)
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// AMR returns the authentication methods of the "amr" claim of the ID
+// token in the token response, such as "pwd", "otp" or "mfa" (RFC
+// 8176), or nil if it has none. Like Claims, it does not verify the ID
+// token's signature.
+func (t *Token) AMR() []string {
+	claims, _ := t.Claims()
+	v, _ := claims["amr"].([]interface{})
+	var amr []string
+	for _, m := range v {
+		if s, ok := m.(string); ok {
+			amr = append(amr, s)
+		}
+	}
+	return amr
+}
+
+// ACR returns the authentication context class reference of the "acr"
+// claim of the ID token in the token response, or "" if it has none.
+// Like Claims, it does not verify the ID token's signature.
+func (t *Token) ACR() string {
+	claims, _ := t.Claims()
+	acr, _ := claims["acr"].(string)
+	return acr
+}
+
+// ErrInsufficientACR is returned by RequireACR when the user did not
+// authenticate at the required level.
+var ErrInsufficientACR error = OAuthError{"RequireACR", "authentication context class is not the one required"}
+
+// RequireACR returns ErrInsufficientACR unless the ACR of the token's
+// ID token is level, as for an operation that needs the user to have
+// authenticated with a stronger method. The levels an "acr" claim
+// takes are defined by the provider.
+func (t *Token) RequireACR(level string) error {
+	if t.ACR() != level {
+		return ErrInsufficientACR
+	}
+	return nil
+}
+
+// ActorChain returns the actors of a delegated JWT, such as an access
+// or ID token from a token exchange (RFC 8693 section 4.1): the current
+// actor of its "act" claim first, followed by the prior actors nested
+// within it. Each actor is the claims object naming it, typically by
+// "sub", without its nested "act". A JWT without an "act" claim has no
+// actors. The JWT's signature is not verified.
+func ActorChain(jwt string) ([]map[string]interface{}, error) {
+	_, claims, _, _, err := splitJWT(jwt)
+	if err != nil {
+		return nil, err
+	}
+	var chain []map[string]interface{}
+	for act, ok := claims["act"].(map[string]interface{}); ok; act, ok = act["act"].(map[string]interface{}) {
+		actor := make(map[string]interface{}, len(act))
+		for k, v := range act {
+			if k != "act" {
+				actor[k] = v
+			}
+		}
+		chain = append(chain, actor)
+	}
+	return chain, nil
+}
+
+// ErrAuthTooOld is returned by CheckAuthTime when the user last
+// authenticated longer ago than the permitted maximum age.
+var ErrAuthTooOld error = OAuthError{"CheckAuthTime", "authentication is older than max_age"}
+
+// MaxAge returns an AuthCodeOption that sets the OpenID Connect
+// "max_age" parameter, asking the provider to make the user
+// authenticate again if they last did so more than d ago. Check the
+// resulting ID token with CheckAuthTime.
+func MaxAge(d time.Duration) AuthCodeOption {
+	return setParam{"max_age", strconv.FormatInt(int64(d/time.Second), 10)}
+}
+
+// CheckAuthTime checks the auth_time claim of an ID token's claims, as
+// returned by VerifyIDToken, against a maximum age requested with
+// MaxAge. It returns ErrAuthTooOld if the user authenticated more than
+// maxAge ago, and an error if the claim is missing.
+func CheckAuthTime(claims map[string]interface{}, maxAge time.Duration) error {
+	t, ok := claims["auth_time"].(float64)
+	if !ok {
+		return OAuthError{"CheckAuthTime", "missing auth_time claim"}
+	}
+	if timeNow().Sub(time.Unix(int64(t), 0)) > maxAge {
+		return ErrAuthTooOld
+	}
+	return nil
+}
+
+// An IDToken holds the claims of a verified OpenID Connect ID token
+// (OpenID Connect Core 1.0 section 2).
+type IDToken struct {
+	Issuer   string
+	Subject  string
+	Audience []string
+	Expiry   time.Time
+	IssuedAt time.Time // Zero if the token has no iat claim.
+	Nonce    string
+
+	// Claims holds every claim of the ID token, including the above.
+	Claims map[string]interface{}
+}
+
+// newIDToken returns the IDToken for the verified claims.
+func newIDToken(claims map[string]interface{}) *IDToken {
+	id := &IDToken{Claims: claims}
+	id.Issuer, _ = claims["iss"].(string)
+	id.Subject, _ = claims["sub"].(string)
+	id.Nonce, _ = claims["nonce"].(string)
+	switch aud := claims["aud"].(type) {
+	case string:
+		id.Audience = []string{aud}
+	case []interface{}:
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				id.Audience = append(id.Audience, s)
+			}
+		}
+	}
+	if exp, ok := claims["exp"].(float64); ok {
+		id.Expiry = time.Unix(int64(exp), 0)
+	}
+	if iat, ok := claims["iat"].(float64); ok {
+		id.IssuedAt = time.Unix(int64(iat), 0)
+	}
+	return id
+}
+
+// ErrNonceMismatch is returned by CheckNonce when an ID token does not
+// carry the nonce its authorization request was sent with.
+var ErrNonceMismatch error = OAuthError{"CheckNonce", "ID token nonce does not match"}
+
+// Nonce returns an AuthCodeOption that sets the OpenID Connect "nonce"
+// parameter, which the provider copies into the ID token to tie it to
+// this authorization request. Use a fresh value from NewState for each
+// request, and pass the same option to Exchange, or check the resulting
+// ID token with CheckNonce.
+func Nonce(nonce string) AuthCodeOption {
+	return setParam{"nonce", nonce}
+}
+
+// CheckNonce checks the nonce claim of an ID token's claims, as returned
+// by VerifyIDToken, against the value sent with Nonce. It returns
+// ErrNonceMismatch if the claim is missing or different.
+func CheckNonce(claims map[string]interface{}, nonce string) error {
+	n, _ := claims["nonce"].(string)
+	if nonce == "" || subtle.ConstantTimeCompare([]byte(n), []byte(nonce)) != 1 {
+		return ErrNonceMismatch
+	}
+	return nil
+}
+
+// jwtHeader is the JOSE header of a JWT.
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Typ string `json:"typ"`
+}
+
+// splitJWT decodes a compact JWT into its header and claims, and returns
+// the signed portion and the signature for verification.
+func splitJWT(s string) (header *jwtHeader, claims map[string]interface{}, signed string, sig []byte, err error) {
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return nil, nil, "", nil, OAuthError{"splitJWT", "token is not a JWT"}
+	}
+	header = new(jwtHeader)
+	if err := decodeSegment(parts[0], header); err != nil {
+		return nil, nil, "", nil, OAuthError{"splitJWT", "bad header: " + err.Error()}
+	}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, nil, "", nil, OAuthError{"splitJWT", "bad claims: " + err.Error()}
+	}
+	sig, err = base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, nil, "", nil, OAuthError{"splitJWT", "bad signature: " + err.Error()}
+	}
+	return header, claims, parts[0] + "." + parts[1], sig, nil
+}
+
+// decodeSegment decodes a base64url-encoded JSON segment of a JWT into v.
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// verifySignature checks that sig is a valid alg signature of signed.
+func verifySignature(alg string, key crypto.PublicKey, signed string, sig []byte) error {
+	h := sha256.Sum256([]byte(signed))
+	switch alg {
+	case "RS256":
+		k, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return OAuthError{"verifySignature", "RS256 token signed with a non-RSA key"}
+		}
+		if rsa.VerifyPKCS1v15(k, crypto.SHA256, h[:], sig) != nil {
+			return OAuthError{"verifySignature", "invalid signature"}
+		}
+	case "ES256":
+		k, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(sig) != 64 {
+			return OAuthError{"verifySignature", "ES256 token signed with a non-P-256 key"}
+		}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(k, h[:], r, s) {
+			return OAuthError{"verifySignature", "invalid signature"}
+		}
+	default:
+		return OAuthError{"verifySignature", "unsupported algorithm " + strconv.Quote(alg)}
+	}
+	return nil
+}
+
+// audienceContains reports whether the aud claim, a string or an array
+// of strings, includes id.
+func audienceContains(aud interface{}, id string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == id
+	case []interface{}:
+		for _, a := range aud {
+			if a == id {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// A keySet is a fetched JSON Web Key Set.
+type keySet struct {
+	keys       map[string]crypto.PublicKey // by key ID
+	fetched    time.Time
+	expiry     time.Time
+	refreshing bool // a background fetch of its replacement is under way
+}
+
+// keyCache caches key sets by URL.
+type keyCache struct {
+	mu       sync.Mutex
+	sets     map[string]*keySet
+	inflight map[string]*keyFetch // fetches under way, by URL
+}
+
+// A keyFetch is a fetch of a key set that callers wanting the same set
+// wait for instead of fetching it again.
+type keyFetch struct {
+	done chan struct{} // closed once ks and err are set
+	ks   *keySet
+	err  error
+}
+
+var jwksCache = &keyCache{sets: make(map[string]*keySet)}
+
+// unknownKeyInterval is how old a cached key set must be before a key
+// ID it lacks makes key fetch it again. Key IDs come from the tokens
+// being verified, so without a limit anyone could make each
+// verification fetch the set.
+const unknownKeyInterval = time.Minute
+
+// key returns the key with ID kid from the key set at u, fetching the
+// set with client if it is not cached or has expired, or if it lacks
+// kid and was fetched at least unknownKeyInterval ago, as when the
+// provider has rotated its keys. An empty kid matches the only key of a
+// single-key set. A fetched set without a Cache-Control max-age is
+// cached for ttl.
+//
+// Once a set is in the last tenth of its lifetime, its replacement is
+// fetched in the background, so that busy callers do not all wait for
+// the fetch when it expires. Fetches are made without holding the
+// cache's lock, and callers wanting a set that is being fetched wait
+// for that fetch rather than making their own.
+func (kc *keyCache) key(client *http.Client, u, kid string, ttl time.Duration) (crypto.PublicKey, error) {
+	kc.mu.Lock()
+	now := timeNow()
+	ks := kc.sets[u]
+	switch {
+	case ks == nil || now.After(ks.expiry),
+		ks.lookup(kid) == nil && now.Sub(ks.fetched) >= unknownKeyInterval:
+		kc.mu.Unlock()
+		var err error
+		if ks, err = kc.fetch(client, u, ttl); err != nil {
+			return nil, err
+		}
+	case !ks.refreshing && now.After(ks.expiry.Add(-ks.expiry.Sub(ks.fetched)/10)):
+		ks.refreshing = true
+		kc.mu.Unlock()
+		go kc.fetch(client, u, ttl)
+	default:
+		kc.mu.Unlock()
+	}
+	if k := ks.lookup(kid); k != nil {
+		return k, nil
+	}
+	return nil, OAuthError{"VerifyIDToken", unknownKey + strconv.Quote(kid)}
+}
+
+// unknownKey starts the message of the error keyCache.key returns for a
+// key set that has been fetched but lacks the key.
+const unknownKey = "no key with ID "
+
+// isUnknownKey reports whether err is keyCache.key's error for a key
+// the key set lacks, rather than a failure to fetch the set.
+func isUnknownKey(err error) bool {
+	e, ok := err.(OAuthError)
+	return ok && strings.HasPrefix(e.msg, unknownKey)
+}
+
+// fetch fetches the key set at u, or waits for a fetch of it already
+// under way, and caches it. If the fetch fails, the cached set, if any,
+// stays in use until it expires.
+func (kc *keyCache) fetch(client *http.Client, u string, ttl time.Duration) (*keySet, error) {
+	kc.mu.Lock()
+	f := kc.inflight[u]
+	if f == nil {
+		f = &keyFetch{done: make(chan struct{})}
+		if kc.inflight == nil {
+			kc.inflight = make(map[string]*keyFetch)
+		}
+		kc.inflight[u] = f
+		kc.mu.Unlock()
+		f.ks, f.err = fetchKeySet(client, u, ttl)
+		kc.mu.Lock()
+		delete(kc.inflight, u)
+		if f.err == nil {
+			kc.sets[u] = f.ks
+		} else if old := kc.sets[u]; old != nil {
+			old.refreshing = false
+		}
+		close(f.done)
+	}
+	kc.mu.Unlock()
+	<-f.done
+	return f.ks, f.err
+}
+
+func (ks *keySet) lookup(kid string) crypto.PublicKey {
+	if kid == "" && len(ks.keys) == 1 {
+		for _, k := range ks.keys {
+			return k
+		}
+	}
+	return ks.keys[kid]
+}
+
+// fetchKeySet fetches the key set at u with client and decodes it. It
+// expires after ttl unless its Cache-Control header says otherwise.
+func fetchKeySet(client *http.Client, u string, ttl time.Duration) (*keySet, error) {
+	r, err := client.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != 200 {
+		return nil, OAuthError{"fetchKeySet", r.Status}
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	var b struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(body, &b); err != nil {
+		return nil, OAuthError{"fetchKeySet", err.Error()}
+	}
+	now := timeNow()
+	ks := &keySet{
+		keys:    make(map[string]crypto.PublicKey),
+		fetched: now,
+		expiry:  now.Add(maxAge(r.Header, ttl)),
+	}
+	for _, k := range b.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if pub := k.publicKey(); pub != nil {
+			ks.keys[k.Kid] = pub
+		}
+	}
+	return ks, nil
+}
+
+// maxAge returns the freshness lifetime given by the Cache-Control header
+// of h, or def if it has none. no-store and no-cache mean zero.
+func maxAge(h http.Header, def time.Duration) time.Duration {
+	for _, d := range strings.Split(h.Get("Cache-Control"), ",") {
+		d = strings.ToLower(strings.TrimSpace(d))
+		switch {
+		case d == "no-store" || d == "no-cache":
+			return 0
+		case strings.HasPrefix(d, "max-age="):
+			if n, err := strconv.Atoi(d[len("max-age="):]); err == nil && n >= 0 {
+				return time.Duration(n) * time.Second
+			}
+		}
+	}
+	return def
+}
+
+// jsonWebKey is the JSON representation of a public key (RFC 7517).
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey returns the key k describes, or nil if it is malformed or of
+// an unsupported type.
+func (k *jsonWebKey) publicKey() crypto.PublicKey {
+	switch k.Kty {
+	case "RSA":
+		n, err1 := base64.RawURLEncoding.DecodeString(k.N)
+		e, err2 := base64.RawURLEncoding.DecodeString(k.E)
+		if err1 != nil || err2 != nil || len(e) == 0 || len(e) > 4 {
+			return nil
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil
+		}
+		x, err1 := base64.RawURLEncoding.DecodeString(k.X)
+		y, err2 := base64.RawURLEncoding.DecodeString(k.Y)
+		if err1 != nil || err2 != nil {
+			return nil
+		}
+		pub := &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		if _, err := pub.ECDH(); err != nil {
+			return nil // not on the curve
+		}
+		return pub
+	}
+	return nil
+}
@@ -0,0 +1,485 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var (
+	testRSAKey, _ = rsa.GenerateKey(rand.Reader, 2048)
+	testECKey, _  = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+)
+
+// signTestJWT returns a JWT with the given claims signed by key.
+func signTestJWT(t *testing.T, key crypto.Signer, kid string, claims map[string]interface{}) string {
+	return signTestJWTType(t, key, kid, "JWT", claims)
+}
+
+// signTestJWTType is like signTestJWT with the "typ" header typ.
+func signTestJWTType(t *testing.T, key crypto.Signer, kid, typ string, claims map[string]interface{}) string {
+	alg := "RS256"
+	if _, ok := key.(*ecdsa.PrivateKey); ok {
+		alg = "ES256"
+	}
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": typ})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	h := sha256.Sum256([]byte(signed))
+	var sig []byte
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		sig, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, h[:])
+	case *ecdsa.PrivateKey:
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, key, h[:])
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func b64(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+// newJWKSServer serves the public halves of testRSAKey and testECKey and
+// counts the requests it receives.
+func newJWKSServer(t *testing.T, fetches *int) *httptest.Server {
+	jwks, _ := json.Marshal(map[string]interface{}{"keys": []map[string]string{
+		{
+			"kty": "RSA", "kid": "rsa1", "use": "sig",
+			"n": b64(testRSAKey.N.Bytes()),
+			"e": b64(big.NewInt(int64(testRSAKey.E)).Bytes()),
+		},
+		{
+			"kty": "EC", "kid": "ec1", "crv": "P-256",
+			"x": b64(testECKey.X.FillBytes(make([]byte, 32))),
+			"y": b64(testECKey.Y.FillBytes(make([]byte, 32))),
+		},
+	}})
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*fetches++
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		w.Write(jwks)
+	}))
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	fetches := 0
+	server := newJWKSServer(t, &fetches)
+	defer server.Close()
+
+	config := &Config{
+		ClientId: "cl13nt1d",
+		Issuer:   "https://issuer.example.net",
+		JWKSURL:  server.URL + "/jwks",
+	}
+	claims := func(mod func(map[string]interface{})) map[string]interface{} {
+		c := map[string]interface{}{
+			"iss": config.Issuer,
+			"aud": []string{"other", "cl13nt1d"},
+			"sub": "user1",
+			"exp": time.Now().Add(time.Hour).Unix(),
+		}
+		if mod != nil {
+			mod(c)
+		}
+		return c
+	}
+
+	for _, tt := range []struct {
+		name  string
+		token string
+		ok    bool
+	}{
+		{"RS256", signTestJWT(t, testRSAKey, "rsa1", claims(nil)), true},
+		{"ES256", signTestJWT(t, testECKey, "ec1", claims(nil)), true},
+		{"wrong key", signTestJWT(t, testECKey, "rsa1", claims(nil)), false},
+		{"unknown kid", signTestJWT(t, testRSAKey, "rsa2", claims(nil)), false},
+		{"issuer", signTestJWT(t, testRSAKey, "rsa1", claims(func(c map[string]interface{}) {
+			c["iss"] = "https://evil.example.net"
+		})), false},
+		{"audience", signTestJWT(t, testRSAKey, "rsa1", claims(func(c map[string]interface{}) {
+			c["aud"] = "other"
+		})), false},
+		{"expired", signTestJWT(t, testRSAKey, "rsa1", claims(func(c map[string]interface{}) {
+			c["exp"] = time.Now().Add(-time.Minute).Unix()
+		})), false},
+	} {
+		got, err := config.VerifyIDToken(tt.token)
+		if tt.ok {
+			if err != nil {
+				t.Errorf("%s: VerifyIDToken: %v", tt.name, err)
+			} else if got["sub"] != "user1" {
+				t.Errorf("%s: sub = %v, want user1", tt.name, got["sub"])
+			}
+		} else if err == nil {
+			t.Errorf("%s: VerifyIDToken succeeded, want error", tt.name)
+		}
+	}
+
+	// The key set is cached, and the unknown key ID does not make a
+	// freshly fetched set be fetched again.
+	if fetches != 1 {
+		t.Errorf("JWKS fetched %d times, want 1", fetches)
+	}
+
+	// Once the set is older than unknownKeyInterval, an unknown key ID
+	// refetches it, in case the keys were rotated, but only once per
+	// interval.
+	defer func(f func() time.Time) { timeNow = f }(timeNow)
+	now := time.Now().Add(2 * unknownKeyInterval)
+	timeNow = func() time.Time { return now }
+	for i := 0; i < 3; i++ {
+		if _, err := config.VerifyIDToken(signTestJWT(t, testRSAKey, "rsa2", claims(nil))); err == nil {
+			t.Errorf("VerifyIDToken with an unknown kid succeeded")
+		}
+	}
+	if fetches != 2 {
+		t.Errorf("JWKS fetched %d times after unknown key IDs, want 2", fetches)
+	}
+}
+
+func TestKeyCacheFetch(t *testing.T) {
+	var fetches int32
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"keys":[]}`)
+	}))
+	defer slow.Close()
+	n := 0
+	fast := newJWKSServer(t, &n)
+	defer fast.Close()
+
+	kc := &keyCache{sets: make(map[string]*keySet)}
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := kc.key(http.DefaultClient, slow.URL, "k1", time.Hour); !isUnknownKey(err) {
+				t.Errorf("key from the slow key set: err = %v, want unknown key", err)
+			}
+		}()
+	}
+
+	// A slow key set does not hold up keys from other sets.
+	done := make(chan error, 1)
+	go func() {
+		_, err := kc.key(http.DefaultClient, fast.URL, "rsa1", time.Hour)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("key from the fast key set: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("key from the fast key set waited for the slow one")
+	}
+	close(release)
+	wg.Wait()
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Errorf("slow key set fetched %d times by concurrent callers, want 1", n)
+	}
+}
+
+func TestMaxAge(t *testing.T) {
+	config := &Config{AuthURL: "https://example.com/auth"}
+	u, err := url.Parse(config.AuthCodeURL("st4t3", MaxAge(10*time.Minute)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, w := u.Query().Get("max_age"), "600"; g != w {
+		t.Errorf("max_age = %q, want %q", g, w)
+	}
+
+	now := time.Now()
+	recent := map[string]interface{}{"auth_time": float64(now.Add(-5 * time.Minute).Unix())}
+	if err := CheckAuthTime(recent, 10*time.Minute); err != nil {
+		t.Errorf("auth_time 5m ago: %v", err)
+	}
+	stale := map[string]interface{}{"auth_time": float64(now.Add(-time.Hour).Unix())}
+	if err := CheckAuthTime(stale, 10*time.Minute); err != ErrAuthTooOld {
+		t.Errorf("auth_time 1h ago: err = %v, want ErrAuthTooOld", err)
+	}
+	if err := CheckAuthTime(map[string]interface{}{}, 10*time.Minute); err == nil {
+		t.Errorf("missing auth_time: no error")
+	}
+}
+
+func TestTokenClaims(t *testing.T) {
+	idToken := signTestJWT(t, testRSAKey, "rsa1", map[string]interface{}{"sub": "alice"})
+	for _, tt := range []struct {
+		name, idToken string
+		ok            bool
+	}{
+		{"valid", idToken, true},
+		{"malformed", "not-a-jwt", false},
+		{"bad claims", "e30.!!!.", false},
+	} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"access_token":  "token1",
+				"refresh_token": "refreshtoken1",
+				"expires_in":    3600,
+				"id_token":      tt.idToken,
+			})
+		}))
+		transport := &Transport{Config: &Config{TokenURL: server.URL}}
+		tok, err := transport.Exchange("c0d3")
+		server.Close()
+		if err != nil {
+			t.Errorf("%s: Exchange: %v", tt.name, err)
+			continue
+		}
+		checkToken(t, tok, "token1", "refreshtoken1")
+		if s, _ := tok.ExtraString("id_token"); s != tt.idToken {
+			t.Errorf("%s: raw id_token = %q, want %q", tt.name, s, tt.idToken)
+		}
+		claims, err := tok.Claims()
+		if tt.ok && (err != nil || claims["sub"] != "alice") {
+			t.Errorf("%s: Claims = %v, %v; want sub alice", tt.name, claims, err)
+		}
+		if !tt.ok && err == nil {
+			t.Errorf("%s: Claims succeeded, want an error", tt.name)
+		}
+	}
+
+	if _, err := (&Token{AccessToken: "token1"}).Claims(); err == nil {
+		t.Errorf("Claims without an id_token succeeded")
+	}
+}
+
+func TestAuthenticationStrength(t *testing.T) {
+	mfa := &Token{raw: map[string]interface{}{"id_token": signTestJWT(t, testRSAKey, "rsa1", map[string]interface{}{
+		"sub": "alice",
+		"acr": "urn:example:loa:3",
+		"amr": []string{"pwd", "otp", "mfa"},
+	})}}
+	if got := mfa.AMR(); fmt.Sprint(got) != "[pwd otp mfa]" {
+		t.Errorf("AMR = %v, want [pwd otp mfa]", got)
+	}
+	if got := mfa.ACR(); got != "urn:example:loa:3" {
+		t.Errorf("ACR = %q, want urn:example:loa:3", got)
+	}
+	if err := mfa.RequireACR("urn:example:loa:3"); err != nil {
+		t.Errorf("RequireACR: %v", err)
+	}
+
+	pwd := &Token{raw: map[string]interface{}{"id_token": signTestJWT(t, testRSAKey, "rsa1", map[string]interface{}{
+		"sub": "alice",
+		"acr": "urn:example:loa:1",
+	})}}
+	if err := pwd.RequireACR("urn:example:loa:3"); err != ErrInsufficientACR {
+		t.Errorf("RequireACR with a lower level = %v, want ErrInsufficientACR", err)
+	}
+	if amr := pwd.AMR(); amr != nil {
+		t.Errorf("AMR without an amr claim = %v, want nil", amr)
+	}
+	none := &Token{AccessToken: "token1"}
+	if acr, err := none.ACR(), none.RequireACR("urn:example:loa:1"); acr != "" || err != ErrInsufficientACR {
+		t.Errorf("without an id_token: ACR = %q, RequireACR = %v; want \"\", ErrInsufficientACR", acr, err)
+	}
+}
+
+func TestActorChain(t *testing.T) {
+	delegated := signTestJWT(t, testRSAKey, "rsa1", map[string]interface{}{
+		"sub": "user@example.com",
+		"act": map[string]interface{}{"sub": "admin@example.com"},
+	})
+	chain, err := ActorChain(delegated)
+	if err != nil {
+		t.Fatalf("ActorChain: %v", err)
+	}
+	if len(chain) != 1 || chain[0]["sub"] != "admin@example.com" {
+		t.Errorf("ActorChain = %v, want [admin@example.com]", chain)
+	}
+
+	nested := signTestJWT(t, testRSAKey, "rsa1", map[string]interface{}{
+		"sub": "user@example.com",
+		"act": map[string]interface{}{
+			"sub": "service16",
+			"act": map[string]interface{}{"sub": "service77"},
+		},
+	})
+	if chain, err = ActorChain(nested); err != nil || len(chain) != 2 || chain[0]["sub"] != "service16" || chain[1]["sub"] != "service77" || chain[0]["act"] != nil {
+		t.Errorf("ActorChain(nested) = %v, %v; want [service16 service77]", chain, err)
+	}
+
+	plain := signTestJWT(t, testRSAKey, "rsa1", map[string]interface{}{"sub": "user@example.com"})
+	if chain, err = ActorChain(plain); err != nil || len(chain) != 0 {
+		t.Errorf("ActorChain without act = %v, %v; want none", chain, err)
+	}
+	if _, err = ActorChain("not-a-jwt"); err == nil {
+		t.Errorf("ActorChain of a malformed token succeeded")
+	}
+}
+
+func TestExchangeStartsNewSession(t *testing.T) {
+	fetches := 0
+	jwks := newJWKSServer(t, &fetches)
+	defer jwks.Close()
+
+	var body map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(body)
+	}))
+	defer server.Close()
+
+	config := &Config{
+		ClientId: "cl13nt1d",
+		TokenURL: server.URL,
+		Issuer:   "https://issuer.example.net",
+		JWKSURL:  jwks.URL,
+	}
+	body = map[string]interface{}{
+		"access_token":  "token1",
+		"refresh_token": "refreshtoken1",
+		"scope":         "openid",
+		"session_state": "s1",
+		"expires_in":    3600,
+		"id_token": signTestJWT(t, testRSAKey, "rsa1", map[string]interface{}{
+			"iss":   config.Issuer,
+			"aud":   "cl13nt1d",
+			"sub":   "user1",
+			"nonce": "n1",
+			"exp":   time.Now().Add(time.Hour).Unix(),
+		}),
+	}
+	transport := &Transport{Config: config}
+	if tok, err := transport.Exchange("c0d3", Nonce("n1")); err != nil || tok.IDToken == nil {
+		t.Fatalf("first Exchange: %v", err)
+	}
+
+	// The second session's response has no id_token: nothing of the
+	// first session but its refresh token may survive.
+	body = map[string]interface{}{"access_token": "token2", "expires_in": 3600}
+	tok, err := transport.Exchange("c0d3")
+	if err != nil {
+		t.Fatalf("second Exchange: %v", err)
+	}
+	checkToken(t, tok, "token2", "refreshtoken1")
+	if tok.IDToken != nil || tok.Extra("id_token") != nil || tok.Extra("session_state") != nil || tok.GrantedScope != "" {
+		t.Errorf("second Exchange kept the first session's IDToken %+v, extras or scope %q", tok.IDToken, tok.GrantedScope)
+	}
+}
+
+func TestExchangeVerifiesIDToken(t *testing.T) {
+	fetches := 0
+	jwks := newJWKSServer(t, &fetches)
+	defer jwks.Close()
+
+	var idToken string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "4cc3ss",
+			"expires_in":   3600,
+			"id_token":     idToken,
+		})
+	}))
+	defer server.Close()
+
+	config := &Config{
+		ClientId:       "cl13nt1d",
+		TokenURL:       server.URL,
+		Issuer:         "https://issuer.example.net",
+		JWKSURL:        jwks.URL,
+		VerifyIDTokens: true,
+	}
+	claims := map[string]interface{}{
+		"iss":   config.Issuer,
+		"aud":   "cl13nt1d",
+		"sub":   "user1",
+		"nonce": "n0nc3",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}
+
+	idToken = signTestJWT(t, testRSAKey, "rsa1", claims)
+	transport := &Transport{Config: config}
+	tok, err := transport.Exchange("c0d3")
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	got, err := tok.Claims()
+	if err != nil || got["sub"] != "user1" {
+		t.Fatalf("Claims = %v, %v; want sub user1", got, err)
+	}
+	if err := CheckNonce(got, "n0nc3"); err != nil {
+		t.Errorf("CheckNonce: %v", err)
+	}
+	if err := CheckNonce(got, "0th3r"); err != ErrNonceMismatch {
+		t.Errorf("CheckNonce with wrong nonce: err = %v, want ErrNonceMismatch", err)
+	}
+	if id := tok.IDToken; id == nil || id.Subject != "user1" || id.Issuer != config.Issuer || !reflect.DeepEqual(id.Audience, []string{"cl13nt1d"}) || id.Nonce != "n0nc3" || id.Expiry.IsZero() {
+		t.Errorf("IDToken = %+v", tok.IDToken)
+	}
+
+	// Exchange checks the nonce passed to it, verifying the ID token
+	// even without VerifyIDTokens.
+	config.VerifyIDTokens = false
+	if tok, err := (&Transport{Config: config}).Exchange("c0d3", Nonce("n0nc3")); err != nil || tok.IDToken == nil {
+		t.Errorf("Exchange with the nonce sent: %v", err)
+	}
+	if _, err := (&Transport{Config: config}).Exchange("c0d3", Nonce("0th3r")); err != ErrNonceMismatch {
+		t.Errorf("Exchange with another nonce: err = %v, want ErrNonceMismatch", err)
+	}
+	if tok, err := (&Transport{Config: config}).Exchange("c0d3"); err != nil {
+		t.Errorf("Exchange without verification: %v", err)
+	} else if tok.IDToken != nil {
+		t.Errorf("Exchange without verification: IDToken = %+v, want nil", tok.IDToken)
+	}
+	config.VerifyIDTokens = true
+
+	claims["aud"] = "other"
+	idToken = signTestJWT(t, testRSAKey, "rsa1", claims)
+	if _, err := transport.Exchange("c0d3"); err == nil {
+		t.Errorf("Exchange accepted an ID token for another audience")
+	}
+	if transport.AccessToken != "4cc3ss" || transport.Extra("id_token") == idToken {
+		t.Errorf("failed Exchange replaced the Transport's token")
+	}
+
+	idToken = ""
+	if _, err := (&Transport{Config: config}).Exchange("c0d3"); err == nil {
+		t.Errorf("Exchange succeeded without an ID token")
+	}
+
+	u, _ := url.Parse(config.AuthCodeURL("st4t3", Nonce("n0nc3")))
+	if g := u.Query().Get("nonce"); g != "n0nc3" {
+		t.Errorf("nonce = %q, want n0nc3", g)
+	}
+}
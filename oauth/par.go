@@ -0,0 +1,83 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+)
+
+// PushedAuthorizationRequest sends the parameters of an authorization
+// request, as AuthCodeURL would put them in its URL, to the Config's
+// PARURL (RFC 9126), authenticated with the client credentials. It
+// returns the request URI the provider issues for them, to redirect the
+// user to with PushedAuthCodeURL.
+func (c *Config) PushedAuthorizationRequest(state string, opts ...AuthCodeOption) (requestURI string, err error) {
+	return c.PushedAuthorizationRequestContext(context.Background(), state, opts...)
+}
+
+// PushedAuthorizationRequestContext is like PushedAuthorizationRequest
+// but makes its request with ctx.
+func (c *Config) PushedAuthorizationRequestContext(ctx context.Context, state string, opts ...AuthCodeOption) (requestURI string, err error) {
+	if c.PARURL == "" {
+		return "", OAuthError{"PushedAuthorizationRequest", "no PARURL configured"}
+	}
+	t := &Transport{Config: c}
+	requestURI, err = t.pushAuthorizationRequest(ctx, c.authParams(state, opts))
+	t.audit(ctx, "par", c.ClientId, err)
+	return requestURI, err
+}
+
+// AuthCodeURLContext returns the URL to send the user to for an
+// authorization request. If the Config has a PARURL, as providers
+// following the FAPI profiles do, the request is pushed there first and
+// the URL names it by its request URI alone; otherwise it is the URL
+// AuthCodeURL returns.
+func (c *Config) AuthCodeURLContext(ctx context.Context, state string, opts ...AuthCodeOption) (string, error) {
+	if c.PARURL == "" {
+		return c.AuthCodeURL(state, opts...), nil
+	}
+	requestURI, err := c.PushedAuthorizationRequestContext(ctx, state, opts...)
+	if err != nil {
+		return "", err
+	}
+	return c.PushedAuthCodeURL(requestURI), nil
+}
+
+func (t *Transport) pushAuthorizationRequest(ctx context.Context, v url.Values) (string, error) {
+	r, err := t.postForm(ctx, t.Config, t.PARURL, v, &clientAuth{t.endpointAuthStyle(), t.ClientId, t.ClientSecret})
+	if err != nil {
+		return "", err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != 201 && r.StatusCode != 200 {
+		return "", retrieveError(r)
+	}
+	body, err := readBody(r.Body, t.maxResponseBytes())
+	if err != nil {
+		return "", err
+	}
+	var b struct {
+		RequestURI string `json:"request_uri"`
+	}
+	if err := json.Unmarshal(body, &b); err != nil {
+		return "", OAuthError{"PushedAuthorizationRequest", err.Error()}
+	}
+	if b.RequestURI == "" {
+		return "", OAuthError{"PushedAuthorizationRequest", "no request_uri in response"}
+	}
+	return b.RequestURI, nil
+}
+
+// PushedAuthCodeURL returns the URL to send the user to for an
+// authorization request pushed with PushedAuthorizationRequest, which
+// names the request by requestURI alone.
+func (c *Config) PushedAuthCodeURL(requestURI string) string {
+	return c.authorizeURL(url.Values{
+		"client_id":   {c.ClientId},
+		"request_uri": {requestURI},
+	})
+}
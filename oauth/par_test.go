@@ -0,0 +1,69 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestPushedAuthorizationRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id, secret, _ := r.BasicAuth(); r.FormValue("client_id")+id != "cl13nt1d" || r.FormValue("client_secret")+secret != "s3cr3t" {
+			t.Errorf("request not authenticated as the client")
+		}
+		if r.FormValue("state") != "st4t3" || r.FormValue("response_type") != "code" || r.FormValue("login_hint") != "alice" {
+			t.Errorf("pushed parameters = %v", r.Form)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, `{"request_uri":"urn:ietf:params:oauth:request_uri:6esc_11ACC5bwc014ltc14eY22c","expires_in":60}`)
+	}))
+	defer server.Close()
+
+	config := &Config{
+		ClientId:     "cl13nt1d",
+		ClientSecret: "s3cr3t",
+		AuthURL:      "https://example.com/auth?tenant=t1",
+		PARURL:       server.URL,
+	}
+	requestURI, err := config.PushedAuthorizationRequest("st4t3", LoginHint("alice"))
+	if err != nil {
+		t.Fatalf("PushedAuthorizationRequest: %v", err)
+	}
+	if g, w := requestURI, "urn:ietf:params:oauth:request_uri:6esc_11ACC5bwc014ltc14eY22c"; g != w {
+		t.Errorf("request URI = %q, want %q", g, w)
+	}
+	var log auditLog
+	config.AuditSink = &log
+	u, err := url.Parse(config.PushedAuthCodeURL(requestURI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(log) != 1 || log[0].Flow != "authorize" || log[0].ClientId != "cl13nt1d" {
+		t.Errorf("PushedAuthCodeURL audit events = %+v, want one authorize event", log)
+	}
+	config.AuditSink = nil
+	q := u.Query()
+	if q.Get("request_uri") != requestURI || q.Get("client_id") != "cl13nt1d" || q.Get("tenant") != "t1" || q.Get("state") != "" {
+		t.Errorf("PushedAuthCodeURL = %s", u)
+	}
+
+	authURL, err := config.AuthCodeURLContext(context.Background(), "st4t3", LoginHint("alice"))
+	if err != nil {
+		t.Fatalf("AuthCodeURLContext: %v", err)
+	}
+	if authURL != u.String() {
+		t.Errorf("AuthCodeURLContext = %s, want %s", authURL, u)
+	}
+	config.PARURL = ""
+	if authURL, err = config.AuthCodeURLContext(context.Background(), "st4t3"); err != nil || authURL != config.AuthCodeURL("st4t3") {
+		t.Errorf("AuthCodeURLContext without PARURL = %s, %v; want AuthCodeURL's", authURL, err)
+	}
+}
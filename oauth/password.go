@@ -0,0 +1,51 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"context"
+	"net/url"
+)
+
+// PasswordCredentials obtains a Token with the resource owner password
+// credentials grant (RFC 6749 section 4.3), exchanging the user's
+// username and password for it, and stores it in the Transport (and
+// its cache, if any) like Exchange. Later requests refresh the Token
+// with its refresh token as usual. The grant is meant only for trusted
+// first-party applications of providers that do not support a
+// redirect-based flow; the password is not kept.
+func (t *Transport) PasswordCredentials(username, password string) (*Token, error) {
+	return t.PasswordCredentialsContext(context.Background(), username, password)
+}
+
+// PasswordCredentialsContext is like PasswordCredentials but makes the
+// token request with ctx, so that it can be cancelled or given a
+// deadline.
+func (t *Transport) PasswordCredentialsContext(ctx context.Context, username, password string) (*Token, error) {
+	if t.config() == nil {
+		return nil, OAuthError{"PasswordCredentials", "no Config supplied"}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var prev Token
+	if t.Token != nil {
+		prev = *t.Token
+	}
+	tok := new(Token)
+	v := url.Values{
+		"grant_type": {"password"},
+		"username":   {username},
+		"password":   {password},
+	}
+	if scope := t.requestedScope(); scope != "" {
+		v.Set("scope", scope)
+	}
+	if err := t.updateToken(ctx, tok, v); err != nil {
+		return nil, err
+	}
+	t.Token = tok
+	return tok, t.cacheToken(&prev, tok)
+}
@@ -0,0 +1,75 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPasswordCredentials(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.FormValue("grant_type") {
+		case "password":
+			if r.FormValue("username") != "alice" || r.FormValue("password") != "hunter2" {
+				w.WriteHeader(http.StatusBadRequest)
+				io.WriteString(w, `{"error":"invalid_grant"}`)
+				return
+			}
+			if g := r.FormValue("scope"); g != "profile" {
+				t.Errorf("scope = %q, want profile", g)
+			}
+			io.WriteString(w, `{"access_token":"token1","refresh_token":"refreshtoken1","expires_in":3600}`)
+		case "refresh_token":
+			if g := r.FormValue("refresh_token"); g != "refreshtoken1" {
+				t.Errorf("refresh_token = %q, want refreshtoken1", g)
+			}
+			io.WriteString(w, `{"access_token":"token2","expires_in":3600}`)
+		default:
+			t.Errorf("unexpected grant_type %q", r.FormValue("grant_type"))
+		}
+	}))
+	defer server.Close()
+
+	cache := &countingCache{}
+	transport := &Transport{Config: &Config{TokenURL: server.URL, Scope: "profile", TokenCache: cache}}
+	if _, err := transport.PasswordCredentials("alice", "wrong"); err == nil {
+		t.Errorf("PasswordCredentials with a wrong password succeeded")
+	}
+	tok, err := transport.PasswordCredentials("alice", "hunter2")
+	if err != nil {
+		t.Fatalf("PasswordCredentials: %v", err)
+	}
+	checkToken(t, tok, "token1", "refreshtoken1")
+	if transport.Token != tok || cache.puts != 1 {
+		t.Errorf("Token not stored in the Transport and its cache (%d puts)", cache.puts)
+	}
+	if err := transport.Refresh(); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	checkToken(t, transport.Token, "token2", "refreshtoken1")
+}
+
+func TestPasswordCredentialsContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("token request made with a cancelled context")
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	transport := &Transport{Config: &Config{TokenURL: server.URL}}
+	if _, err := transport.PasswordCredentialsContext(ctx, "alice", "hunter2"); !errors.Is(err, context.Canceled) {
+		t.Errorf("PasswordCredentialsContext error = %v, want %v", err, context.Canceled)
+	}
+	if transport.Token != nil {
+		t.Errorf("Token stored after a failed request")
+	}
+}
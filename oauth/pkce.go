@@ -0,0 +1,149 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"io"
+	"net/url"
+)
+
+// ErrStateMismatch is returned by CompleteAuth and ExchangeWithState
+// when the state returned with the authorization code is not the one
+// sent with the authorization request.
+var ErrStateMismatch error = OAuthError{"CompleteAuth", "state mismatch"}
+
+// A Verifier is a PKCE code verifier (RFC 7636).
+type Verifier string
+
+// NewVerifier returns a new random code verifier.
+func NewVerifier() (Verifier, error) {
+	return newVerifier(rand.Reader)
+}
+
+func newVerifier(r io.Reader) (Verifier, error) {
+	s, err := randomString(r, 32)
+	return Verifier(s), err
+}
+
+// Challenge returns the S256 code challenge derived from v.
+func (v Verifier) Challenge() string {
+	h := sha256.Sum256([]byte(v))
+	return base64.RawURLEncoding.EncodeToString(h[:])
+}
+
+// CodeChallenge returns an AuthCodeOption that sends the S256 challenge
+// of v with the authorization request.
+func CodeChallenge(v Verifier) AuthCodeOption {
+	return codeChallenge(v)
+}
+
+type codeChallenge Verifier
+
+func (c codeChallenge) setValue(m url.Values) {
+	m.Set("code_challenge", Verifier(c).Challenge())
+	m.Set("code_challenge_method", "S256")
+}
+
+// PlainCodeChallenge returns an AuthCodeOption that sends v itself as
+// the challenge, with the "plain" method. RFC 7636 allows it only for
+// clients that cannot compute SHA-256; prefer CodeChallenge.
+func PlainCodeChallenge(v Verifier) AuthCodeOption {
+	return plainCodeChallenge(v)
+}
+
+type plainCodeChallenge Verifier
+
+func (c plainCodeChallenge) setValue(m url.Values) {
+	m.Set("code_challenge", string(c))
+	m.Set("code_challenge_method", "plain")
+}
+
+// CodeVerifier returns an AuthCodeOption that sends v with the token
+// request made by Exchange, proving that the caller started the
+// authorization request.
+func CodeVerifier(v Verifier) AuthCodeOption {
+	return setParam{"code_verifier", string(v)}
+}
+
+// NewState returns a new random value for the state parameter of an
+// authorization request, for protection against cross-site request
+// forgery.
+func NewState() (string, error) {
+	return newState(rand.Reader)
+}
+
+func newState(r io.Reader) (string, error) {
+	return randomString(r, 16)
+}
+
+// randomString returns n bytes read from r, base64url-encoded.
+func randomString(r io.Reader, n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", OAuthError{"randomString", err.Error()}
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func (c *Config) rand() io.Reader {
+	if c.Rand != nil {
+		return c.Rand
+	}
+	return rand.Reader
+}
+
+// BeginAuth starts an authorization code flow with PKCE. It returns the
+// URL to send the user to, along with the verifier and state that the
+// caller must keep until the user returns and pass to CompleteAuth.
+// Both are generated from the Config's Rand.
+func (c *Config) BeginAuth(opts ...AuthCodeOption) (authURL string, verifier Verifier, state string, err error) {
+	if verifier, err = newVerifier(c.rand()); err != nil {
+		return "", "", "", err
+	}
+	if state, err = newState(c.rand()); err != nil {
+		return "", "", "", err
+	}
+	opts = append([]AuthCodeOption{CodeChallenge(verifier)}, opts...)
+	return c.AuthCodeURL(state, opts...), verifier, state, nil
+}
+
+// CompleteAuth finishes a flow started by BeginAuth. It checks that
+// state, as returned with the authorization code, matches wantState,
+// the state BeginAuth returned, and exchanges code using verifier.
+func (t *Transport) CompleteAuth(code, state, wantState string, verifier Verifier) (*Token, error) {
+	return t.ExchangeWithState(code, state, wantState, CodeVerifier(verifier))
+}
+
+// ExchangeWithState is like Exchange, but first checks that
+// returnedState, the state returned with the authorization code,
+// matches expectedState, the state sent with the authorization request.
+// It refuses the exchange with ErrStateMismatch if they differ or
+// expectedState is empty.
+func (t *Transport) ExchangeWithState(code, returnedState, expectedState string, opts ...AuthCodeOption) (*Token, error) {
+	if expectedState == "" || subtle.ConstantTimeCompare([]byte(returnedState), []byte(expectedState)) != 1 {
+		return nil, ErrStateMismatch
+	}
+	return t.Exchange(code, opts...)
+}
+
+// CompleteAuthCode exchanges code using verifier, as kept by a web
+// application in its session since it sent the user to authorize. If
+// redirectURI is not empty it is sent in place of the Config's
+// RedirectURL; it must match the redirect URI of the authorization
+// request.
+func (t *Transport) CompleteAuthCode(code string, verifier Verifier, redirectURI string) (*Token, error) {
+	if verifier == "" {
+		return nil, OAuthError{"CompleteAuthCode", "no code verifier supplied"}
+	}
+	opts := []AuthCodeOption{CodeVerifier(verifier)}
+	if redirectURI != "" {
+		opts = append(opts, setParam{"redirect_uri", redirectURI})
+	}
+	return t.Exchange(code, opts...)
+}
@@ -0,0 +1,176 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestVerifierChallenge(t *testing.T) {
+	// RFC 7636 appendix B.
+	v := Verifier("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk")
+	if g, w := v.Challenge(), "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"; g != w {
+		t.Errorf("Challenge = %q, want %q", g, w)
+	}
+}
+
+func TestCodeChallengeMethods(t *testing.T) {
+	v := Verifier("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk")
+	c := &Config{ClientId: "cl13nt1d", AuthURL: "https://example.com/auth"}
+	for _, tt := range []struct {
+		opt               AuthCodeOption
+		challenge, method string
+	}{
+		{CodeChallenge(v), v.Challenge(), "S256"},
+		{PlainCodeChallenge(v), string(v), "plain"},
+	} {
+		u, err := url.Parse(c.AuthCodeURL("st4t3", tt.opt))
+		if err != nil {
+			t.Fatal(err)
+		}
+		q := u.Query()
+		if g := q.Get("code_challenge"); g != tt.challenge {
+			t.Errorf("code_challenge = %q, want %q", g, tt.challenge)
+		}
+		if g := q.Get("code_challenge_method"); g != tt.method {
+			t.Errorf("code_challenge_method = %q, want %q", g, tt.method)
+		}
+	}
+}
+
+func TestBeginCompleteAuth(t *testing.T) {
+	challenges := make(map[string]string) // by code
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if Verifier(r.PostFormValue("code_verifier")).Challenge() != challenges[r.PostFormValue("code")] {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"error":"invalid_grant"}`)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"access_token":"token1","refresh_token":"refreshtoken1","expires_in":3600}`)
+	}))
+	defer server.Close()
+
+	config := &Config{ClientId: "cl13nt1d", AuthURL: "https://example.com/auth", TokenURL: server.URL}
+	authURL, verifier, state, err := config.BeginAuth()
+	if err != nil {
+		t.Fatalf("BeginAuth: %v", err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("state") != state || q.Get("code_challenge_method") != "S256" {
+		t.Fatalf("auth URL %s lacks state or S256 challenge", authURL)
+	}
+	// The provider remembers the challenge with the code it issues.
+	challenges["c0d3"] = q.Get("code_challenge")
+
+	transport := &Transport{Config: config}
+	if _, err := transport.CompleteAuth("c0d3", "forged", state, verifier); err != ErrStateMismatch {
+		t.Errorf("CompleteAuth with wrong state: err = %v, want ErrStateMismatch", err)
+	}
+	other, _ := NewVerifier()
+	if _, err := transport.CompleteAuth("c0d3", state, state, other); err == nil {
+		t.Errorf("CompleteAuth with wrong verifier succeeded")
+	}
+	tok, err := transport.CompleteAuth("c0d3", state, state, verifier)
+	if err != nil {
+		t.Fatalf("CompleteAuth: %v", err)
+	}
+	checkToken(t, tok, "token1", "refreshtoken1")
+}
+
+func TestExchangeWithState(t *testing.T) {
+	exchanges := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		exchanges++
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"access_token":"token1","refresh_token":"refreshtoken1","expires_in":3600}`)
+	}))
+	defer server.Close()
+
+	transport := &Transport{Config: &Config{ClientId: "cl13nt1d", TokenURL: server.URL}}
+	for _, tt := range []struct{ returned, expected string }{
+		{"st4t3", "other"},
+		{"", ""},
+		{"st4t3", ""},
+	} {
+		if _, err := transport.ExchangeWithState("c0d3", tt.returned, tt.expected); err != ErrStateMismatch {
+			t.Errorf("ExchangeWithState(%q, %q): err = %v, want ErrStateMismatch", tt.returned, tt.expected, err)
+		}
+	}
+	if exchanges != 0 {
+		t.Fatalf("mismatched states made %d exchanges", exchanges)
+	}
+	tok, err := transport.ExchangeWithState("c0d3", "st4t3", "st4t3")
+	if err != nil {
+		t.Fatalf("ExchangeWithState: %v", err)
+	}
+	checkToken(t, tok, "token1", "refreshtoken1")
+}
+
+func TestCompleteAuthCode(t *testing.T) {
+	var form url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		form = r.PostForm
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"access_token":"token1","refresh_token":"refreshtoken1","expires_in":3600}`)
+	}))
+	defer server.Close()
+
+	transport := &Transport{Config: &Config{ClientId: "cl13nt1d", TokenURL: server.URL, RedirectURL: "https://app.example/default"}}
+	if _, err := transport.CompleteAuthCode("c0d3", "", ""); err == nil {
+		t.Errorf("CompleteAuthCode without a verifier succeeded")
+	}
+	tok, err := transport.CompleteAuthCode("c0d3", "v3r1f13r", "https://app.example/callback")
+	if err != nil {
+		t.Fatalf("CompleteAuthCode: %v", err)
+	}
+	checkToken(t, tok, "token1", "refreshtoken1")
+	if g, w := form.Get("code_verifier"), "v3r1f13r"; g != w {
+		t.Errorf("code_verifier = %q, want %q", g, w)
+	}
+	if g, w := form.Get("redirect_uri"), "https://app.example/callback"; g != w {
+		t.Errorf("redirect_uri = %q, want %q", g, w)
+	}
+}
+
+func TestBeginAuthRand(t *testing.T) {
+	newConfig := func() *Config {
+		return &Config{
+			AuthURL: "https://example.com/auth",
+			Rand:    bytes.NewReader(make([]byte, 48)),
+		}
+	}
+	_, verifier, state, err := newConfig().BeginAuth()
+	if err != nil {
+		t.Fatalf("BeginAuth: %v", err)
+	}
+	if g, w := string(verifier), strings.Repeat("A", 43); g != w {
+		t.Errorf("verifier = %q, want %q", g, w)
+	}
+	if g, w := state, strings.Repeat("A", 22); g != w {
+		t.Errorf("state = %q, want %q", g, w)
+	}
+	if _, v2, s2, _ := newConfig().BeginAuth(); v2 != verifier || s2 != state {
+		t.Errorf("BeginAuth with the same Rand is not deterministic")
+	}
+
+	short := &Config{AuthURL: "https://example.com/auth", Rand: bytes.NewReader(make([]byte, 40))}
+	if _, _, _, err := short.BeginAuth(); err == nil {
+		t.Errorf("BeginAuth with an exhausted Rand succeeded")
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// PrefetchTokens obtains a token for each of scopeSets with the client
+// credentials grant, making the requests concurrently, as a server
+// calling several APIs might at startup. The tokens are keyed by
+// ScopeKey of their scope set. If any request fails, PrefetchTokens
+// returns the tokens it did obtain along with the failures joined in one
+// error. Cancelling ctx abandons the requests still in flight.
+func (c *Config) PrefetchTokens(ctx context.Context, scopeSets [][]string) (map[string]*Token, error) {
+	t := &Transport{Config: c}
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		tokens = make(map[string]*Token)
+		errs   []error
+		seen   = make(map[string]bool)
+	)
+	for _, scopes := range scopeSets {
+		key := ScopeKey(scopes)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tok := new(Token)
+			err := ctx.Err()
+			if err == nil {
+				err = t.clientCredentials(ctx, tok, key)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, OAuthError{"PrefetchTokens", "scope " + strconv.Quote(key) + ": " + err.Error()})
+				return
+			}
+			tokens[key] = tok
+		}()
+	}
+	wg.Wait()
+	return tokens, errors.Join(errs...)
+}
+
+// ScopeKey returns the normalized form of a set of scopes used to key
+// the result of PrefetchTokens: the distinct scopes, sorted and joined
+// by spaces.
+func ScopeKey(scopes []string) string {
+	s := append([]string(nil), scopes...)
+	sort.Strings(s)
+	n := 0
+	for i, scope := range s {
+		if scope == "" || i > 0 && scope == s[i-1] {
+			continue
+		}
+		s[n] = scope
+		n++
+	}
+	return strings.Join(s[:n], " ")
+}
@@ -0,0 +1,58 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPrefetchTokens(t *testing.T) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if g := r.FormValue("grant_type"); g != "client_credentials" {
+			t.Errorf("grant_type = %q, want client_credentials", g)
+		}
+		scope := r.FormValue("scope")
+		if scope == "denied" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":"invalid_scope"}`)
+			return
+		}
+		// Answer only once both requests are in flight.
+		wg.Done()
+		wg.Wait()
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"token-%s","expires_in":3600}`, scope)
+	}))
+	defer server.Close()
+
+	config := &Config{ClientId: "cl13nt1d", ClientSecret: "s3cr3t", TokenURL: server.URL}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	tokens, err := config.PrefetchTokens(ctx, [][]string{{"write", "read"}, {"admin"}, {"read", "write", "read"}})
+	if err != nil {
+		t.Fatalf("PrefetchTokens: %v", err)
+	}
+	if len(tokens) != 2 {
+		t.Fatalf("got %d tokens, want 2: %v", len(tokens), tokens)
+	}
+	for key, want := range map[string]string{"read write": "token-read write", "admin": "token-admin"} {
+		if tok := tokens[key]; tok == nil || tok.AccessToken != want {
+			t.Errorf("tokens[%q] = %v, want access token %q", key, tok, want)
+		}
+	}
+
+	tokens, err = config.PrefetchTokens(ctx, [][]string{{"denied"}})
+	if err == nil || len(tokens) != 0 {
+		t.Errorf("PrefetchTokens(denied) = %v, %v; want an error", tokens, err)
+	}
+}
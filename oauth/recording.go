@@ -0,0 +1,79 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// An Interaction is a request made through a RecordingTransport and the
+// outcome of that request.
+type Interaction struct {
+	Method     string
+	URL        string
+	Form       url.Values // Decoded body of form-encoded requests.
+	StatusCode int        // Zero if the request failed.
+	Err        error
+}
+
+// RecordingTransport is an http.RoundTripper that records every request
+// made through it. It is meant for tests: set it as a Transport's
+// Transport to inspect the token exchanges and refreshes it performs.
+//
+//	rec := &oauth.RecordingTransport{}
+//	t := &oauth.Transport{Config: config, Transport: rec}
+//	t.Exchange(code)
+//	// rec.Interactions()[0].Form.Get("grant_type") == "authorization_code"
+type RecordingTransport struct {
+	// Transport is the HTTP transport that makes the requests.
+	// It will default to http.DefaultTransport if nil.
+	Transport http.RoundTripper
+
+	mu  sync.Mutex
+	log []Interaction
+}
+
+// RoundTrip records req and passes it to the underlying transport.
+func (rt *RecordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	in := Interaction{Method: req.Method, URL: req.URL.String()}
+	ct := strings.Split(req.Header.Get("Content-Type"), ";")[0]
+	if req.Body != nil && ct == "application/x-www-form-urlencoded" {
+		body, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		in.Form, _ = url.ParseQuery(string(body))
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	base := rt.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		in.Err = err
+	} else {
+		in.StatusCode = resp.StatusCode
+	}
+
+	rt.mu.Lock()
+	rt.log = append(rt.log, in)
+	rt.mu.Unlock()
+	return resp, err
+}
+
+// Interactions returns the requests recorded so far, oldest first.
+func (rt *RecordingTransport) Interactions() []Interaction {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	return append([]Interaction(nil), rt.log...)
+}
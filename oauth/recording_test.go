@@ -0,0 +1,49 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRecordingTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"access_token":"token1","refresh_token":"refreshtoken1","expires_in":3600}`)
+	}))
+	defer server.Close()
+
+	rec := &RecordingTransport{}
+	transport := &Transport{
+		Config:    &Config{ClientId: "cl13nt1d", TokenURL: server.URL + "/token"},
+		Transport: rec,
+	}
+	if _, err := transport.Exchange("c0d3"); err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if err := transport.Refresh(); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+
+	log := rec.Interactions()
+	want := []string{"authorization_code", "refresh_token"}
+	if len(log) != len(want) {
+		t.Fatalf("recorded %d interactions, want %d", len(log), len(want))
+	}
+	for i, in := range log {
+		if in.Method != "POST" || in.URL != server.URL+"/token" || in.StatusCode != 200 {
+			t.Errorf("interaction %d = %s %s (%d), want POST %s/token (200)", i, in.Method, in.URL, in.StatusCode, server.URL)
+		}
+		if g := in.Form.Get("grant_type"); g != want[i] {
+			t.Errorf("interaction %d: grant_type = %q, want %q", i, g, want[i])
+		}
+		if g := in.Form.Get("client_id"); g != "cl13nt1d" {
+			t.Errorf("interaction %d: client_id = %q, want %q", i, g, "cl13nt1d")
+		}
+	}
+}
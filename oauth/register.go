@@ -0,0 +1,185 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+)
+
+// ClientMetadata describes a client to register with RegisterClient
+// (RFC 7591 section 2). Fields left empty are left to the provider.
+type ClientMetadata struct {
+	RedirectURIs            []string `json:"redirect_uris,omitempty"`
+	TokenEndpointAuthMethod string   `json:"token_endpoint_auth_method,omitempty"` // Such as "client_secret_basic" or "private_key_jwt".
+	GrantTypes              []string `json:"grant_types,omitempty"`
+	ResponseTypes           []string `json:"response_types,omitempty"`
+	ClientName              string   `json:"client_name,omitempty"`
+	ClientURI               string   `json:"client_uri,omitempty"`
+	LogoURI                 string   `json:"logo_uri,omitempty"`
+	Scope                   string   `json:"scope,omitempty"` // Space-separated.
+	Contacts                []string `json:"contacts,omitempty"`
+	JWKSURI                 string   `json:"jwks_uri,omitempty"`
+	SoftwareID              string   `json:"software_id,omitempty"`
+	SoftwareVersion         string   `json:"software_version,omitempty"`
+}
+
+// A ClientRegistration is a client registered with RegisterClient: the
+// metadata the provider accepted, which may differ from that requested,
+// and the credentials it issued.
+type ClientRegistration struct {
+	ClientMetadata
+
+	ClientId     string
+	ClientSecret string // Empty for public clients.
+
+	IssuedAt     time.Time // Zero if the provider did not say.
+	SecretExpiry time.Time // Zero if the secret does not expire.
+
+	// RegistrationAccessToken and RegistrationClientURI, if the
+	// provider supports RFC 7592, are what ReadClient, UpdateClient and
+	// DeleteClient use to manage the registration.
+	RegistrationAccessToken string
+	RegistrationClientURI   string
+}
+
+// clientInformation is the JSON form of a ClientRegistration (RFC 7591
+// section 3.2.1).
+type clientInformation struct {
+	ClientMetadata
+	ClientId                string `json:"client_id"`
+	ClientSecret            string `json:"client_secret,omitempty"`
+	ClientIdIssuedAt        int64  `json:"client_id_issued_at,omitempty"`
+	ClientSecretExpiresAt   int64  `json:"client_secret_expires_at,omitempty"`
+	RegistrationAccessToken string `json:"registration_access_token,omitempty"`
+	RegistrationClientURI   string `json:"registration_client_uri,omitempty"`
+}
+
+// RegisterClient registers a client described by m at the Config's
+// RegistrationURL (RFC 7591). initialAccessToken, if the provider
+// requires one to allow registration, is sent as a Bearer token.
+func (c *Config) RegisterClient(ctx context.Context, m *ClientMetadata, initialAccessToken string) (*ClientRegistration, error) {
+	if c.RegistrationURL == "" {
+		return nil, OAuthError{"RegisterClient", "no RegistrationURL configured"}
+	}
+	reg, err := c.registrationRequest(ctx, "POST", c.RegistrationURL, initialAccessToken, m)
+	if err != nil {
+		return nil, err
+	}
+	if reg.ClientId == "" {
+		return nil, OAuthError{"RegisterClient", "no client_id in response"}
+	}
+	return reg, nil
+}
+
+// ReadClient returns the current registration of the client reg
+// describes (RFC 7592 section 2.1).
+func (c *Config) ReadClient(ctx context.Context, reg *ClientRegistration) (*ClientRegistration, error) {
+	if reg.RegistrationClientURI == "" {
+		return nil, OAuthError{"ReadClient", "registration cannot be managed"}
+	}
+	return c.registrationRequest(ctx, "GET", reg.RegistrationClientURI, reg.RegistrationAccessToken, nil)
+}
+
+// UpdateClient replaces the metadata of the client reg describes with m
+// (RFC 7592 section 2.2) and returns the updated registration. If the
+// provider does not rotate the registration access token, the updated
+// registration keeps reg's.
+func (c *Config) UpdateClient(ctx context.Context, reg *ClientRegistration, m *ClientMetadata) (*ClientRegistration, error) {
+	if reg.RegistrationClientURI == "" {
+		return nil, OAuthError{"UpdateClient", "registration cannot be managed"}
+	}
+	body := &clientInformation{ClientMetadata: *m, ClientId: reg.ClientId, ClientSecret: reg.ClientSecret}
+	updated, err := c.registrationRequest(ctx, "PUT", reg.RegistrationClientURI, reg.RegistrationAccessToken, body)
+	if err != nil {
+		return nil, err
+	}
+	if updated.RegistrationAccessToken == "" {
+		updated.RegistrationAccessToken = reg.RegistrationAccessToken
+	}
+	if updated.RegistrationClientURI == "" {
+		updated.RegistrationClientURI = reg.RegistrationClientURI
+	}
+	return updated, nil
+}
+
+// DeleteClient deregisters the client reg describes (RFC 7592 section
+// 2.3).
+func (c *Config) DeleteClient(ctx context.Context, reg *ClientRegistration) error {
+	if reg.RegistrationClientURI == "" {
+		return OAuthError{"DeleteClient", "registration cannot be managed"}
+	}
+	_, err := c.registrationRequest(ctx, "DELETE", reg.RegistrationClientURI, reg.RegistrationAccessToken, nil)
+	return err
+}
+
+// registrationRequest sends body, if it is not nil, as JSON with method
+// to u, authorized with the Bearer token if it is not empty, and
+// decodes the client information in the response. A DELETE expects an
+// empty 204 response and returns a nil registration.
+func (c *Config) registrationRequest(ctx context.Context, method, u, token string, body interface{}) (*ClientRegistration, error) {
+	var rb io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		rb = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, rb)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+	r, err := c.endpointClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if method == "DELETE" {
+		if r.StatusCode != http.StatusNoContent && r.StatusCode != http.StatusOK {
+			return nil, retrieveError(r)
+		}
+		return nil, nil
+	}
+	if r.StatusCode != http.StatusCreated && r.StatusCode != http.StatusOK {
+		return nil, retrieveError(r)
+	}
+	b, err := readBody(r.Body, c.maxResponseBytes())
+	if err != nil {
+		return nil, err
+	}
+	var ci clientInformation
+	if err := json.Unmarshal(b, &ci); err != nil {
+		return nil, OAuthError{"RegisterClient", err.Error()}
+	}
+	reg := &ClientRegistration{
+		ClientMetadata:          ci.ClientMetadata,
+		ClientId:                ci.ClientId,
+		ClientSecret:            ci.ClientSecret,
+		RegistrationAccessToken: ci.RegistrationAccessToken,
+		RegistrationClientURI:   ci.RegistrationClientURI,
+	}
+	if ci.ClientIdIssuedAt != 0 {
+		reg.IssuedAt = time.Unix(ci.ClientIdIssuedAt, 0)
+	}
+	if ci.ClientSecretExpiresAt != 0 {
+		reg.SecretExpiry = time.Unix(ci.ClientSecretExpiresAt, 0)
+	}
+	return reg, nil
+}
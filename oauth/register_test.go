@@ -0,0 +1,93 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRegisterClient(t *testing.T) {
+	var server *httptest.Server
+	name := ""
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		want := "Bearer r3g4cc3ss"
+		if r.URL.Path == "/register" {
+			want = "Bearer 1n1t14l"
+		}
+		if r.Header.Get("Authorization") != want {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var m clientInformation
+		if r.Method == "POST" || r.Method == "PUT" {
+			if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+				t.Errorf("%s %s: %v", r.Method, r.URL.Path, err)
+			}
+			if len(m.RedirectURIs) != 1 || m.RedirectURIs[0] != "https://app.example.com/cb" {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				io.WriteString(w, `{"error":"invalid_redirect_uri"}`)
+				return
+			}
+			name = m.ClientName
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method {
+		case "POST":
+			w.WriteHeader(http.StatusCreated)
+		case "PUT":
+			if m.ClientId != "cl13nt1d" || m.ClientSecret != "s3cr3t" {
+				t.Errorf("update body has client_id %q, client_secret %q", m.ClientId, m.ClientSecret)
+			}
+		case "DELETE":
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		fmt.Fprintf(w, `{"client_id":"cl13nt1d","client_secret":"s3cr3t","client_id_issued_at":1000000000,"client_secret_expires_at":0,`+
+			`"redirect_uris":["https://app.example.com/cb"],"client_name":%q,"registration_access_token":"r3g4cc3ss","registration_client_uri":"%s/register/cl13nt1d"}`,
+			name, server.URL)
+	}))
+	defer server.Close()
+
+	c := &Config{RegistrationURL: server.URL + "/register"}
+	m := &ClientMetadata{RedirectURIs: []string{"https://app.example.com/cb"}, ClientName: "App"}
+	reg, err := c.RegisterClient(context.Background(), m, "1n1t14l")
+	if err != nil {
+		t.Fatalf("RegisterClient: %v", err)
+	}
+	if reg.ClientId != "cl13nt1d" || reg.ClientSecret != "s3cr3t" || reg.ClientName != "App" || !reg.IssuedAt.Equal(time.Unix(1e9, 0)) || !reg.SecretExpiry.IsZero() {
+		t.Errorf("RegisterClient = %+v", reg)
+	}
+	if reg.RegistrationClientURI != server.URL+"/register/cl13nt1d" || reg.RegistrationAccessToken != "r3g4cc3ss" {
+		t.Errorf("registration management = %q, %q", reg.RegistrationClientURI, reg.RegistrationAccessToken)
+	}
+	if _, err := c.RegisterClient(context.Background(), &ClientMetadata{}, "1n1t14l"); err == nil {
+		t.Errorf("RegisterClient without redirect URIs succeeded")
+	} else if re, ok := err.(*RetrieveError); !ok || re.ErrorCode != "invalid_redirect_uri" {
+		t.Errorf("RegisterClient without redirect URIs: err = %v, want invalid_redirect_uri", err)
+	}
+
+	if got, err := c.ReadClient(context.Background(), reg); err != nil || got.ClientId != "cl13nt1d" {
+		t.Errorf("ReadClient = %+v, %v", got, err)
+	}
+	m.ClientName = "Renamed"
+	updated, err := c.UpdateClient(context.Background(), reg, m)
+	if err != nil || updated.ClientName != "Renamed" || updated.RegistrationAccessToken != "r3g4cc3ss" {
+		t.Errorf("UpdateClient = %+v, %v", updated, err)
+	}
+	if err := c.DeleteClient(context.Background(), reg); err != nil {
+		t.Errorf("DeleteClient: %v", err)
+	}
+	if _, err := c.ReadClient(context.Background(), &ClientRegistration{}); err == nil {
+		t.Errorf("ReadClient of an unmanageable registration succeeded")
+	}
+}
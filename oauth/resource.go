@@ -0,0 +1,134 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// A TokenValidator checks an access token presented to a resource
+// server. It returns an error only when it cannot tell whether the token
+// is valid; an unknown or revoked token is reported by returning an
+// Introspection that is not Valid.
+type TokenValidator func(ctx context.Context, token string) (*Introspection, error)
+
+// IntrospectionValidator returns a TokenValidator that asks t's
+// IntrospectURL about each token.
+func IntrospectionValidator(t *Transport) TokenValidator {
+	return t.Introspect
+}
+
+// JWTValidator returns a TokenValidator for JWT access tokens (RFC
+// 9068) that checks them locally, without a request per token: a
+// token is valid if it is typed "at+jwt", is signed with one of the
+// keys at c's JWKSURL, was issued by c's Issuer to audience, and has
+// not expired, allowing for c's IntrospectionLeeway. The type keeps ID
+// tokens signed with the same keys from passing as access tokens. The key set is cached and refreshed as
+// VerifyIDToken's is, so keys the provider rolls over to are picked up
+// by their key ID. Scopes are read from the "scope" claim or, failing
+// that, from an "scp" list.
+//
+// The validator returns an error only if c has no JWKSURL or Issuer or
+// it cannot fetch the key set.
+func JWTValidator(c *Config, audience string) TokenValidator {
+	return func(ctx context.Context, token string) (*Introspection, error) {
+		if c.JWKSURL == "" {
+			return nil, OAuthError{"JWTValidator", "no JWKSURL configured"}
+		}
+		if c.Issuer == "" {
+			return nil, OAuthError{"JWTValidator", "no Issuer configured"}
+		}
+		header, claims, signed, sig, err := splitJWT(token)
+		if err != nil || !isAccessTokenType(header.Typ) {
+			return &Introspection{}, nil
+		}
+		key, err := jwksCache.key(c.endpointClient(), c.JWKSURL, header.Kid, c.documentTTL())
+		if isUnknownKey(err) {
+			return &Introspection{}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if verifySignature(header.Alg, key, signed, sig) != nil {
+			return &Introspection{}, nil
+		}
+		in := NewIntrospection(claims)
+		in.Leeway = c.IntrospectionLeeway
+		if in.Scope == "" {
+			if scp, ok := claims["scp"].([]interface{}); ok {
+				var scopes []string
+				for _, s := range scp {
+					if s, ok := s.(string); ok {
+						scopes = append(scopes, s)
+					}
+				}
+				in.Scope = strings.Join(scopes, " ")
+			}
+		}
+		in.Active = in.Issuer == c.Issuer && audienceContains(claims["aud"], audience) && !in.Expiry.IsZero()
+		return in, nil
+	}
+}
+
+// isAccessTokenType reports whether typ, the "typ" header of a JWT, is
+// that of a JWT access token (RFC 9068 section 2.1).
+func isAccessTokenType(typ string) bool {
+	return strings.EqualFold(typ, "at+jwt") || strings.EqualFold(typ, "application/at+jwt")
+}
+
+type introspectionKey struct{}
+
+// IntrospectionFromContext returns the Introspection of the token that
+// RequireToken accepted for the request with context ctx.
+func IntrospectionFromContext(ctx context.Context) (*Introspection, bool) {
+	in, ok := ctx.Value(introspectionKey{}).(*Introspection)
+	return in, ok
+}
+
+// RequireToken returns an http.Handler that serves a request with next
+// only if it carries a Bearer token that validate finds valid and that
+// was granted every one of scopes. The token's Introspection is then
+// available to next through IntrospectionFromContext.
+//
+// Other requests are refused as RFC 6750 section 3 describes: with 401
+// Unauthorized if the token is missing or invalid, and with 403
+// Forbidden if it lacks a scope. If validate fails, the request is
+// refused with 503 Service Unavailable.
+func RequireToken(validate TokenValidator, scopes []string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := bearerToken(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "missing bearer token", http.StatusUnauthorized)
+			return
+		}
+		in, err := validate(r.Context(), token)
+		if err != nil {
+			http.Error(w, "cannot validate bearer token", http.StatusServiceUnavailable)
+			return
+		}
+		if !in.Valid() {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			http.Error(w, "invalid bearer token", http.StatusUnauthorized)
+			return
+		}
+		if !in.HasScope(scopes...) {
+			w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope=`+strconv.Quote(strings.Join(scopes, " ")))
+			http.Error(w, "insufficient scope", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), introspectionKey{}, in)))
+	})
+}
+
+// bearerToken returns the token of r's Bearer Authorization header.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	token = strings.TrimSpace(token)
+	return token, strings.EqualFold(scheme, "Bearer") && token != ""
+}
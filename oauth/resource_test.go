@@ -0,0 +1,160 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRequireToken(t *testing.T) {
+	validate := func(ctx context.Context, token string) (*Introspection, error) {
+		switch token {
+		case "r34d":
+			return NewIntrospection(map[string]interface{}{"active": true, "scope": "read", "sub": "alice"}), nil
+		case "r34dwr1t3":
+			return NewIntrospection(map[string]interface{}{"active": true, "scope": "read write", "sub": "bob"}), nil
+		case "d0wn":
+			return nil, errors.New("introspection endpoint unavailable")
+		}
+		return NewIntrospection(map[string]interface{}{"active": false}), nil
+	}
+	h := RequireToken(validate, []string{"write"}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		in, ok := IntrospectionFromContext(r.Context())
+		if !ok {
+			t.Errorf("no Introspection in request context")
+			return
+		}
+		io.WriteString(w, in.Subject)
+	}))
+
+	for _, c := range []struct {
+		auth      string
+		code      int
+		challenge string
+		body      string
+	}{
+		{"Bearer r34dwr1t3", 200, "", "bob"},
+		{"bearer r34dwr1t3", 200, "", "bob"},
+		{"", 401, "Bearer", ""},
+		{"Basic Zm9vOmJhcg==", 401, "Bearer", ""},
+		{"Bearer r3v0k3d", 401, `Bearer error="invalid_token"`, ""},
+		{"Bearer r34d", 403, `Bearer error="insufficient_scope", scope="write"`, ""},
+		{"Bearer d0wn", 503, "", ""},
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		if c.auth != "" {
+			req.Header.Set("Authorization", c.auth)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != c.code {
+			t.Errorf("%q: status = %d, want %d", c.auth, w.Code, c.code)
+		}
+		if got := w.Header().Get("WWW-Authenticate"); got != c.challenge {
+			t.Errorf("%q: WWW-Authenticate = %q, want %q", c.auth, got, c.challenge)
+		}
+		if c.body != "" && w.Body.String() != c.body {
+			t.Errorf("%q: body = %q, want %q", c.auth, w.Body.String(), c.body)
+		}
+	}
+}
+
+func TestJWTValidator(t *testing.T) {
+	now := time.Unix(1e9, 0)
+	var mu sync.Mutex
+	defer func(f func() time.Time) { timeNow = f }(timeNow)
+	timeNow = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+
+	fetches := 0
+	server := newJWKSServer(t, &fetches)
+	defer server.Close()
+
+	validate := JWTValidator(&Config{JWKSURL: server.URL, Issuer: "https://issuer.example.com"}, "https://api.example.com")
+	token := func(kid string, claims map[string]interface{}) string {
+		c := map[string]interface{}{
+			"iss": "https://issuer.example.com",
+			"aud": "https://api.example.com",
+			"sub": "alice",
+			"exp": float64(now.Add(time.Hour).Unix()),
+		}
+		for k, v := range claims {
+			c[k] = v
+		}
+		return signTestJWTType(t, testRSAKey, kid, "at+jwt", c)
+	}
+
+	in, err := validate(context.Background(), token("rsa1", map[string]interface{}{"scp": []string{"read", "write"}}))
+	if err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if !in.Valid() || in.Subject != "alice" || !in.HasScope("read", "write") {
+		t.Errorf("valid token: Valid = %v, Introspection = %+v", in.Valid(), in)
+	}
+	for name, tok := range map[string]string{
+		"wrong issuer":   token("rsa1", map[string]interface{}{"iss": "https://evil.example.com"}),
+		"wrong audience": token("rsa1", map[string]interface{}{"aud": "https://other.example.com"}),
+		"expired":        token("rsa1", map[string]interface{}{"exp": float64(now.Add(-time.Minute).Unix())}),
+		"unknown key":    token("unknown", nil),
+		"bad signature":  token("ec1", nil),
+		"not a JWT":      "opaque",
+		"no issuer":      token("rsa1", map[string]interface{}{"iss": nil}),
+		"ID token": signTestJWT(t, testRSAKey, "rsa1", map[string]interface{}{
+			"iss": "https://issuer.example.com",
+			"aud": "https://api.example.com",
+			"sub": "alice",
+			"exp": float64(now.Add(time.Hour).Unix()),
+		}),
+	} {
+		in, err := validate(context.Background(), tok)
+		if err != nil || in.Valid() {
+			t.Errorf("%s: Valid = %v, err = %v; want invalid without error", name, in != nil && in.Valid(), err)
+		}
+	}
+
+	if in, err := validate(context.Background(), signTestJWTType(t, testRSAKey, "rsa1", "application/at+jwt", map[string]interface{}{
+		"iss": "https://issuer.example.com",
+		"aud": "https://api.example.com",
+		"exp": float64(now.Add(time.Hour).Unix()),
+	})); err != nil || !in.Valid() {
+		t.Errorf("application/at+jwt token: Valid = %v, err = %v; want valid", in != nil && in.Valid(), err)
+	}
+	noIssuer := JWTValidator(&Config{JWKSURL: server.URL}, "https://api.example.com")
+	if _, err := noIssuer(context.Background(), token("rsa1", map[string]interface{}{"iss": nil})); err == nil {
+		t.Errorf("validator without an Issuer accepted a token with no iss")
+	}
+
+	// In the last tenth of the key set's hour, it is refreshed in the
+	// background while the cached keys stay in use.
+	cached := func() *keySet {
+		jwksCache.mu.Lock()
+		defer jwksCache.mu.Unlock()
+		return jwksCache.sets[server.URL]
+	}
+	old := cached()
+	mu.Lock()
+	now = now.Add(55 * time.Minute)
+	mu.Unlock()
+	if in, err := validate(context.Background(), token("rsa1", nil)); err != nil || !in.Valid() {
+		t.Fatalf("validate near key set expiry: Valid = %v, err = %v", in != nil && in.Valid(), err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for cached() == old && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if cached() == old {
+		t.Errorf("key set not refreshed in the background")
+	}
+}
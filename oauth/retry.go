@@ -0,0 +1,125 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// A RetryPolicy makes the token requests of Exchange, Refresh and the
+// other grants retry failures that may be transient: network errors,
+// and responses with a 5xx or 429 status. OAuth errors such as
+// invalid_grant are never retried. A server's Retry-After header is
+// honored if it asks for a longer delay than Backoff.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts, counting the first. If
+	// it is less than two, requests are not retried.
+	MaxAttempts int
+
+	Backoff Backoff
+}
+
+// Backoff spaces the attempts of a RetryPolicy exponentially.
+type Backoff struct {
+	Initial    time.Duration // Delay before the first retry. If zero, one second.
+	Multiplier float64       // Growth of the delay per retry. If less than one, two.
+
+	// MaxInterval, if positive, caps the delay between attempts.
+	MaxInterval time.Duration
+
+	// MaxElapsedTime, if positive, is the time after the first attempt
+	// beyond which no retry starts, even if attempts remain.
+	MaxElapsedTime time.Duration
+
+	// Jitter, if positive, varies each delay at random by up to this
+	// fraction of it either way, so that clients failing together do
+	// not retry in step. It is at most 1.
+	Jitter float64
+}
+
+// randFloat returns a pseudo-random number in [0, 1). Tests replace it.
+var randFloat = rand.Float64
+
+// delay returns the delay before retry n, counting from zero.
+func (b *Backoff) delay(n int) time.Duration {
+	d, m := b.Initial, b.Multiplier
+	if d <= 0 {
+		d = time.Second
+	}
+	if m < 1 {
+		m = 2
+	}
+	for i := 0; i < n && (b.MaxInterval <= 0 || d < b.MaxInterval); i++ {
+		d = time.Duration(float64(d) * m)
+	}
+	if b.MaxInterval > 0 && d > b.MaxInterval {
+		d = b.MaxInterval
+	}
+	if j := math.Min(b.Jitter, 1); j > 0 {
+		d = time.Duration(float64(d) * (1 + j*(2*randFloat()-1)))
+	}
+	return d
+}
+
+// retry calls request, and calls it again as the Config's RetryPolicy
+// allows while it fails transiently. It returns the last error.
+func (t *Transport) retry(ctx context.Context, request func() error) error {
+	p := t.RetryPolicy
+	if p == nil || p.MaxAttempts < 2 {
+		return request()
+	}
+	start := timeNow()
+	for attempt := 1; ; attempt++ {
+		err := request()
+		if err == nil || attempt >= p.MaxAttempts || !isTransient(err) {
+			return err
+		}
+		d := p.Backoff.delay(attempt - 1)
+		var re *RetrieveError
+		if errors.As(err, &re) && re.RetryAfter > d {
+			d = re.RetryAfter
+		}
+		if max := p.Backoff.MaxElapsedTime; max > 0 && timeNow().Sub(start)+d > max {
+			return err
+		}
+		if pollWait(ctx, d) != nil {
+			return err
+		}
+	}
+}
+
+// retryAfter returns the delay of a Retry-After header, given in seconds
+// or as an HTTP date, or zero if h has none.
+func retryAfter(h http.Header) time.Duration {
+	v := h.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if n, err := strconv.Atoi(v); err == nil && n > 0 {
+		return time.Duration(n) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil && t.After(timeNow()) {
+		return t.Sub(timeNow())
+	}
+	return 0
+}
+
+// isTransient reports whether a failed token request may succeed if
+// made again.
+func isTransient(err error) bool {
+	var re *RetrieveError
+	if errors.As(err, &re) {
+		return re.StatusCode >= 500 || re.StatusCode == 429
+	}
+	var ne net.Error
+	return errors.As(err, &ne)
+}
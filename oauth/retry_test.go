@@ -0,0 +1,139 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	b := Backoff{Initial: time.Second, Multiplier: 3, MaxInterval: 5 * time.Second}
+	for n, want := range []time.Duration{time.Second, 3 * time.Second, 5 * time.Second, 5 * time.Second} {
+		if g := b.delay(n); g != want {
+			t.Errorf("delay(%d) = %v, want %v", n, g, want)
+		}
+	}
+	if g := (&Backoff{}).delay(2); g != 4*time.Second {
+		t.Errorf("default delay(2) = %v, want 4s", g)
+	}
+}
+
+func TestRetryMaxElapsedTime(t *testing.T) {
+	now := time.Now()
+	defer func(f func() time.Time) { timeNow = f }(timeNow)
+	timeNow = func() time.Time { return now }
+	var waits []time.Duration
+	defer func(f func(context.Context, time.Duration) error) { pollWait = f }(pollWait)
+	pollWait = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		now = now.Add(d)
+		return nil
+	}
+
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.Header().Set("Content-Type", "application/json")
+		if r.FormValue("refresh_token") == "revoked" {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"error":"invalid_grant"}`)
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	transport := &Transport{
+		Config: &Config{
+			TokenURL: server.URL,
+			RetryPolicy: &RetryPolicy{
+				MaxAttempts: 10,
+				Backoff: Backoff{
+					Initial:        time.Second,
+					Multiplier:     2,
+					MaxInterval:    4 * time.Second,
+					MaxElapsedTime: 10 * time.Second,
+				},
+			},
+		},
+		Token: &Token{RefreshToken: "refreshtoken1"},
+	}
+	err := transport.Refresh()
+	if re, ok := err.(*RetrieveError); !ok || re.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("Refresh error = %v, want a 503 RetrieveError", err)
+	}
+	// A fourth retry, 4s after 7s of waiting, would exceed the budget.
+	if g, w := fmt.Sprint(waits), "[1s 2s 4s]"; g != w {
+		t.Errorf("waits = %s, want %s", g, w)
+	}
+	if attempts != 4 {
+		t.Errorf("made %d attempts, want 4", attempts)
+	}
+
+	attempts = 0
+	transport.Token.RefreshToken = "revoked"
+	if err := transport.Refresh(); err == nil || attempts != 1 {
+		t.Errorf("invalid_grant: err = %v after %d attempts, want an error after 1", err, attempts)
+	}
+}
+
+func TestRetryAfterAndJitter(t *testing.T) {
+	now := time.Unix(1e9, 0)
+	defer func(f func() time.Time) { timeNow = f }(timeNow)
+	timeNow = func() time.Time { return now }
+	var waits []time.Duration
+	defer func(f func(context.Context, time.Duration) error) { pollWait = f }(pollWait)
+	pollWait = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		now = now.Add(d)
+		return nil
+	}
+	defer func(f func() float64) { randFloat = f }(randFloat)
+	randFloat = func() float64 { return 1 }
+
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		switch attempts {
+		case 1:
+			w.Header().Set("Retry-After", "30")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.Header().Set("Retry-After", now.Add(time.Minute).UTC().Format(http.TimeFormat))
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 3:
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"access_token":"n3w","expires_in":3600}`)
+		}
+	}))
+	defer server.Close()
+
+	transport := &Transport{
+		Config: &Config{
+			TokenURL: server.URL,
+			RetryPolicy: &RetryPolicy{
+				MaxAttempts: 5,
+				Backoff:     Backoff{Initial: time.Second, Jitter: 0.5},
+			},
+		},
+		Token: &Token{RefreshToken: "r3fr3sh"},
+	}
+	if err := transport.Refresh(); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	// Retry-After outweighs the backoff; otherwise the third delay of
+	// 4s, jittered up by half, is 6s.
+	if g, w := fmt.Sprint(waits), "[30s 1m0s 6s]"; g != w {
+		t.Errorf("waits = %s, want %s", g, w)
+	}
+}
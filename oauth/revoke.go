@@ -0,0 +1,146 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strconv"
+	"sync"
+)
+
+// Close revokes the Transport's refresh and access tokens at the Config's
+// RevokeURL, if one is set, then forgets the Token and clears its
+// cache if it is a ClearableCache. It is meant for short-lived
+// processes that should not leave valid tokens behind when they exit.
+//
+// Close is idempotent: once the Token is gone there is nothing to revoke.
+// The Token is forgotten even if revocation fails.
+func (t *Transport) Close() error {
+	if t.Config == nil {
+		return OAuthError{"Close", "no Config supplied"}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var errs []error
+	if tok := t.Token; tok != nil && t.RevokeURL != "" {
+		if tok.RefreshToken != "" {
+			errs = append(errs, t.revokeToken(context.Background(), tok.RefreshToken, "refresh_token"))
+		}
+		if tok.AccessToken != "" {
+			errs = append(errs, t.revokeToken(context.Background(), tok.AccessToken, "access_token"))
+		}
+	}
+	t.Token = nil
+	if c, ok := t.cache().(ClearableCache); ok {
+		errs = append(errs, c.Clear())
+	}
+	return errors.Join(errs...)
+}
+
+// Revoke revokes the Transport's tokens at the Config's RevokeURL,
+// for servers that do not invalidate access tokens along with the
+// refresh token they came from. kinds names the tokens to revoke,
+// "access_token" or "refresh_token", and defaults to both. Each is sent
+// with the matching token_type_hint; the requests are made
+// concurrently and their errors joined. Unlike Close, Revoke keeps the
+// Token.
+func (t *Transport) Revoke(kinds ...string) error {
+	if t.config() == nil {
+		return OAuthError{"Revoke", "no Config supplied"}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.RevokeURL == "" {
+		return OAuthError{"Revoke", "no RevokeURL configured"}
+	}
+	if t.Token == nil {
+		return ErrNoToken
+	}
+	if len(kinds) == 0 {
+		kinds = []string{"access_token", "refresh_token"}
+	}
+	var tokens []string
+	for _, kind := range kinds {
+		switch kind {
+		case "access_token":
+			tokens = append(tokens, t.AccessToken)
+		case "refresh_token":
+			tokens = append(tokens, t.RefreshToken)
+		default:
+			return OAuthError{"Revoke", "unknown token kind " + strconv.Quote(kind)}
+		}
+	}
+
+	ctx := context.Background()
+	errs := make([]error, len(kinds))
+	var wg sync.WaitGroup
+	for i := range kinds {
+		if tokens[i] == "" {
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = t.postRevoke(ctx, url.Values{
+				"token":           {tokens[i]},
+				"token_type_hint": {kinds[i]},
+			})
+		}(i)
+	}
+	wg.Wait()
+	for i := range kinds {
+		if tokens[i] != "" {
+			t.audit(ctx, "revoke", t.ClientId, errs[i])
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// RevokeToken revokes tok's refresh and access tokens at the Config's
+// RevokeURL, as on logout from a web application that keeps Tokens in
+// its sessions rather than in Transports. An error response from the
+// server, such as unsupported_token_type for a kind of token it cannot
+// revoke, is returned as a *RetrieveError; the errors of both requests
+// are joined.
+func (c *Config) RevokeToken(ctx context.Context, tok *Token) error {
+	if c.RevokeURL == "" {
+		return OAuthError{"RevokeToken", "no RevokeURL configured"}
+	}
+	t := &Transport{Config: c}
+	var errs []error
+	if tok.RefreshToken != "" {
+		errs = append(errs, t.revokeToken(ctx, tok.RefreshToken, "refresh_token"))
+	}
+	if tok.AccessToken != "" {
+		errs = append(errs, t.revokeToken(ctx, tok.AccessToken, "access_token"))
+	}
+	return errors.Join(errs...)
+}
+
+// revokeToken asks the revocation endpoint to invalidate token, which is
+// of the kind named by hint ("access_token" or "refresh_token").
+func (t *Transport) revokeToken(ctx context.Context, token, hint string) error {
+	v := url.Values{
+		"token":           {token},
+		"token_type_hint": {hint},
+	}
+	err := t.postRevoke(ctx, v)
+	t.audit(ctx, "revoke", t.ClientId, err)
+	return err
+}
+
+func (t *Transport) postRevoke(ctx context.Context, v url.Values) error {
+	r, err := t.postForm(ctx, t.Config, t.RevokeURL, v, &clientAuth{t.endpointAuthStyle(), t.ClientId, t.ClientSecret})
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != 200 {
+		return retrieveError(r)
+	}
+	return nil
+}
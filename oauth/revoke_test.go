@@ -0,0 +1,125 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestClose(t *testing.T) {
+	var revoked []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/revoke" {
+			t.Errorf("unexpected request to %s", r.URL.Path)
+		}
+		revoked = append(revoked, r.FormValue("token_type_hint")+"="+r.FormValue("token"))
+	}))
+	defer server.Close()
+
+	cache := CacheFile(filepath.Join(t.TempDir(), "token.json"))
+	transport := &Transport{
+		Config: &Config{RevokeURL: server.URL + "/revoke", TokenCache: cache},
+		Token:  &Token{AccessToken: "token1", RefreshToken: "refreshtoken1"},
+	}
+	if err := cache.PutToken(transport.Token); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := transport.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	want := []string{"refresh_token=refreshtoken1", "access_token=token1"}
+	if len(revoked) != len(want) || revoked[0] != want[0] || revoked[1] != want[1] {
+		t.Errorf("revoked %v, want %v", revoked, want)
+	}
+	if transport.Token != nil {
+		t.Errorf("Token = %+v after Close, want nil", transport.Token)
+	}
+	if _, err := os.Stat(string(cache)); !os.IsNotExist(err) {
+		t.Errorf("cache file still present after Close: %v", err)
+	}
+
+	// A second Close has nothing to revoke.
+	if err := transport.Close(); err != nil {
+		t.Fatalf("second Close: %v", err)
+	}
+	if len(revoked) != len(want) {
+		t.Errorf("second Close made %d revocation requests, want none", len(revoked)-len(want))
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	var mu sync.Mutex
+	revoked := make(map[string]string) // token by hint
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		revoked[r.FormValue("token_type_hint")] = r.FormValue("token")
+	}))
+	defer server.Close()
+
+	transport := &Transport{
+		Config: &Config{RevokeURL: server.URL},
+		Token:  &Token{AccessToken: "token1", RefreshToken: "refreshtoken1"},
+	}
+	if err := transport.Revoke(); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if len(revoked) != 2 || revoked["access_token"] != "token1" || revoked["refresh_token"] != "refreshtoken1" {
+		t.Errorf("revoked %v, want both tokens with their hints", revoked)
+	}
+	if transport.Token == nil {
+		t.Errorf("Revoke forgot the Token")
+	}
+
+	revoked = make(map[string]string)
+	if err := transport.Revoke("refresh_token"); err != nil {
+		t.Fatalf("Revoke(refresh_token): %v", err)
+	}
+	if len(revoked) != 1 || revoked["refresh_token"] != "refreshtoken1" {
+		t.Errorf("revoked %v, want only the refresh token", revoked)
+	}
+	if err := transport.Revoke("id_token"); err == nil {
+		t.Errorf("Revoke(id_token) succeeded")
+	}
+}
+
+func TestRevokeToken(t *testing.T) {
+	var revoked []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id, secret, _ := r.BasicAuth(); id != "cl13nt1d" || secret != "s3cr3t" {
+			t.Errorf("request not authenticated as the client")
+		}
+		if r.FormValue("token_type_hint") == "access_token" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"error":"unsupported_token_type"}`)
+			return
+		}
+		revoked = append(revoked, r.FormValue("token"))
+	}))
+	defer server.Close()
+
+	config := &Config{ClientId: "cl13nt1d", ClientSecret: "s3cr3t", RevokeURL: server.URL, AuthStyle: AuthStyleInHeader}
+	err := config.RevokeToken(context.Background(), &Token{AccessToken: "token1", RefreshToken: "refreshtoken1"})
+	var re *RetrieveError
+	if !errors.As(err, &re) || re.ErrorCode != "unsupported_token_type" {
+		t.Errorf("RevokeToken error = %v, want unsupported_token_type", err)
+	}
+	if len(revoked) != 1 || revoked[0] != "refreshtoken1" {
+		t.Errorf("revoked %v, want [refreshtoken1]", revoked)
+	}
+	if err := (&Config{}).RevokeToken(context.Background(), &Token{AccessToken: "token1"}); err == nil {
+		t.Errorf("RevokeToken without a RevokeURL succeeded")
+	}
+}
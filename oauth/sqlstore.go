@@ -0,0 +1,129 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+)
+
+// SQLStore is a TokenStore in a table of a SQL database, for servers
+// that share their users' Tokens. The table needs these columns, which
+// may have other types that the database driver maps to and from
+// strings and []byte:
+//
+//	CREATE TABLE oauth_tokens (
+//		token_key     VARCHAR(255) PRIMARY KEY,
+//		token         BLOB NOT NULL,
+//		refresh_token TEXT NOT NULL
+//	)
+//
+// Its SwapToken compares refresh tokens, so that a Transport using the
+// store does not overwrite a rotated refresh token stored by another
+// process.
+type SQLStore struct {
+	DB *sql.DB
+
+	// Table is the name of the table, used verbatim in queries. If
+	// empty, it is "oauth_tokens".
+	Table string
+
+	// NumberedPlaceholders makes queries use $1, $2, ... for their
+	// parameters, as PostgreSQL drivers require, rather than ?.
+	NumberedPlaceholders bool
+
+	// Codec encodes the token column. If nil, it is JSONCodec.
+	Codec TokenCodec
+}
+
+// query returns q with the table name in place of TABLE and, with
+// NumberedPlaceholders, each ? numbered.
+func (s *SQLStore) query(q string) string {
+	table := s.Table
+	if table == "" {
+		table = "oauth_tokens"
+	}
+	q = strings.Replace(q, "TABLE", table, 1)
+	if s.NumberedPlaceholders {
+		for n := 1; strings.Contains(q, "?"); n++ {
+			q = strings.Replace(q, "?", "$"+strconv.Itoa(n), 1)
+		}
+	}
+	return q
+}
+
+// Token returns the Token stored for key.
+func (s *SQLStore) Token(key string) (*Token, error) {
+	var b []byte
+	err := s.DB.QueryRow(s.query("SELECT token FROM TABLE WHERE token_key = ?"), key).Scan(&b)
+	if err == sql.ErrNoRows {
+		return nil, OAuthError{"SQLStore.Token", "no token for key " + strconv.Quote(key)}
+	}
+	if err != nil {
+		return nil, OAuthError{"SQLStore.Token", err.Error()}
+	}
+	tok, err := codec(s.Codec).Unmarshal(b)
+	if err != nil {
+		return nil, OAuthError{"SQLStore.Token", err.Error()}
+	}
+	return tok, nil
+}
+
+// PutToken stores tok for key, replacing any Token it had.
+func (s *SQLStore) PutToken(key string, tok *Token) error {
+	b, err := codec(s.Codec).Marshal(tok)
+	if err != nil {
+		return OAuthError{"SQLStore.PutToken", err.Error()}
+	}
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return OAuthError{"SQLStore.PutToken", err.Error()}
+	}
+	defer tx.Rollback()
+	r, err := tx.Exec(s.query("UPDATE TABLE SET token = ?, refresh_token = ? WHERE token_key = ?"), b, tok.RefreshToken, key)
+	if err != nil {
+		return OAuthError{"SQLStore.PutToken", err.Error()}
+	}
+	if n, err := r.RowsAffected(); err == nil && n == 0 {
+		_, err = tx.Exec(s.query("INSERT INTO TABLE (token_key, token, refresh_token) VALUES (?, ?, ?)"), key, b, tok.RefreshToken)
+		if err != nil {
+			return OAuthError{"SQLStore.PutToken", err.Error()}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return OAuthError{"SQLStore.PutToken", err.Error()}
+	}
+	return nil
+}
+
+// SwapToken stores tok for key if the stored Token's refresh token is
+// that of old, and otherwise returns ErrTokenConflict.
+func (s *SQLStore) SwapToken(key string, old, tok *Token) error {
+	b, err := codec(s.Codec).Marshal(tok)
+	if err != nil {
+		return OAuthError{"SQLStore.SwapToken", err.Error()}
+	}
+	r, err := s.DB.Exec(s.query("UPDATE TABLE SET token = ?, refresh_token = ? WHERE token_key = ? AND refresh_token = ?"), b, tok.RefreshToken, key, old.RefreshToken)
+	if err != nil {
+		return OAuthError{"SQLStore.SwapToken", err.Error()}
+	}
+	n, err := r.RowsAffected()
+	if err != nil {
+		return OAuthError{"SQLStore.SwapToken", err.Error()}
+	}
+	if n == 0 {
+		return ErrTokenConflict
+	}
+	return nil
+}
+
+// DeleteToken removes the Token stored for key, if any.
+func (s *SQLStore) DeleteToken(key string) error {
+	if _, err := s.DB.Exec(s.query("DELETE FROM TABLE WHERE token_key = ?"), key); err != nil {
+		return OAuthError{"SQLStore.DeleteToken", err.Error()}
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDB is a database/sql driver that understands only the queries of
+// SQLStore, keeping rows of token_key, token and refresh_token in memory.
+type fakeDB struct {
+	mu   sync.Mutex
+	rows map[string][2]driver.Value
+}
+
+func (db *fakeDB) Open(string) (driver.Conn, error) { return fakeConn{db}, nil }
+
+type fakeConn struct{ db *fakeDB }
+
+func (c fakeConn) Prepare(q string) (driver.Stmt, error) { return fakeStmt{c.db, q}, nil }
+func (c fakeConn) Close() error                          { return nil }
+func (c fakeConn) Begin() (driver.Tx, error)             { return fakeTx{}, nil }
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeStmt struct {
+	db *fakeDB
+	q  string
+}
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return -1 }
+
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	switch {
+	case strings.HasPrefix(s.q, "UPDATE"):
+		key := args[2].(string)
+		row, ok := s.db.rows[key]
+		if !ok || len(args) == 4 && row[1] != args[3] {
+			return driver.RowsAffected(0), nil
+		}
+		s.db.rows[key] = [2]driver.Value{args[0], args[1]}
+	case strings.HasPrefix(s.q, "INSERT"):
+		s.db.rows[args[0].(string)] = [2]driver.Value{args[1], args[2]}
+	case strings.HasPrefix(s.q, "DELETE"):
+		delete(s.db.rows, args[0].(string))
+	default:
+		return nil, fmt.Errorf("unexpected query %q", s.q)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	row, ok := s.db.rows[args[0].(string)]
+	return &fakeRows{row[0], !ok}, nil
+}
+
+type fakeRows struct {
+	token driver.Value
+	done  bool
+}
+
+func (r *fakeRows) Columns() []string { return []string{"token"} }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	dest[0], r.done = r.token, true
+	return nil
+}
+
+var testDB = &fakeDB{rows: make(map[string][2]driver.Value)}
+
+func init() { sql.Register("goauth2fake", testDB) }
+
+func TestSQLStore(t *testing.T) {
+	db, err := sql.Open("goauth2fake", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	store := &SQLStore{DB: db}
+
+	if _, err := store.Token("alice"); err == nil {
+		t.Errorf("Token of an unknown key succeeded")
+	}
+	for _, rt := range []string{"r0", "r1"} {
+		if err := store.PutToken("alice", &Token{AccessToken: "a", RefreshToken: rt}); err != nil {
+			t.Fatalf("PutToken: %v", err)
+		}
+	}
+	if tok, err := store.Token("alice"); err != nil || tok.RefreshToken != "r1" {
+		t.Errorf("Token = %v, %v; want refresh token r1", tok, err)
+	}
+	if err := store.SwapToken("alice", &Token{RefreshToken: "r0"}, &Token{RefreshToken: "r2"}); err != ErrTokenConflict {
+		t.Errorf("SwapToken from a stale token: err = %v, want ErrTokenConflict", err)
+	}
+	if err := store.SwapToken("alice", &Token{RefreshToken: "r1"}, &Token{RefreshToken: "r2"}); err != nil {
+		t.Errorf("SwapToken: %v", err)
+	}
+	if err := store.DeleteToken("alice"); err != nil {
+		t.Fatalf("DeleteToken: %v", err)
+	}
+	if _, err := store.Token("alice"); err == nil {
+		t.Errorf("Token after DeleteToken succeeded")
+	}
+
+	s := &SQLStore{Table: "tokens", NumberedPlaceholders: true}
+	if g, w := s.query("UPDATE TABLE SET token = ? WHERE token_key = ?"), "UPDATE tokens SET token = $1 WHERE token_key = $2"; g != w {
+		t.Errorf("query = %q, want %q", g, w)
+	}
+}
+
+func TestSwapCacheConflict(t *testing.T) {
+	n := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"a%d","refresh_token":"r%d","expires_in":3600}`, n, n)
+	}))
+	defer server.Close()
+
+	db, err := sql.Open("goauth2fake", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	store := &SQLStore{DB: db}
+	if err := store.PutToken("bob", &Token{AccessToken: "a0", RefreshToken: "r0"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Two processes hold bob's Token and both refresh it.
+	var changes []string
+	config := &Config{
+		TokenURL:      server.URL,
+		OnTokenChange: func(tok *Token) { changes = append(changes, tok.RefreshToken) },
+	}
+	var procs [2]*Transport
+	for i := range procs {
+		procs[i] = &Transport{Config: config, Cache: storeCache{store, "bob"}}
+		procs[i].Token = &Token{AccessToken: "a0", RefreshToken: "r0", Expiry: time.Now().Add(-time.Minute)}
+	}
+	for _, p := range procs {
+		if err := p.Refresh(); err != nil {
+			t.Fatalf("Refresh: %v", err)
+		}
+	}
+	// The second adopts the first's rotated refresh token.
+	if procs[1].RefreshToken != "r1" || procs[1].AccessToken != "a1" {
+		t.Errorf("second process has %+v, want the first's token", procs[1].Token)
+	}
+	if tok, _ := store.Token("bob"); tok.RefreshToken != "r1" {
+		t.Errorf("stored refresh token = %q, want r1", tok.RefreshToken)
+	}
+	// OnTokenChange hears of the second process's discarded token
+	// before the write, then of the one it adopted.
+	if g, w := strings.Join(changes, " "), "r1 r2 r1"; g != w {
+		t.Errorf("OnTokenChange got %q, want %q", g, w)
+	}
+}
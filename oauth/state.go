@@ -0,0 +1,88 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrStateExpired is returned by VerifyState and HandleRedirect when a
+// signed state is older than the Config's StateMaxAge.
+var ErrStateExpired error = OAuthError{"VerifyState", "state expired"}
+
+// SignedState returns a new state value signed with the Config's
+// StateKey, which VerifyState can check without the application
+// storing it. binding ties the state to the user's browser session,
+// for example by the session cookie's ID, so that a state issued to
+// one user is refused for another; without it a signed state does not
+// protect against cross-site request forgery.
+func (c *Config) SignedState(binding string) (string, error) {
+	if len(c.StateKey) == 0 {
+		return "", OAuthError{"SignedState", "no StateKey configured"}
+	}
+	nonce, err := randomString(c.rand(), 16)
+	if err != nil {
+		return "", err
+	}
+	payload := nonce + "." + strconv.FormatInt(timeNow().Unix(), 10)
+	return payload + "." + c.stateMAC(payload, binding), nil
+}
+
+// VerifyState checks that state was returned by SignedState for
+// binding and, if the Config has a StateMaxAge, that it has not
+// expired. It returns ErrStateMismatch or ErrStateExpired otherwise.
+func (c *Config) VerifyState(state, binding string) error {
+	if len(c.StateKey) == 0 {
+		return OAuthError{"VerifyState", "no StateKey configured"}
+	}
+	i := strings.LastIndex(state, ".")
+	if i < 0 || !hmac.Equal([]byte(state[i+1:]), []byte(c.stateMAC(state[:i], binding))) {
+		return ErrStateMismatch
+	}
+	j := strings.LastIndex(state[:i], ".")
+	if j < 0 {
+		return ErrStateMismatch
+	}
+	issued, err := strconv.ParseInt(state[j+1:i], 10, 64)
+	if err != nil {
+		return ErrStateMismatch
+	}
+	if c.StateMaxAge > 0 && timeNow().Sub(time.Unix(issued, 0)) > c.StateMaxAge {
+		return ErrStateExpired
+	}
+	return nil
+}
+
+// stateMAC returns the signature of a state's payload for binding.
+func (c *Config) stateMAC(payload, binding string) string {
+	mac := hmac.New(sha256.New, c.StateKey)
+	mac.Write([]byte(payload + "\x00" + binding))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// HandleRedirect completes an authorization code flow whose state came
+// from SignedState: it parses the authorization response in r with
+// ParseCallback, checks the returned state with VerifyState, and
+// exchanges the code. The options are passed to Exchange.
+func (t *Transport) HandleRedirect(r *http.Request, binding string, opts ...AuthCodeOption) (*Token, error) {
+	config := t.config()
+	if config == nil {
+		return nil, OAuthError{"HandleRedirect", "no Config supplied"}
+	}
+	cb, err := ParseCallback(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := config.VerifyState(cb.State, binding); err != nil {
+		return nil, err
+	}
+	return t.Exchange(cb.Code, opts...)
+}
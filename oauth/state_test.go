@@ -0,0 +1,84 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestSignedState(t *testing.T) {
+	now := time.Unix(1e9, 0)
+	defer func(f func() time.Time) { timeNow = f }(timeNow)
+	timeNow = func() time.Time { return now }
+
+	c := &Config{StateKey: []byte("k3y"), StateMaxAge: 10 * time.Minute}
+	state, err := c.SignedState("session1")
+	if err != nil {
+		t.Fatalf("SignedState: %v", err)
+	}
+	if state2, _ := c.SignedState("session1"); state2 == state {
+		t.Errorf("SignedState returned %q twice", state)
+	}
+	if err := c.VerifyState(state, "session1"); err != nil {
+		t.Errorf("VerifyState: %v", err)
+	}
+	for _, tt := range []struct{ name, state, binding string }{
+		{"other session", state, "session2"},
+		{"tampered", state[:len(state)-2] + "xx", "session1"},
+		{"unsigned", "st4t3", "session1"},
+		{"empty", "", "session1"},
+	} {
+		if err := c.VerifyState(tt.state, tt.binding); err != ErrStateMismatch {
+			t.Errorf("%s: VerifyState = %v, want ErrStateMismatch", tt.name, err)
+		}
+	}
+	if err := (&Config{StateKey: []byte("0th3r")}).VerifyState(state, "session1"); err != ErrStateMismatch {
+		t.Errorf("VerifyState with another key = %v, want ErrStateMismatch", err)
+	}
+
+	now = now.Add(11 * time.Minute)
+	if err := c.VerifyState(state, "session1"); err != ErrStateExpired {
+		t.Errorf("VerifyState after StateMaxAge = %v, want ErrStateExpired", err)
+	}
+	if _, err := (&Config{}).SignedState("session1"); err == nil {
+		t.Errorf("SignedState without a StateKey succeeded")
+	}
+}
+
+func TestHandleRedirect(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if g := r.FormValue("code"); g != "c0d3" {
+			t.Errorf("code = %q, want c0d3", g)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"access_token":"token1","refresh_token":"refreshtoken1","expires_in":3600}`)
+	}))
+	defer server.Close()
+
+	transport := &Transport{Config: &Config{TokenURL: server.URL, StateKey: []byte("k3y")}}
+	state, err := transport.SignedState("session1")
+	if err != nil {
+		t.Fatalf("SignedState: %v", err)
+	}
+	redirect := func(state string) *http.Request {
+		return httptest.NewRequest("GET", "/callback?"+url.Values{"code": {"c0d3"}, "state": {state}}.Encode(), nil)
+	}
+	if _, err := transport.HandleRedirect(redirect(state), "session2"); err != ErrStateMismatch {
+		t.Errorf("HandleRedirect for another session = %v, want ErrStateMismatch", err)
+	}
+	if transport.Token != nil {
+		t.Errorf("HandleRedirect exchanged the code despite the state mismatch")
+	}
+	tok, err := transport.HandleRedirect(redirect(state), "session1")
+	if err != nil {
+		t.Fatalf("HandleRedirect: %v", err)
+	}
+	checkToken(t, tok, "token1", "refreshtoken1")
+}
@@ -0,0 +1,89 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"context"
+	"net/url"
+)
+
+// tokenExchangeGrantType is the grant_type of a token exchange (RFC 8693).
+const tokenExchangeGrantType = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+// Token type identifiers of RFC 8693 section 3, for the token types of a
+// TokenExchangeRequest and the IssuedTokenType of a Token.
+const (
+	TokenTypeAccessToken  = "urn:ietf:params:oauth:token-type:access_token"
+	TokenTypeRefreshToken = "urn:ietf:params:oauth:token-type:refresh_token"
+	TokenTypeIDToken      = "urn:ietf:params:oauth:token-type:id_token"
+	TokenTypeJWT          = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+// A TokenExchangeRequest describes a token exchange (RFC 8693 section
+// 2.1). Only SubjectToken is required.
+type TokenExchangeRequest struct {
+	// SubjectToken is the token of the party on whose behalf the new
+	// token is requested, and SubjectTokenType its type. The type
+	// defaults to TokenTypeAccessToken.
+	SubjectToken     string
+	SubjectTokenType string
+
+	// ActorToken, if set, is the token of the party acting for the
+	// subject, for delegation, and ActorTokenType its type. The type
+	// defaults to TokenTypeAccessToken.
+	ActorToken     string
+	ActorTokenType string
+
+	// Audience and Resource name the service the new token is for,
+	// overriding the Config's Audience and Resources. Scope is the space-separated
+	// scope requested. RequestedTokenType is the type of token wanted.
+	Audience           string
+	Resource           string
+	Scope              string
+	RequestedTokenType string
+}
+
+// TokenExchange obtains a Token with the token exchange grant (RFC
+// 8693), as a service does to call another on behalf of the user whose
+// token it received. The Config's client credentials authenticate the
+// request. The issued token's type and scope are in the Token's
+// IssuedTokenType and GrantedScope.
+func (c *Config) TokenExchange(ctx context.Context, r *TokenExchangeRequest) (*Token, error) {
+	if r.SubjectToken == "" {
+		return nil, OAuthError{"TokenExchange", "no subject token"}
+	}
+	v := url.Values{
+		"grant_type":         {tokenExchangeGrantType},
+		"subject_token":      {r.SubjectToken},
+		"subject_token_type": {tokenType(r.SubjectTokenType)},
+	}
+	if r.ActorToken != "" {
+		v.Set("actor_token", r.ActorToken)
+		v.Set("actor_token_type", tokenType(r.ActorTokenType))
+	}
+	for k, s := range map[string]string{
+		"audience":             r.Audience,
+		"resource":             r.Resource,
+		"scope":                r.Scope,
+		"requested_token_type": r.RequestedTokenType,
+	} {
+		if s != "" {
+			v.Set(k, s)
+		}
+	}
+	tok := new(Token)
+	if err := (&Transport{Config: c}).updateToken(ctx, tok, v); err != nil {
+		return nil, err
+	}
+	return tok, nil
+}
+
+// tokenType returns typ, or TokenTypeAccessToken if it is empty.
+func tokenType(typ string) string {
+	if typ == "" {
+		return TokenTypeAccessToken
+	}
+	return typ
+}
@@ -0,0 +1,57 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestTokenExchange(t *testing.T) {
+	var form url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		form = r.PostForm
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"access_token":"d3l3g4t3d","issued_token_type":"urn:ietf:params:oauth:token-type:access_token","token_type":"Bearer","scope":"orders:read","expires_in":300}`)
+	}))
+	defer server.Close()
+
+	config := &Config{ClientId: "g4t3w4y", ClientSecret: "s3cr3t", TokenURL: server.URL, Audience: "default-api"}
+	tok, err := config.TokenExchange(context.Background(), &TokenExchangeRequest{
+		SubjectToken: "us3r",
+		ActorToken:   "s3rv1c3",
+		Audience:     "orders",
+		Scope:        "orders:read",
+	})
+	if err != nil {
+		t.Fatalf("TokenExchange: %v", err)
+	}
+	if tok.AccessToken != "d3l3g4t3d" || tok.IssuedTokenType != TokenTypeAccessToken || tok.GrantedScope != "orders:read" {
+		t.Errorf("Token = %+v", tok)
+	}
+	for k, want := range map[string]string{
+		"grant_type":           "urn:ietf:params:oauth:grant-type:token-exchange",
+		"subject_token":        "us3r",
+		"subject_token_type":   TokenTypeAccessToken,
+		"actor_token":          "s3rv1c3",
+		"actor_token_type":     TokenTypeAccessToken,
+		"audience":             "orders",
+		"scope":                "orders:read",
+		"requested_token_type": "",
+	} {
+		if g := form.Get(k); g != want {
+			t.Errorf("%s = %q, want %q", k, g, want)
+		}
+	}
+
+	if _, err := config.TokenExchange(context.Background(), &TokenExchangeRequest{}); err == nil {
+		t.Errorf("TokenExchange without a subject token succeeded")
+	}
+}
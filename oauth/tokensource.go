@@ -0,0 +1,238 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// A TokenSource returns Tokens. Every Cache is a TokenSource.
+type TokenSource interface {
+	Token() (*Token, error)
+}
+
+// ErrRefreshTokenExpired is returned by the TokenSource of
+// RefreshTokenSource when the server rejects its refresh token with
+// invalid_grant, because it has expired or been revoked. The error
+// returned matches it with errors.Is and wraps the server's
+// *RetrieveError.
+var ErrRefreshTokenExpired error = OAuthError{"RefreshTokenSource", "refresh token expired or revoked"}
+
+// refreshExpiredError is the error RefreshTokenSource returns for an
+// invalid_grant response, which is ErrRefreshTokenExpired.
+type refreshExpiredError struct {
+	*RetrieveError
+}
+
+func (e *refreshExpiredError) Error() string {
+	return ErrRefreshTokenExpired.Error() + ": " + e.RetrieveError.Error()
+}
+
+func (e *refreshExpiredError) Is(target error) bool { return target == ErrRefreshTokenExpired }
+
+func (e *refreshExpiredError) Unwrap() error { return e.RetrieveError }
+
+// RefreshTokenSource returns a TokenSource for a backend job holding
+// only a stored refresh token. Its first call to Token obtains an access
+// token by refreshing, and later calls return that token until it
+// expires and refresh it again; it never starts an interactive flow.
+func (c *Config) RefreshTokenSource(refreshToken string) TokenSource {
+	return &refreshTokenSource{t: &Transport{Config: c, Token: &Token{RefreshToken: refreshToken}}}
+}
+
+type refreshTokenSource struct {
+	t *Transport
+}
+
+func (s *refreshTokenSource) Token() (*Token, error) {
+	t := s.t
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.dueForRefresh(t.ExpiryDelta) {
+		if err := t.refresh(context.Background()); err != nil {
+			if re, ok := err.(*RetrieveError); ok && re.ErrorCode == "invalid_grant" {
+				return nil, &refreshExpiredError{re}
+			}
+			return nil, err
+		}
+	}
+	tok := *t.Token
+	return &tok, nil
+}
+
+// CachedTokenSource returns a TokenSource that returns the Token in
+// cache while it is unexpired, and otherwise gets a new Token from src
+// and writes it to cache before returning it. A Cache shared between
+// processes, such as a CacheFile, lets them share one Token.
+func CachedTokenSource(src TokenSource, cache Cache) TokenSource {
+	return &cachedTokenSource{src: src, cache: cache}
+}
+
+type cachedTokenSource struct {
+	src   TokenSource
+	cache Cache
+
+	mu sync.Mutex // serializes use of src on cache misses
+}
+
+func (s *cachedTokenSource) Token() (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if tok, err := s.cache.Token(); err == nil && tok != nil && !tok.needsRefresh(0) {
+		return tok, nil
+	}
+	tok, err := s.src.Token()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.cache.PutToken(tok); err != nil {
+		return nil, err
+	}
+	return tok, nil
+}
+
+// StaticTokenSource returns a TokenSource that always returns a copy of
+// tok, for tokens obtained elsewhere, such as from a secrets store, that
+// the caller renews itself.
+func StaticTokenSource(tok *Token) TokenSource {
+	return staticTokenSource{tok}
+}
+
+type staticTokenSource struct{ tok *Token }
+
+func (s staticTokenSource) Token() (*Token, error) {
+	tok := *s.tok
+	return &tok, nil
+}
+
+// ReuseTokenSource returns a TokenSource that returns tok, and later the
+// last Token it got from src, for as long as that Token is Valid, and
+// only then asks src for a new one. tok may be nil. It is safe for
+// concurrent use, and src is not called concurrently.
+func ReuseTokenSource(tok *Token, src TokenSource) TokenSource {
+	return &reuseTokenSource{cur: tok, src: src}
+}
+
+type reuseTokenSource struct {
+	src TokenSource
+
+	mu  sync.Mutex
+	cur *Token
+}
+
+func (s *reuseTokenSource) Token() (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.cur.Valid() {
+		tok, err := s.src.Token()
+		if err != nil {
+			return nil, err
+		}
+		if tok == nil {
+			return nil, OAuthError{"ReuseTokenSource", "source returned no Token"}
+		}
+		s.cur = tok
+	}
+	tok := *s.cur
+	return &tok, nil
+}
+
+// WrapRoundTripper returns an http.RoundTripper that sends each request
+// through base with a Bearer token from src, so that OAuth can be added
+// to an existing transport with its own tracing or retries. src is
+// asked for a token on every request; wrap it with ReuseTokenSource,
+// CachedTokenSource or similar to reuse tokens. A nil base means http.DefaultTransport.
+func WrapRoundTripper(base http.RoundTripper, src TokenSource) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &sourceTransport{base: base, src: src}
+}
+
+type sourceTransport struct {
+	base http.RoundTripper
+	src  TokenSource
+}
+
+func (t *sourceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	tok, err := t.src.Token()
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	req2 := req.Clone(req.Context())
+	req2.Header.Set("Authorization", "Bearer "+tok.AccessToken)
+	return t.base.RoundTrip(req2)
+}
+
+// WarmStandbyTokenSource returns a TokenSource that keeps a standby
+// Token ready for when the current one expires. Once the current Token
+// is within lead of its expiry, Token starts fetching the next one from
+// src in the background, and serves it as soon as the current Token
+// expires, so that callers do not wait for a refresh at rollover. If
+// the standby is not ready in time, Token waits for it, or fetches a
+// Token itself if fetching the standby failed. src should issue a new
+// Token on every call.
+func WarmStandbyTokenSource(src TokenSource, lead time.Duration) TokenSource {
+	return &warmStandbySource{src: src, lead: lead}
+}
+
+type warmStandbySource struct {
+	src  TokenSource
+	lead time.Duration
+
+	mu   sync.Mutex
+	cur  *Token        // the Token being served
+	next *Token        // the standby, once fetched
+	done chan struct{} // closed when the standby fetch in progress, if any, ends
+}
+
+func (s *warmStandbySource) Token() (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.cur == nil || s.cur.needsRefresh(0) {
+		if s.next != nil && !s.next.needsRefresh(0) {
+			s.cur, s.next = s.next, nil
+			break
+		}
+		if done := s.done; done != nil {
+			s.mu.Unlock()
+			<-done
+			s.mu.Lock()
+			continue
+		}
+		tok, err := s.src.Token()
+		if err != nil {
+			return nil, err
+		}
+		if tok == nil {
+			return nil, OAuthError{"WarmStandbyTokenSource", "source returned no Token"}
+		}
+		s.cur, s.next = tok, nil
+	}
+	if s.next == nil && s.done == nil && s.cur.expiresWithin(s.lead) {
+		s.done = make(chan struct{})
+		go s.fetchStandby(s.done)
+	}
+	tok := *s.cur
+	return &tok, nil
+}
+
+// fetchStandby fetches the standby Token and closes done.
+func (s *warmStandbySource) fetchStandby(done chan struct{}) {
+	tok, err := s.src.Token()
+	s.mu.Lock()
+	if err == nil {
+		s.next = tok
+	}
+	s.done = nil
+	s.mu.Unlock()
+	close(done)
+}
@@ -0,0 +1,268 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingSource is a TokenSource that issues a new hour-long Token on
+// every call.
+type countingSource struct{ calls int }
+
+func (s *countingSource) Token() (*Token, error) {
+	s.calls++
+	return &Token{
+		AccessToken: "token" + strconv.Itoa(s.calls),
+		Expiry:      time.Now().Add(time.Hour),
+	}, nil
+}
+
+func TestCachedTokenSource(t *testing.T) {
+	cache := &countingCache{tok: &Token{AccessToken: "cached", Expiry: time.Now().Add(time.Hour)}}
+	src := &countingSource{}
+	ts := CachedTokenSource(src, cache)
+
+	tok, err := ts.Token()
+	if err != nil {
+		t.Fatalf("Token: %v", err)
+	}
+	if tok.AccessToken != "cached" || src.calls != 0 {
+		t.Errorf("Token = %q after %d source calls, want cached after 0", tok.AccessToken, src.calls)
+	}
+
+	cache.tok.Expiry = time.Now().Add(-time.Second)
+	if tok, err = ts.Token(); err != nil {
+		t.Fatalf("Token: %v", err)
+	}
+	if tok.AccessToken != "token1" || src.calls != 1 {
+		t.Errorf("expired cache: Token = %q after %d source calls, want token1 after 1", tok.AccessToken, src.calls)
+	}
+	if cache.tok != tok {
+		t.Errorf("new token was not written to the cache")
+	}
+	if tok, _ = ts.Token(); tok.AccessToken != "token1" || src.calls != 1 {
+		t.Errorf("Token = %q after %d source calls, want token1 after 1", tok.AccessToken, src.calls)
+	}
+
+	cache.tok = nil
+	cache.err = OAuthError{"countingCache", "disk full"}
+	if _, err := ts.Token(); err != cache.err {
+		t.Errorf("failed cache write: err = %v, want %v", err, cache.err)
+	}
+}
+
+func TestReuseTokenSource(t *testing.T) {
+	src := &countingSource{}
+	ts := ReuseTokenSource(&Token{AccessToken: "initial", Expiry: time.Now().Add(time.Hour)}, src)
+	for i := 0; i < 2; i++ {
+		if tok, err := ts.Token(); err != nil || tok.AccessToken != "initial" || src.calls != 0 {
+			t.Errorf("Token = %v, %v after %d source calls, want initial after 0", tok, err, src.calls)
+		}
+	}
+
+	// A token expiring within DefaultExpirySkew is replaced.
+	ts = ReuseTokenSource(&Token{AccessToken: "stale", Expiry: time.Now().Add(time.Second)}, src)
+	for i := 0; i < 2; i++ {
+		if tok, err := ts.Token(); err != nil || tok.AccessToken != "token1" || src.calls != 1 {
+			t.Errorf("Token = %v, %v after %d source calls, want token1 after 1", tok, err, src.calls)
+		}
+	}
+
+	tok, _ := ReuseTokenSource(nil, src).Token()
+	if tok.AccessToken != "token2" {
+		t.Errorf("nil initial token: Token = %q, want token2", tok.AccessToken)
+	}
+
+	if tok, err := ReuseTokenSource(nil, nilSource{}).Token(); err == nil {
+		t.Errorf("source returning no Token: Token = %v, want an error", tok)
+	}
+}
+
+func TestWarmStandbyNilToken(t *testing.T) {
+	if tok, err := WarmStandbyTokenSource(nilSource{}, time.Minute).Token(); err == nil {
+		t.Errorf("source returning no Token: Token = %v, want an error", tok)
+	}
+}
+
+// nilSource is a TokenSource that returns neither a Token nor an error.
+type nilSource struct{}
+
+func (nilSource) Token() (*Token, error) { return nil, nil }
+
+func TestStaticTokenSource(t *testing.T) {
+	orig := &Token{AccessToken: "st4t1c"}
+	ts := StaticTokenSource(orig)
+	tok, err := ts.Token()
+	if err != nil || tok.AccessToken != "st4t1c" {
+		t.Fatalf("Token = %v, %v, want st4t1c", tok, err)
+	}
+	tok.AccessToken = "changed"
+	if tok, _ = ts.Token(); tok.AccessToken != "st4t1c" {
+		t.Errorf("changing a returned Token changed the source's")
+	}
+}
+
+// recordingRoundTripper counts the requests it passes to http.DefaultTransport.
+type recordingRoundTripper struct{ calls int }
+
+func (rt *recordingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt.calls++
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestWrapRoundTripper(t *testing.T) {
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+	}))
+	defer server.Close()
+
+	base := &recordingRoundTripper{}
+	c := &http.Client{Transport: WrapRoundTripper(base, &countingSource{})}
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	resp.Body.Close()
+	if auth != "Bearer token1" {
+		t.Errorf("Authorization = %q, want %q", auth, "Bearer token1")
+	}
+	if base.calls != 1 {
+		t.Errorf("base transport called %d times, want 1", base.calls)
+	}
+	if req.Header.Get("Authorization") != "" {
+		t.Errorf("caller's request was modified")
+	}
+}
+
+func TestRefreshTokenSource(t *testing.T) {
+	refreshes := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.FormValue("grant_type") != "refresh_token" || r.FormValue("refresh_token") != "refreshtoken1" {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"error":"invalid_grant"}`)
+			return
+		}
+		refreshes++
+		io.WriteString(w, `{"access_token":"token1","expires_in":3600}`)
+	}))
+	defer server.Close()
+
+	config := &Config{ClientId: "cl13nt1d", TokenURL: server.URL}
+	ts := config.RefreshTokenSource("refreshtoken1")
+	for i := 0; i < 2; i++ {
+		tok, err := ts.Token()
+		if err != nil {
+			t.Fatalf("Token: %v", err)
+		}
+		checkToken(t, tok, "token1", "refreshtoken1")
+	}
+	if refreshes != 1 {
+		t.Errorf("made %d refreshes, want 1", refreshes)
+	}
+
+	_, err := config.RefreshTokenSource("revoked").Token()
+	if !errors.Is(err, ErrRefreshTokenExpired) {
+		t.Errorf("Token with a revoked refresh token: err = %v, want ErrRefreshTokenExpired", err)
+	}
+	var re *RetrieveError
+	if !errors.As(err, &re) || re.ErrorCode != "invalid_grant" || re.StatusCode != http.StatusBadRequest {
+		t.Errorf("Token with a revoked refresh token: err = %v, want it to wrap the invalid_grant RetrieveError", err)
+	}
+}
+
+// clockSource is a TokenSource, safe for concurrent use, that issues a
+// new Token valid for an hour by timeNow on every call.
+type clockSource struct {
+	mu    sync.Mutex
+	calls int
+}
+
+func (s *clockSource) Token() (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	return &Token{AccessToken: "token" + strconv.Itoa(s.calls), Expiry: timeNow().Add(time.Hour)}, nil
+}
+
+func (s *clockSource) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+func TestWarmStandbyTokenSource(t *testing.T) {
+	var clock sync.Mutex
+	now := time.Now()
+	defer func(f func() time.Time) { timeNow = f }(timeNow)
+	timeNow = func() time.Time {
+		clock.Lock()
+		defer clock.Unlock()
+		return now
+	}
+	advance := func(d time.Duration) {
+		clock.Lock()
+		now = now.Add(d)
+		clock.Unlock()
+	}
+
+	src := &clockSource{}
+	ts := WarmStandbyTokenSource(src, time.Minute)
+	get := func(want string) {
+		t.Helper()
+		tok, err := ts.Token()
+		if err != nil {
+			t.Fatalf("Token: %v", err)
+		}
+		if tok.AccessToken != want {
+			t.Errorf("Token = %q, want %q", tok.AccessToken, want)
+		}
+	}
+	get("token1")
+	// Callers get copies they may change.
+	if tok, err := ts.Token(); err == nil {
+		tok.AccessToken = "changed"
+	}
+	advance(30 * time.Minute)
+	get("token1")
+	if n := src.count(); n != 1 {
+		t.Errorf("source called %d times long before expiry, want 1", n)
+	}
+
+	// Within a minute of expiry, the standby is fetched in the background.
+	advance(29*time.Minute + 30*time.Second)
+	get("token1")
+	ws := ts.(*warmStandbySource)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		ws.mu.Lock()
+		ready := ws.next != nil
+		ws.mu.Unlock()
+		if ready {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("standby token not fetched before the primary expired")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// At rollover the standby is served without asking the source.
+	advance(time.Minute)
+	get("token2")
+	if n := src.count(); n != 2 {
+		t.Errorf("source called %d times by rollover, want 2", n)
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// splitUnixURL splits an endpoint URL of the form
+// "unix:///path/to/socket:/request/path" into the socket path and the
+// request path, which defaults to "/". It reports false for any other
+// URL.
+func splitUnixURL(u string) (socket, path string, ok bool) {
+	if !strings.HasPrefix(u, "unix://") {
+		return "", "", false
+	}
+	socket, path = u[len("unix://"):], "/"
+	if i := strings.Index(socket, ":"); i >= 0 {
+		socket, path = socket[:i], socket[i+1:]
+	}
+	if socket == "" {
+		return "", "", false
+	}
+	return socket, path, true
+}
+
+// unixTransport returns a transport that sends every request over a
+// new connection to the Unix socket at socket. It replaces the
+// Transport's own RoundTripper for requests to unix:// endpoints.
+func unixTransport(socket string) http.RoundTripper {
+	return &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		},
+		DisableKeepAlives: true,
+	}
+}
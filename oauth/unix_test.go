@@ -0,0 +1,66 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUnixSocketTokenURL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goauth2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "broker.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	var path string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"access_token":"token1","refresh_token":"refreshtoken1","expires_in":3600}`)
+	}))
+	server.Listener.Close()
+	server.Listener = l
+	server.Start()
+	defer server.Close()
+
+	transport := &Transport{Config: &Config{TokenURL: "unix://" + socket + ":/token"}}
+	tok, err := transport.Exchange("c0d3")
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	checkToken(t, tok, "token1", "refreshtoken1")
+	if path != "/token" {
+		t.Errorf("request path = %q, want /token", path)
+	}
+}
+
+func TestSplitUnixURL(t *testing.T) {
+	for _, tt := range []struct {
+		u, socket, path string
+		ok              bool
+	}{
+		{"unix:///run/broker.sock:/token", "/run/broker.sock", "/token", true},
+		{"unix:///run/broker.sock", "/run/broker.sock", "/", true},
+		{"unix://", "", "", false},
+		{"https://example.com/token", "", "", false},
+	} {
+		socket, path, ok := splitUnixURL(tt.u)
+		if socket != tt.socket || path != tt.path || ok != tt.ok {
+			t.Errorf("splitUnixURL(%q) = %q, %q, %v; want %q, %q, %v", tt.u, socket, path, ok, tt.socket, tt.path, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// ErrUserInfoSubject is returned by UserInfo when the response is about
+// another user than the ID token of the Transport's Token.
+var ErrUserInfoSubject error = OAuthError{"UserInfo", "subject does not match the ID token's"}
+
+// UserInfo holds the standard claims of an OpenID Connect UserInfo
+// response (OpenID Connect Core 1.0 section 5.1). Only Subject is always
+// present.
+type UserInfo struct {
+	Subject       string
+	Name          string
+	Email         string
+	EmailVerified bool
+	Picture       string
+
+	// raw holds every claim of the response. See Extra.
+	raw map[string]interface{}
+}
+
+// Extra returns the value of a claim of the UserInfo response, such as
+// a provider-specific one, or nil if the provider did not return it.
+func (u *UserInfo) Extra(key string) interface{} {
+	return u.raw[key]
+}
+
+// UserInfo fetches the claims about the user the Transport's Token was
+// issued for from the Config's UserInfoURL, refreshing the Token first
+// if necessary. If the Token has an ID token, the response must be
+// about the same subject, or UserInfo fails with ErrUserInfoSubject.
+// Signed and encrypted responses are not supported.
+func (t *Transport) UserInfo(ctx context.Context) (*UserInfo, error) {
+	config := t.config()
+	if config == nil {
+		return nil, OAuthError{"UserInfo", "no Config supplied"}
+	}
+	if config.UserInfoURL == "" {
+		return nil, OAuthError{"UserInfo", "no UserInfoURL configured"}
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", config.UserInfoURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	r, err := t.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != 200 {
+		return nil, retrieveError(r)
+	}
+	if ct := strings.TrimSpace(strings.Split(r.Header.Get("Content-Type"), ";")[0]); ct == "application/jwt" {
+		return nil, OAuthError{"UserInfo", "signed or encrypted UserInfo responses are not supported"}
+	}
+	body, err := readBody(r.Body, config.maxResponseBytes())
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, OAuthError{"UserInfo", err.Error()}
+	}
+	u := &UserInfo{raw: raw}
+	u.Subject, _ = raw["sub"].(string)
+	u.Name, _ = raw["name"].(string)
+	u.Email, _ = raw["email"].(string)
+	u.EmailVerified, _ = raw["email_verified"].(bool)
+	u.Picture, _ = raw["picture"].(string)
+	if u.Subject == "" {
+		return nil, OAuthError{"UserInfo", "no sub claim in response"}
+	}
+	if tok := t.CurrentToken(); tok != nil {
+		if claims, err := tok.Claims(); err == nil && claims["sub"] != u.Subject {
+			return nil, ErrUserInfoSubject
+		}
+	}
+	return u, nil
+}
@@ -0,0 +1,56 @@
+// Copyright 2012 The goauth2 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestUserInfo(t *testing.T) {
+	sub := "alice"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer t0k3n" {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"sub":%q,"name":"Alice","email":"alice@example.com","email_verified":true,"picture":"https://example.com/a.png","hd":"example.com"}`, sub)
+	}))
+	defer server.Close()
+
+	idToken := signTestJWT(t, testRSAKey, "rsa1", map[string]interface{}{"sub": "alice"})
+	transport := &Transport{
+		Config: &Config{UserInfoURL: server.URL},
+		Token: (&Token{AccessToken: "t0k3n", Expiry: time.Now().Add(time.Hour)}).WithExtra(map[string]interface{}{
+			"id_token": idToken,
+		}),
+	}
+	u, err := transport.UserInfo(context.Background())
+	if err != nil {
+		t.Fatalf("UserInfo: %v", err)
+	}
+	if u.Subject != "alice" || u.Name != "Alice" || u.Email != "alice@example.com" || !u.EmailVerified || u.Picture != "https://example.com/a.png" {
+		t.Errorf("UserInfo = %+v", u)
+	}
+	if u.Extra("hd") != "example.com" {
+		t.Errorf(`Extra("hd") = %v, want example.com`, u.Extra("hd"))
+	}
+
+	sub = "mallory"
+	if _, err := transport.UserInfo(context.Background()); err != ErrUserInfoSubject {
+		t.Errorf("UserInfo about another subject: err = %v, want ErrUserInfoSubject", err)
+	}
+
+	transport.Token = &Token{AccessToken: "expired", Expiry: time.Now().Add(time.Hour)}
+	if _, err := transport.UserInfo(context.Background()); err == nil {
+		t.Errorf("UserInfo with a rejected token succeeded")
+	}
+}